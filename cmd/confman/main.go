@@ -35,8 +35,16 @@ func run(args []string, exit func(int)) {
 	cli.ConfigureWriteCommand(ctx, app, log)
 	cli.ConfigureListCommand(ctx, app, log)
 	cli.ConfigureDeleteCommand(ctx, app, log)
+	cli.ConfigureHistoryCommand(ctx, app, log)
+	cli.ConfigureRollbackCommand(ctx, app, log)
+	cli.ConfigureRekeyCommand(ctx, app, log)
 	cli.ConfigureExecCommand(ctx, app, log)
+	cli.ConfigureExecEachCommand(ctx, app, log)
 	cli.ConfigureDeployCommand(ctx, app, log)
+	cli.ConfigureRenderCommand(ctx, app, log)
+	cli.ConfigureAgentCommand(ctx, app, log)
+	cli.ConfigureServeCommand(ctx, app, log)
+	cli.ConfigureValidateCommand(ctx, app, log)
 
 	kingpin.MustParse(app.Parse(args))
 }
@@ -0,0 +1,384 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/micvbang/confman-go/pkg/confman"
+	"github.com/micvbang/confman-go/pkg/confman/client"
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/render"
+	"github.com/micvbang/confman-go/pkg/storage"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	defaultAgentInterval = 30 * time.Second
+	defaultAgentJitter   = 0.1
+	defaultAgentFileMode = "0600"
+)
+
+var ErrInvalidAgentConfig = errors.New("invalid agent config")
+
+// AgentConfig is the configuration of the agent, read from a YAML file.
+type AgentConfig struct {
+	// Interval between checking for configuration changes.
+	Interval time.Duration `yaml:"interval"`
+
+	// Jitter randomly changes each interval by up to the given fraction of
+	// it.
+	Jitter *float64 `yaml:"jitter"`
+
+	Templates []AgentTemplate `yaml:"templates"`
+}
+
+// AgentTemplate is a template rendered with the configuration of one or
+// more service paths.
+type AgentTemplate struct {
+	ServicePaths string      `yaml:"service"`
+	Source       string      `yaml:"source"`
+	Destination  string      `yaml:"destination"`
+	Mode         string      `yaml:"mode"`
+	Reload       AgentReload `yaml:"reload"`
+
+	tmpl *template.Template
+	mode os.FileMode
+}
+
+// AgentReload describes how to make a process reload its configuration after
+// the destination file changed. When both a signal and a command are given,
+// the signal is sent first.
+type AgentReload struct {
+	Signal  string   `yaml:"signal"`
+	PIDFile string   `yaml:"pid_file"`
+	Command []string `yaml:"command"`
+
+	signal syscall.Signal
+}
+
+type AgentCommandInput struct {
+	ConfigPath string
+	Once       bool
+}
+
+func ConfigureAgentCommand(ctx context.Context, app *kingpin.Application, log logger.Logger) {
+	input := AgentCommandInput{}
+
+	cmd := app.Command("agent", "Keeps files rendered from templates in sync with configuration")
+	cmd.Flag("config", "Path of the agent config file").
+		Required().
+		Envar("CONFMAN_AGENT_CONFIG").
+		StringVar(&input.ConfigPath)
+
+	cmd.Flag("once", "Render all templates once and exit").
+		Default("false").
+		BoolVar(&input.Once)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		app.FatalIfError(AgentCommand(ctx, input, log, GlobalFlags.Storage), "agent")
+		return nil
+	})
+}
+
+// AgentCommand renders all templates given in the agent config, and then
+// re-renders each template whenever the configuration of its service paths
+// changes, until ctx is cancelled. All templates share a single watcher, such
+// that each service path is polled once. Rendering all templates at start
+// must succeed; later failures are logged, leave the destination unchanged
+// and are retried every interval until rendering succeeds. Failed reloads
+// are likewise logged and retried, e.g. when the process to reload hasn't
+// started yet.
+func AgentCommand(ctx context.Context, input AgentCommandInput, log logger.Logger, storage storage.Storage) error {
+	config, err := readAgentConfig(input.ConfigPath)
+	if err != nil {
+		return err
+	}
+
+	watcher, err := client.New(log, storage, strings.Join(agentServicePaths(config.Templates), ",")).NewWatcher(config.Interval)
+	if err != nil {
+		return err
+	}
+	watcher.Jitter = *config.Jitter
+
+	// Render from the state that the watcher reports changes relative to,
+	// such that no changes are missed.
+	err = watcher.Init(ctx)
+	if err != nil {
+		return err
+	}
+
+	// pendingRender holds the templates that must be rendered, either
+	// because their configuration changed or because rendering them failed.
+	// pendingReload holds the templates whose destination changed, but
+	// whose reload action hasn't succeeded yet.
+	pendingRender := make([]bool, len(config.Templates))
+	pendingReload := make([]bool, len(config.Templates))
+
+	values := watcher.Values()
+	for i, t := range config.Templates {
+		changed, err := renderAgentTemplate(log, t, mergeWatcherValues(t.ServicePaths, values))
+		if err != nil {
+			return err
+		}
+		pendingReload[i] = changed
+	}
+
+	if input.Once {
+		for i, t := range config.Templates {
+			if pendingReload[i] {
+				err = t.Reload.run(ctx, log)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	numPending := runAgentReloads(ctx, log, config, pendingReload)
+	changes := watcher.Changes(ctx)
+	for {
+		var retry <-chan time.Time
+		if numPending > 0 {
+			retry = time.After(config.Interval)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case cs, ok := <-changes:
+			if !ok {
+				return ctx.Err()
+			}
+
+			changedServicePaths := make(map[string]bool, len(cs))
+			for _, change := range cs {
+				log.Infof("%s %s/%s", change.Type, change.ServicePath, change.Key)
+				changedServicePaths[change.ServicePath] = true
+			}
+
+			for i, t := range config.Templates {
+				for _, servicePath := range confman.ParseServicePaths(t.ServicePaths) {
+					if changedServicePaths[servicePath] {
+						pendingRender[i] = true
+					}
+				}
+			}
+
+		case <-retry:
+		}
+
+		values := watcher.Values()
+		numPending = 0
+		for i, t := range config.Templates {
+			if !pendingRender[i] {
+				continue
+			}
+
+			changed, err := renderAgentTemplate(log, t, mergeWatcherValues(t.ServicePaths, values))
+			if err != nil {
+				log.Errorf("Failed to update %s, retrying in %s: %s", t.Destination, config.Interval, err)
+				numPending++
+				continue
+			}
+			pendingRender[i] = false
+			pendingReload[i] = pendingReload[i] || changed
+		}
+
+		numPending += runAgentReloads(ctx, log, config, pendingReload)
+	}
+}
+
+// runAgentReloads runs the reload actions of the templates in pending, and
+// returns the number of reloads that failed and are still pending.
+func runAgentReloads(ctx context.Context, log logger.Logger, config AgentConfig, pending []bool) int {
+	numPending := 0
+	for i, t := range config.Templates {
+		if !pending[i] {
+			continue
+		}
+
+		err := t.Reload.run(ctx, log)
+		if err != nil {
+			log.Errorf("Failed to reload after updating %s, retrying in %s: %s", t.Destination, config.Interval, err)
+			numPending++
+			continue
+		}
+		pending[i] = false
+	}
+
+	return numPending
+}
+
+// agentServicePaths returns the unique service paths of templates, in the
+// order they are first given.
+func agentServicePaths(templates []AgentTemplate) []string {
+	seen := map[string]bool{}
+	servicePaths := []string{}
+	for _, t := range templates {
+		for _, servicePath := range confman.ParseServicePaths(t.ServicePaths) {
+			if !seen[servicePath] {
+				seen[servicePath] = true
+				servicePaths = append(servicePaths, servicePath)
+			}
+		}
+	}
+
+	return servicePaths
+}
+
+// mergeWatcherValues merges the values of the service paths, in order, such
+// that the value from the service path given last takes precedence.
+func mergeWatcherValues(servicePaths string, values map[string]map[string]string) map[string]string {
+	merged := make(map[string]string)
+	for _, servicePath := range confman.ParseServicePaths(servicePaths) {
+		for key, value := range values[servicePath] {
+			merged[key] = value
+		}
+	}
+
+	return merged
+}
+
+// renderAgentTemplate renders t with values and writes it to its
+// destination, returning whether the contents changed.
+func renderAgentTemplate(log logger.Logger, t AgentTemplate, values map[string]string) (bool, error) {
+	buf := bytes.NewBuffer(nil)
+	err := t.tmpl.Execute(buf, values)
+	if err != nil {
+		return false, err
+	}
+
+	current, err := os.ReadFile(t.Destination)
+	if err == nil && bytes.Equal(current, buf.Bytes()) {
+		log.Debugf("%s is up to date", t.Destination)
+		return false, nil
+	}
+
+	err = writeFileAtomic(t.Destination, buf.Bytes(), t.mode)
+	if err != nil {
+		return false, err
+	}
+	log.Infof("Wrote %s", t.Destination)
+
+	return true, nil
+}
+
+// run sends the reload signal to the process in the PID file, and runs the
+// reload command, if given.
+func (r AgentReload) run(ctx context.Context, log logger.Logger) error {
+	if r.signal != 0 {
+		bs, err := os.ReadFile(r.PIDFile)
+		if err != nil {
+			return fmt.Errorf("reading PID file: %w", err)
+		}
+
+		pid, err := strconv.Atoi(strings.TrimSpace(string(bs)))
+		if err != nil {
+			return fmt.Errorf("invalid PID in %s: %w", r.PIDFile, err)
+		}
+
+		process, err := os.FindProcess(pid)
+		if err == nil {
+			err = process.Signal(r.signal)
+		}
+		if err != nil {
+			return fmt.Errorf("sending %s to %d: %w", r.Signal, pid, err)
+		}
+		log.Infof("Sent %s to %d", r.Signal, pid)
+	}
+
+	if len(r.Command) > 0 {
+		cmd := exec.CommandContext(ctx, r.Command[0], r.Command[1:]...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		err := cmd.Run()
+		if err != nil {
+			return fmt.Errorf("running reload command: %w", err)
+		}
+		log.Infof("Ran %s", strings.Join(r.Command, " "))
+	}
+
+	return nil
+}
+
+// readAgentConfig reads and validates the agent config at configPath, and
+// parses all templates.
+func readAgentConfig(configPath string) (AgentConfig, error) {
+	config := AgentConfig{}
+
+	bs, err := os.ReadFile(configPath)
+	if err != nil {
+		return config, err
+	}
+
+	err = yaml.UnmarshalStrict(bs, &config)
+	if err != nil {
+		return config, fmt.Errorf("%w: %s", ErrInvalidAgentConfig, err)
+	}
+
+	if config.Interval == 0 {
+		config.Interval = defaultAgentInterval
+	}
+	if config.Jitter == nil {
+		jitter := defaultAgentJitter
+		config.Jitter = &jitter
+	}
+	if config.Interval < 0 || *config.Jitter < 0 || *config.Jitter > 1 {
+		return config, fmt.Errorf("%w: interval must be positive and jitter between 0 and 1", ErrInvalidAgentConfig)
+	}
+	if len(config.Templates) == 0 {
+		return config, fmt.Errorf("%w: no templates given", ErrInvalidAgentConfig)
+	}
+
+	for i := range config.Templates {
+		t := &config.Templates[i]
+		if len(t.ServicePaths) == 0 || len(t.Source) == 0 || len(t.Destination) == 0 {
+			return config, fmt.Errorf("%w: template %d must have service, source and destination", ErrInvalidAgentConfig, i+1)
+		}
+
+		if len(t.Mode) == 0 {
+			t.Mode = defaultAgentFileMode
+		}
+		mode, err := strconv.ParseUint(t.Mode, 8, 32)
+		if err != nil || mode > 0777 {
+			return config, fmt.Errorf("%w: invalid mode '%s' of %s", ErrInvalidAgentConfig, t.Mode, t.Destination)
+		}
+		t.mode = os.FileMode(mode)
+
+		if len(t.Reload.Signal) > 0 {
+			if len(t.Reload.PIDFile) == 0 {
+				return config, fmt.Errorf("%w: reload signal of %s given without pid_file", ErrInvalidAgentConfig, t.Destination)
+			}
+
+			t.Reload.signal, err = parseSignal(t.Reload.Signal)
+			if err != nil {
+				return config, fmt.Errorf("%w: %s", ErrInvalidAgentConfig, err)
+			}
+		}
+
+		text, err := os.ReadFile(t.Source)
+		if err != nil {
+			return config, fmt.Errorf("reading template: %w", err)
+		}
+
+		t.tmpl, err = render.Parse(t.Source, string(text))
+		if err != nil {
+			return config, err
+		}
+	}
+
+	return config, nil
+}
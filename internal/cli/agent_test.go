@@ -0,0 +1,306 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/micvbang/confman-go/pkg/confman"
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/storage/memory"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAgentCommand verifies that templates are rendered at start with the
+// given file mode, re-rendered when configuration changes, and that the
+// reload command is run when the destination changed.
+func TestAgentCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	log := logger.LogrusWrapper{Logger: logrus.New()}
+	confman.ChamberCompatible = false
+
+	m := memory.New(log)
+	require.NoError(t, m.WriteKeys(ctx, "/shared/production", map[string]string{"DB_HOST": "shared-db", "DB_PORT": "5432"}))
+	require.NoError(t, m.WriteKeys(ctx, "/service/production", map[string]string{"DB_HOST": "old-db"}))
+
+	dir := t.TempDir()
+	sourcePath := filepath.Join(dir, "app.ini.tmpl")
+	destinationPath := filepath.Join(dir, "app.ini")
+	reloadsPath := filepath.Join(dir, "reloads")
+	require.NoError(t, os.WriteFile(sourcePath, []byte("host={{ .DB_HOST }} port={{ .DB_PORT }}"), 0644))
+
+	configPath := writeAgentConfig(t, dir, fmt.Sprintf(`
+interval: 5ms
+templates:
+  - service: /shared/production,/service/production
+    source: %s
+    destination: %s
+    mode: "0640"
+    reload:
+      command: ["sh", "-c", "echo reload >> %s"]
+`, sourcePath, destinationPath, reloadsPath))
+
+	done := make(chan error)
+	go func() {
+		done <- AgentCommand(ctx, AgentCommandInput{ConfigPath: configPath}, log, m)
+	}()
+
+	require.Eventually(t, func() bool {
+		bs, _ := os.ReadFile(destinationPath)
+		return string(bs) == "host=old-db port=5432"
+	}, time.Second, time.Millisecond)
+
+	info, err := os.Stat(destinationPath)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	require.NoError(t, m.Write(ctx, "/service/production", "DB_HOST", "new-db"))
+	require.Eventually(t, func() bool {
+		bs, _ := os.ReadFile(destinationPath)
+		return string(bs) == "host=new-db port=5432"
+	}, time.Second, time.Millisecond)
+
+	require.Eventually(t, func() bool {
+		bs, _ := os.ReadFile(reloadsPath)
+		return strings.Count(string(bs), "reload") == 2
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+}
+
+// TestAgentCommandOnceSignal verifies that, with Once, templates are
+// rendered and the reload signal is sent to the process in the PID file, and
+// that the signal is not sent when the destination is unchanged.
+func TestAgentCommandOnceSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires signals")
+	}
+
+	ctx := context.Background()
+	log := logger.LogrusWrapper{Logger: logrus.New()}
+	confman.ChamberCompatible = false
+
+	m := memory.New(log)
+	require.NoError(t, m.WriteKeys(ctx, "/service/production", map[string]string{"DB_HOST": "db"}))
+
+	dir := t.TempDir()
+	sourcePath := filepath.Join(dir, "app.ini.tmpl")
+	destinationPath := filepath.Join(dir, "app.ini")
+	pidPath := filepath.Join(dir, "app.pid")
+	require.NoError(t, os.WriteFile(sourcePath, []byte("host={{ .DB_HOST }}"), 0644))
+
+	configPath := writeAgentConfig(t, dir, fmt.Sprintf(`
+templates:
+  - service: /service/production
+    source: %s
+    destination: %s
+    reload:
+      signal: SIGTERM
+      pid_file: %s
+`, sourcePath, destinationPath, pidPath))
+
+	cmd := exec.Command("sleep", "10")
+	require.NoError(t, cmd.Start())
+	defer cmd.Process.Kill()
+	require.NoError(t, os.WriteFile(pidPath, []byte(fmt.Sprintf("%d\n", cmd.Process.Pid)), 0644))
+
+	// Unchanged destination, signal must not be sent
+	require.NoError(t, os.WriteFile(destinationPath, []byte("host=db"), 0600))
+	err := AgentCommand(ctx, AgentCommandInput{ConfigPath: configPath, Once: true}, log, m)
+	require.NoError(t, err)
+
+	require.NoError(t, m.Write(ctx, "/service/production", "DB_HOST", "new-db"))
+	err = AgentCommand(ctx, AgentCommandInput{ConfigPath: configPath, Once: true}, log, m)
+	require.NoError(t, err)
+
+	bs, err := os.ReadFile(destinationPath)
+	require.NoError(t, err)
+	require.Equal(t, "host=new-db", string(bs))
+
+	cmd.Wait()
+	require.Equal(t, exitSignalBase+15, exitStatus(cmd.ProcessState))
+}
+
+// TestAgentCommandRetry verifies that templates sharing a service path are
+// all re-rendered when it changes, and that a template whose rendering failed
+// is rendered again without further changes.
+func TestAgentCommandRetry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	log := logger.LogrusWrapper{Logger: logrus.New()}
+
+	m := memory.New(log)
+	require.NoError(t, m.WriteKeys(ctx, "/service/production", map[string]string{"DB_HOST": "old-db"}))
+
+	dir := t.TempDir()
+	sourcePath := filepath.Join(dir, "app.ini.tmpl")
+	destinationDir := filepath.Join(dir, "conf")
+	firstPath := filepath.Join(dir, "first.ini")
+	secondPath := filepath.Join(destinationDir, "second.ini")
+	require.NoError(t, os.WriteFile(sourcePath, []byte("host={{ .DB_HOST }}"), 0644))
+	require.NoError(t, os.Mkdir(destinationDir, 0755))
+
+	configPath := writeAgentConfig(t, dir, fmt.Sprintf(`
+interval: 5ms
+templates:
+  - service: /service/production
+    source: %s
+    destination: %s
+  - service: /service/production
+    source: %s
+    destination: %s
+`, sourcePath, firstPath, sourcePath, secondPath))
+
+	done := make(chan error)
+	go func() {
+		done <- AgentCommand(ctx, AgentCommandInput{ConfigPath: configPath}, log, m)
+	}()
+
+	require.Eventually(t, func() bool {
+		bs, _ := os.ReadFile(secondPath)
+		return string(bs) == "host=old-db"
+	}, time.Second, time.Millisecond)
+
+	// Writing the second destination fails until its directory exists again
+	require.NoError(t, os.RemoveAll(destinationDir))
+	require.NoError(t, m.Write(ctx, "/service/production", "DB_HOST", "new-db"))
+	require.Eventually(t, func() bool {
+		bs, _ := os.ReadFile(firstPath)
+		return string(bs) == "host=new-db"
+	}, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+
+	require.NoError(t, os.Mkdir(destinationDir, 0755))
+	require.Eventually(t, func() bool {
+		bs, _ := os.ReadFile(secondPath)
+		return string(bs) == "host=new-db"
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+}
+
+// TestAgentCommandReloadRetry verifies that the agent starts when the reload
+// action fails, and that failed reloads are retried until they succeed, also
+// when the destination is already up to date.
+func TestAgentCommandReloadRetry(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	log := logger.LogrusWrapper{Logger: logrus.New()}
+
+	m := memory.New(log)
+	require.NoError(t, m.WriteKeys(ctx, "/service/production", map[string]string{"DB_HOST": "old-db"}))
+
+	dir := t.TempDir()
+	sourcePath := filepath.Join(dir, "app.ini.tmpl")
+	destinationPath := filepath.Join(dir, "app.ini")
+	readyPath := filepath.Join(dir, "ready")
+	reloadsPath := filepath.Join(dir, "reloads")
+	require.NoError(t, os.WriteFile(sourcePath, []byte("host={{ .DB_HOST }}"), 0644))
+
+	// The reload command fails until the process it reloads is ready
+	configPath := writeAgentConfig(t, dir, fmt.Sprintf(`
+interval: 5ms
+templates:
+  - service: /service/production
+    source: %s
+    destination: %s
+    reload:
+      command: ["sh", "-c", "test -f %s && echo reload >> %s"]
+`, sourcePath, destinationPath, readyPath, reloadsPath))
+
+	done := make(chan error)
+	go func() {
+		done <- AgentCommand(ctx, AgentCommandInput{ConfigPath: configPath}, log, m)
+	}()
+
+	require.Eventually(t, func() bool {
+		bs, _ := os.ReadFile(destinationPath)
+		return string(bs) == "host=old-db"
+	}, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	require.NoFileExists(t, reloadsPath)
+
+	require.NoError(t, os.WriteFile(readyPath, nil, 0644))
+	require.Eventually(t, func() bool {
+		bs, _ := os.ReadFile(reloadsPath)
+		return strings.Count(string(bs), "reload") == 1
+	}, time.Second, time.Millisecond)
+
+	require.NoError(t, os.Remove(readyPath))
+	require.NoError(t, m.Write(ctx, "/service/production", "DB_HOST", "new-db"))
+	require.Eventually(t, func() bool {
+		bs, _ := os.ReadFile(destinationPath)
+		return string(bs) == "host=new-db"
+	}, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+
+	require.NoError(t, os.WriteFile(readyPath, nil, 0644))
+	require.Eventually(t, func() bool {
+		bs, _ := os.ReadFile(reloadsPath)
+		return strings.Count(string(bs), "reload") == 2
+	}, time.Second, time.Millisecond)
+
+	time.Sleep(20 * time.Millisecond)
+	bs, err := os.ReadFile(reloadsPath)
+	require.NoError(t, err)
+	require.Equal(t, 2, strings.Count(string(bs), "reload"))
+
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+}
+
+// TestReadAgentConfigInvalid verifies that invalid agent configs are
+// rejected.
+func TestReadAgentConfigInvalid(t *testing.T) {
+	dir := t.TempDir()
+	sourcePath := filepath.Join(dir, "app.ini.tmpl")
+	require.NoError(t, os.WriteFile(sourcePath, []byte("{{ .DB_HOST }}"), 0644))
+
+	template := func(extra string) string {
+		return fmt.Sprintf("templates:\n  - service: /service/production\n    source: %s\n    destination: %s\n%s", sourcePath, filepath.Join(dir, "app.ini"), extra)
+	}
+
+	tests := map[string]string{
+		"no templates":       "interval: 5s\n",
+		"unknown field":      template("    unknown: true\n"),
+		"missing service":    fmt.Sprintf("templates:\n  - source: %s\n    destination: /tmp/x\n", sourcePath),
+		"invalid mode":       template("    mode: \"0999\"\n"),
+		"invalid jitter":     "jitter: 2\n" + template(""),
+		"signal without pid": template("    reload:\n      signal: SIGHUP\n"),
+		"invalid signal":     template("    reload:\n      signal: SIGFOO\n      pid_file: /tmp/pid\n"),
+	}
+
+	for name, config := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := readAgentConfig(writeAgentConfig(t, t.TempDir(), config))
+			require.ErrorIs(t, err, ErrInvalidAgentConfig)
+		})
+	}
+
+	_, err := readAgentConfig(writeAgentConfig(t, t.TempDir(), strings.Replace(template(""), sourcePath, filepath.Join(dir, "missing.tmpl"), 1)))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func writeAgentConfig(t *testing.T, dir string, config string) string {
+	configPath := filepath.Join(dir, "agent.yml")
+	require.NoError(t, os.WriteFile(configPath, []byte(config), 0644))
+	return configPath
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/micvbang/confman-go/pkg/configuration"
 	"github.com/micvbang/confman-go/pkg/confman"
+	"github.com/micvbang/confman-go/pkg/schema"
 	"github.com/micvbang/go-helpy/mapy"
 
 	"github.com/micvbang/confman-go/pkg/logger"
@@ -19,10 +20,11 @@ import (
 )
 
 type DeployCommandInput struct {
-	Path      string
-	Base      string
-	Define    bool
-	AssumeYes bool
+	Path       string
+	Base       string
+	Define     bool
+	AssumeYes  bool
+	SchemaPath string
 }
 
 func ConfigureDeployCommand(ctx context.Context, app *kingpin.Application, log logger.Logger) {
@@ -47,6 +49,8 @@ func ConfigureDeployCommand(ctx context.Context, app *kingpin.Application, log l
 		Default("false").
 		BoolVar(&input.AssumeYes)
 
+	addFlagSchema(cmd, &input.SchemaPath)
+
 	cmd.Action(func(c *kingpin.ParseContext) error {
 		app.FatalIfError(DeployCommand(ctx, input, os.Stdin, os.Stdout, log, GlobalFlags.Storage), "deploy")
 		return nil
@@ -59,6 +63,18 @@ func DeployCommand(ctx context.Context, input DeployCommandInput, rd io.Reader,
 		return err
 	}
 
+	if len(input.SchemaPath) > 0 {
+		err = applySchema(ctx, log, storage, input, serviceConfigs, w)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = validateServiceConfigs(ctx, log, storage, input.Base, serviceConfigs, w)
+	if err != nil {
+		return err
+	}
+
 	for _, serviceConfig := range serviceConfigs {
 		servicePath := filePathToServicePath(input.Base, serviceConfig.Path)
 		cm := confman.New(log, storage, servicePath)
@@ -73,7 +89,7 @@ func DeployCommand(ctx context.Context, input DeployCommandInput, rd io.Reader,
 		for key, value := range serviceConfig.Config {
 			fmt.Fprintf(w, "Updating %v %v = %v\n", servicePath, key, value)
 		}
-		err := cm.WriteKeys(ctx, serviceConfig.Config)
+		err := cm.WriteKeysWithOptions(ctx, serviceConfig.Config, serviceConfig.Options)
 		if err != nil {
 			return err
 		}
@@ -81,6 +97,90 @@ func DeployCommand(ctx context.Context, input DeployCommandInput, rd io.Reader,
 	return nil
 }
 
+// applySchema adds default values from the schema to serviceConfigs and
+// validates them. Configurations are validated as they will be stored and
+// read, i.e. including the currently stored keys unless they are being
+// defined, and with references resolved as by `validate`. Only defaults of
+// keys that are neither given nor stored are added. All violations are
+// written to w before returning, such that nothing is deployed unless all
+// configurations are valid.
+func applySchema(ctx context.Context, log logger.Logger, store storage.Storage, input DeployCommandInput, serviceConfigs []configuration.ServiceConfig, w io.Writer) error {
+	s, err := schema.Read(input.SchemaPath)
+	if err != nil {
+		return err
+	}
+
+	servicePaths := make([]string, len(serviceConfigs))
+	configs := make(map[string]map[string]string, len(serviceConfigs))
+	for i, serviceConfig := range serviceConfigs {
+		servicePath := filePathToServicePath(input.Base, serviceConfig.Path)
+		servicePaths[i] = servicePath
+
+		config := map[string]string{}
+		if !input.Define {
+			config, err = confman.New(log, store, servicePath).ReadAll(ctx)
+			if err != nil && !errors.Is(err, storage.ErrConfigNotFound) {
+				return err
+			}
+			if config == nil {
+				config = map[string]string{}
+			}
+		}
+		for key, value := range serviceConfig.Config {
+			config[key] = value
+		}
+
+		defaulted := s.ApplyDefaults(servicePath, config)
+		for key, value := range defaulted {
+			if _, exists := config[key]; !exists {
+				serviceConfigs[i].Config[key] = value
+			}
+		}
+		configs[servicePath] = defaulted
+	}
+
+	// References may point to keys that are being deployed, so all
+	// configurations are resolved as they will be once deployed.
+	resolved, err := confman.ResolveConfigs(ctx, log, store, configs)
+	if err != nil {
+		return err
+	}
+
+	violations := []schema.Violation{}
+	for _, servicePath := range servicePaths {
+		violations = append(violations, s.Validate(servicePath, resolved[servicePath])...)
+	}
+
+	if len(violations) > 0 {
+		outputViolations(w, violations)
+		return ErrSchemaViolation
+	}
+
+	return nil
+}
+
+// validateServiceConfigs validates serviceConfigs against the rules of the
+// storage. All violations are written to w before returning, such that
+// nothing is deployed unless all configurations can be written.
+func validateServiceConfigs(ctx context.Context, log logger.Logger, s storage.Storage, base string, serviceConfigs []configuration.ServiceConfig, w io.Writer) error {
+	violations := []storage.Violation{}
+	for _, serviceConfig := range serviceConfigs {
+		cm := confman.New(log, s, filePathToServicePath(base, serviceConfig.Path))
+		serviceViolations, err := cm.ValidateKeys(ctx, serviceConfig.Config, serviceConfig.Options)
+		if err != nil {
+			return err
+		}
+		violations = append(violations, serviceViolations...)
+	}
+
+	if len(violations) > 0 {
+		outputViolations(w, violations)
+		return storage.ErrInvalidKeys
+	}
+
+	return nil
+}
+
 var ErrUserAbortedKeyDeletion = errors.New("user aborted key deletion")
 
 func handleDefine(ctx context.Context, cm confman.Confman, rd io.Reader, w io.Writer, newConfig map[string]string, assumeYes bool) error {
@@ -4,10 +4,17 @@ import (
 	"bytes"
 	"context"
 	"io"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/micvbang/confman-go/pkg/confman"
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/storage"
+	"github.com/micvbang/confman-go/pkg/storage/memory"
+	"github.com/micvbang/confman-go/pkg/storage/parameterstore"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
@@ -103,3 +110,117 @@ func TestHandleDefine(t *testing.T) {
 	}
 
 }
+
+// TestDeployCommandInvalidKeys verifies that DeployCommand reports the keys
+// of all files that can't be written to storage, without writing any.
+func TestDeployCommandInvalidKeys(t *testing.T) {
+	confman.ChamberCompatible = false
+	log := logger.LogrusWrapper{Logger: logrus.New()}
+
+	base := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(base, "production.yml"), []byte("DB_PASSWORD: hunter2\nDB HOST: db.internal\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(base, "staging.yml"), []byte("DB_PASSWORD: \"\"\n"), 0600))
+
+	ssmMock := &parameterstore.MockSSMClient{}
+	ps := parameterstore.New(log, ssmMock, "kms key id")
+
+	buf := bytes.NewBuffer(nil)
+	err := DeployCommand(context.Background(), DeployCommandInput{Path: base, Base: base}, nil, buf, log, ps)
+	require.ErrorIs(t, err, storage.ErrInvalidKeys)
+	require.False(t, ssmMock.PutParameterCalled)
+
+	output := buf.String()
+	require.Contains(t, output, "/production/DB HOST: name")
+	require.Contains(t, output, "/staging/DB_PASSWORD: value must not be empty")
+}
+
+// TestDeployCommandSchemaStoredKeys verifies that DeployCommand validates
+// configuration including the keys already stored, and only writes defaults
+// of keys that are neither given nor stored.
+func TestDeployCommandSchemaStoredKeys(t *testing.T) {
+	confman.ChamberCompatible = false
+	ctx := context.Background()
+	log := logger.LogrusWrapper{Logger: logrus.New()}
+
+	base := t.TempDir()
+	schemaPath := filepath.Join(t.TempDir(), "schema.yml")
+	require.NoError(t, os.WriteFile(schemaPath, []byte(`
+/service:
+  DB_HOST:
+    required: true
+  DB_PORT:
+    type: int
+    default: "5432"
+  LOG_LEVEL:
+    type: enum
+    values: [debug, info]
+    default: info
+`), 0600))
+	require.NoError(t, os.MkdirAll(filepath.Join(base, "service"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(base, "service", "production.yml"), []byte("API_URL: https://api.internal\n"), 0600))
+
+	m := memory.New(log)
+	require.NoError(t, m.WriteKeys(ctx, "/service/production", map[string]string{"DB_HOST": "db", "LOG_LEVEL": "debug"}))
+
+	buf := bytes.NewBuffer(nil)
+	err := DeployCommand(ctx, DeployCommandInput{Path: base, Base: base, SchemaPath: schemaPath}, nil, buf, log, m)
+	require.NoError(t, err, buf.String())
+
+	config, err := m.ReadAll(ctx, "/service/production")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"DB_HOST":   "db",
+		"DB_PORT":   "5432",
+		"LOG_LEVEL": "debug",
+		"API_URL":   "https://api.internal",
+	}, config)
+
+	// Stored keys are not kept when defining configuration.
+	err = DeployCommand(ctx, DeployCommandInput{Path: base, Base: base, SchemaPath: schemaPath, Define: true, AssumeYes: true}, nil, buf, log, m)
+	require.ErrorIs(t, err, ErrSchemaViolation)
+}
+
+// TestDeployCommandSchemaReferences verifies that DeployCommand validates
+// configuration with references resolved, including references to stored
+// keys and to keys that are being deployed.
+func TestDeployCommandSchemaReferences(t *testing.T) {
+	confman.ChamberCompatible = false
+	ctx := context.Background()
+	log := logger.LogrusWrapper{Logger: logrus.New()}
+
+	base := t.TempDir()
+	schemaPath := filepath.Join(t.TempDir(), "schema.yml")
+	require.NoError(t, os.WriteFile(schemaPath, []byte(`
+/service:
+  DB_PORT:
+    type: int
+  API_PORT:
+    type: int
+`), 0600))
+	require.NoError(t, os.MkdirAll(filepath.Join(base, "service"), 0700))
+	require.NoError(t, os.MkdirAll(filepath.Join(base, "shared"), 0700))
+	configPath := filepath.Join(base, "service", "production.yml")
+	require.NoError(t, os.WriteFile(configPath, []byte("API_PORT: ${/shared/production/API_PORT}\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(base, "shared", "production.yml"), []byte("API_PORT: \"8080\"\n"), 0600))
+
+	m := memory.New(log)
+	require.NoError(t, m.WriteKeys(ctx, "/service/production", map[string]string{"DB_PORT": "${/shared/production/DB_PORT}"}))
+	require.NoError(t, m.WriteKeys(ctx, "/shared/production", map[string]string{"DB_PORT": "5432"}))
+
+	buf := bytes.NewBuffer(nil)
+	err := DeployCommand(ctx, DeployCommandInput{Path: base, Base: base, SchemaPath: schemaPath}, nil, buf, log, m)
+	require.NoError(t, err, buf.String())
+
+	config, err := m.ReadAll(ctx, "/service/production")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"DB_PORT":  "${/shared/production/DB_PORT}",
+		"API_PORT": "${/shared/production/API_PORT}",
+	}, config)
+
+	// Resolved values are validated against the schema.
+	require.NoError(t, os.WriteFile(configPath, []byte("API_PORT: ${/shared/production/DB_HOST}\n"), 0600))
+	require.NoError(t, m.WriteKeys(ctx, "/shared/production", map[string]string{"DB_HOST": "db"}))
+	err = DeployCommand(ctx, DeployCommandInput{Path: base, Base: base, SchemaPath: schemaPath}, nil, buf, log, m)
+	require.ErrorIs(t, err, ErrSchemaViolation)
+}
@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"github.com/micvbang/confman-go/pkg/storage/backend"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// addKeyProviderFlags adds flags configuring a key provider to app or a
+// command, with flag names and environment variables starting with
+// flagPrefix and envPrefix. The key provider flag is required if defaultType
+// is empty.
+func addKeyProviderFlags(flag func(name string, help string) *kingpin.FlagClause, flagPrefix string, envPrefix string, defaultType string, kp *backend.KeyProviderConfig) {
+	typeFlag := flag(flagPrefix, "Key provider wrapping the data keys that encrypt values. Values that are not encrypted, e.g. values written before encryption was enabled, can't be read until they are encrypted using \"rekey\"").
+		Envar(envPrefix)
+	if len(defaultType) > 0 {
+		typeFlag = typeFlag.Default(defaultType)
+	} else {
+		typeFlag = typeFlag.Required()
+	}
+	typeFlag.EnumVar(&kp.Type, backend.KeyProviderTypes...)
+
+	flag(flagPrefix+"-key-file", "Path of key file (used with key-file)").
+		Envar(envPrefix + "_KEY_FILE").
+		StringVar(&kp.KeyFile)
+
+	flag(flagPrefix+"-create-key-file", "Generate the key file if it doesn't exist (used with key-file)").
+		Envar(envPrefix + "_CREATE_KEY_FILE").
+		BoolVar(&kp.CreateKeyFile)
+
+	flag(flagPrefix+"-passphrase", "Passphrase, preferably given using the environment variable (used with passphrase)").
+		Envar(envPrefix + "_PASSPHRASE").
+		StringVar(&kp.Passphrase)
+
+	flag(flagPrefix+"-kms-key-id", "ID, ARN or alias of AWS KMS key (used with kms)").
+		Envar(envPrefix + "_KMS_KEY_ID").
+		StringVar(&kp.KMSKeyID)
+}
@@ -2,13 +2,16 @@ package cli
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"os/signal"
 	"runtime"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/micvbang/confman-go/pkg/confman"
 	"github.com/micvbang/confman-go/pkg/logger"
@@ -21,6 +24,27 @@ type ExecCommandInput struct {
 	Command            string
 	Args               []string
 	KeepAWSCredentials bool
+	Raw                bool
+
+	Watch         bool
+	WatchInterval time.Duration
+	RestartSignal string
+	GracePeriod   time.Duration
+
+	FilesDir string
+	Files    []string
+
+	Only    []string
+	Exclude []string
+	Prefix  string
+	Map     map[string]string
+
+	OnConflict string
+	Explain    bool
+
+	FallbackCache bool
+	CacheDir      string
+	CacheKeyFile  string
 }
 
 func ConfigureExecCommand(ctx context.Context, app *kingpin.Application, log logger.Logger) {
@@ -43,25 +67,157 @@ func ConfigureExecCommand(ctx context.Context, app *kingpin.Application, log log
 		Envar("CONFMAN_KEEP_AWS_CREDENTIALS").
 		BoolVar(&input.KeepAWSCredentials)
 
+	addFlagRaw(cmd, &input.Raw)
+
+	cmd.Flag("watch", "Keep running and restart the command when configuration changes").
+		Default("false").
+		BoolVar(&input.Watch)
+
+	cmd.Flag("watch-interval", "Interval between checking for configuration changes (used with \"--watch\")").
+		Default("5s").
+		DurationVar(&input.WatchInterval)
+
+	cmd.Flag("restart-signal", "Signal sent to the command when restarting it (used with \"--watch\")").
+		Default("SIGTERM").
+		StringVar(&input.RestartSignal)
+
+	cmd.Flag("grace-period", "Time to wait for the command to exit after sending the restart signal, before killing it (used with \"--watch\")").
+		Default("10s").
+		DurationVar(&input.GracePeriod)
+
+	cmd.Flag("only", "Only add the given keys to the environment (comma separated, can be repeated)").
+		PlaceHolder("KEY,...").
+		StringsVar(&input.Only)
+
+	cmd.Flag("exclude", "Don't add keys matching the given glob to the environment (can be repeated)").
+		PlaceHolder("GLOB").
+		StringsVar(&input.Exclude)
+
+	cmd.Flag("prefix", "Prefix added to the names of keys in the environment, except for keys renamed with \"--map\"").
+		StringVar(&input.Prefix)
+
+	cmd.Flag("map", "Rename KEY to NAME in the environment (can be repeated)").
+		PlaceHolder("KEY=NAME").
+		StringMapVar(&input.Map)
+
+	cmd.Flag("file", "Write the value of KEY to a file instead of the environment, and set KEY_FILE to its path. Given as KEY or KEY=filename").
+		PlaceHolder("KEY[=filename]").
+		StringsVar(&input.Files)
+
+	cmd.Flag("files-dir", "Directory in which to create the directory for files given with \"--file\", defaults to /dev/shm if it exists").
+		Envar("CONFMAN_FILES_DIR").
+		StringVar(&input.FilesDir)
+
+	cmd.Flag("on-conflict", "How to handle keys defined by multiple service paths or already set in the environment").
+		Default(onConflictLast).
+		Envar("CONFMAN_ON_CONFLICT").
+		EnumVar(&input.OnConflict, onConflictError, onConflictFirst, onConflictLast, onConflictKeepEnv)
+
+	cmd.Flag("explain", "Print which service path each variable comes from, without running the command").
+		Default("false").
+		BoolVar(&input.Explain)
+
+	cmd.Flag("fallback-cache", "Store an encrypted snapshot of the configuration after reading it, and use the latest snapshot when storage is unavailable").
+		Default("false").
+		Envar("CONFMAN_FALLBACK_CACHE").
+		BoolVar(&input.FallbackCache)
+
+	cmd.Flag("cache-dir", "Directory in which to store snapshots (used with \"--fallback-cache\"), defaults to confman in the user's cache directory").
+		Envar("CONFMAN_CACHE_DIR").
+		StringVar(&input.CacheDir)
+
+	cmd.Flag("cache-key-file", "Path of key encrypting snapshots, which must not be in the cache directory (used with \"--fallback-cache\"), defaults to confman/cache.key in the user's config directory").
+		Envar("CONFMAN_CACHE_KEY_FILE").
+		StringVar(&input.CacheKeyFile)
+
 	cmd.Action(func(c *kingpin.ParseContext) error {
-		app.FatalIfError(ExecCommand(ctx, input, log, GlobalFlags.Storage), "exec")
+		err := ExecCommand(ctx, input, os.Stdout, log, GlobalFlags.Storage)
+		if err != nil {
+			app.Errorf("exec: %s", err)
+			os.Exit(execExitCode(err))
+		}
 		return nil
 	})
 }
 
-func ExecCommand(ctx context.Context, input ExecCommandInput, log logger.Logger, storage storage.Storage) error {
-	config := make(map[string]string)
+func ExecCommand(ctx context.Context, input ExecCommandInput, w io.Writer, log logger.Logger, storage storage.Storage) error {
+	transform, err := newKeyTransform(input.Only, input.Exclude, input.Prefix, input.Map)
+	if err != nil {
+		return err
+	}
 
-	for _, servicePath := range confman.ParseServicePaths(input.ServicePaths) {
-		cm := confman.New(log, storage, servicePath)
-		curConfig, err := cm.ReadAll(ctx)
+	if input.Explain {
+		vars, _, err := execVars(ctx, input, log, storage, transform)
+		if err != nil {
+			return err
+		}
+
+		return outputExplanation(w, vars)
+	}
+
+	files, err := newExecFiles(log, input.FilesDir, input.Files)
+	if err != nil {
+		return err
+	}
+
+	env, err := execEnvironment(ctx, input, log, storage, transform, files)
+	if err != nil {
+		files.Remove()
+		return err
+	}
+
+	// Files must be removed when the command exits, so confman can't replace
+	// itself with the command.
+	if !input.Watch && files == nil {
+		return execSyscall(input.Command, input.Args, env)
+	}
+
+	var exitStatus int
+	if input.Watch {
+		exitStatus, err = execWatch(ctx, input, log, storage, transform, files, env)
+	} else {
+		exitStatus, err = runCmd(input.Command, input.Args, env)
+	}
+
+	removeErr := files.Remove()
+	if removeErr != nil {
+		log.Errorf("Failed to remove files: %s", removeErr)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	os.Exit(exitStatus)
+	return nil
+}
+
+// execVars reads the configuration of the service paths in input, selects
+// and renames keys using transform, and merges it with the existing
+// environment according to input.OnConflict. It returns the resulting
+// variables along with the existing environment.
+func execVars(ctx context.Context, input ExecCommandInput, log logger.Logger, storage storage.Storage, transform *keyTransform) (map[string]*execVar, environ, error) {
+	var cache *configCache
+	if input.FallbackCache {
+		var err error
+		cache, err = newConfigCache(input.CacheDir, input.CacheKeyFile)
 		if err != nil {
-			return nil
+			return nil, nil, err
 		}
+	}
 
-		for key, value := range curConfig {
-			config[key] = value
+	sources := []configSource{}
+	for _, servicePath := range confman.ParseServicePaths(input.ServicePaths) {
+		cm := newConfman(log, storage, servicePath, input.Raw)
+		config, err := readConfig(ctx, log, cm, input.Raw, cache)
+		if err != nil {
+			return nil, nil, err
 		}
+
+		sources = append(sources, configSource{
+			servicePath: cm.ServicePath(),
+			config:      config,
+		})
 	}
 
 	env := environ(os.Environ())
@@ -84,14 +240,80 @@ func ExecCommand(ctx context.Context, input ExecCommandInput, log logger.Logger,
 		}
 	}
 
-	for key, value := range config {
-		overwritten := env.Set(key, value)
-		if overwritten {
-			log.Warnf("warning: overwriting var %s\n", key)
+	vars, err := mergeConfigs(log, sources, transform, env, input.OnConflict)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return vars, env, nil
+}
+
+// readConfig reads the configuration of cm. Failing to read from storage is
+// returned as an execError with exit code exitStorageFailure. If cache is
+// non-nil, a snapshot is stored after reading successfully, and the latest
+// snapshot is returned when reading fails.
+func readConfig(ctx context.Context, log logger.Logger, cm confman.Confman, raw bool, cache *configCache) (map[string]string, error) {
+	config, err := cm.ReadAll(ctx)
+	if err != nil {
+		if errors.Is(err, confman.ErrReferenceNotFound) || errors.Is(err, confman.ErrReferenceCycle) || errors.Is(err, confman.ErrReferenceInvalid) {
+			return nil, err
 		}
+
+		err = &execError{
+			exitCode: exitStorageFailure,
+			err:      fmt.Errorf("reading %s: %w", cm.ServicePath(), err),
+		}
+		if cache == nil {
+			return nil, err
+		}
+
+		snapshot, cacheErr := cache.Read(cm.ServicePath(), raw)
+		if cacheErr != nil {
+			log.Errorf("Failed to read fallback cache: %s", cacheErr)
+			return nil, err
+		}
+
+		log.Warnf("%s, using cached configuration from %s", err, snapshot.CreatedAt.Local().Format(time.RFC3339))
+		return snapshot.Config, nil
 	}
 
-	return execSyscall(input.Command, input.Args, env)
+	if cache != nil {
+		err = cache.Write(cm.ServicePath(), raw, config)
+		if err != nil {
+			log.Errorf("Failed to update fallback cache for %s: %s", cm.ServicePath(), err)
+		}
+	}
+
+	return config, nil
+}
+
+// execEnvironment returns the environment of the current process populated
+// with the configuration of the service paths in input, as described by
+// execVars. Keys selected by files (using their names in the environment)
+// are written to files instead.
+func execEnvironment(ctx context.Context, input ExecCommandInput, log logger.Logger, storage storage.Storage, transform *keyTransform, files *execFiles) (environ, error) {
+	vars, env, err := execVars(ctx, input, log, storage, transform)
+	if err != nil {
+		return nil, err
+	}
+
+	config := make(map[string]string, len(vars))
+	for name, v := range vars {
+		if v.Source != sourceEnvironment {
+			config[name] = v.value
+		}
+	}
+
+	config, err = files.Write(config)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range config {
+		env.Set(key, value)
+	}
+
+	return env, nil
 }
 
 // environ is a slice of strings representing the environment, in the form "key=value".
@@ -129,35 +351,61 @@ func supportsExecSyscall() bool {
 	return runtime.GOOS == "linux" || runtime.GOOS == "darwin" || runtime.GOOS == "freebsd"
 }
 
-func execCmd(command string, args []string, env []string) error {
+func newCmd(command string, args []string, env []string) *exec.Cmd {
 	cmd := exec.Command(command, args...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.Env = env
+	return cmd
+}
+
+func execCmd(command string, args []string, env []string) error {
+	exitStatus, err := runCmd(command, args, env)
+	if err != nil {
+		return err
+	}
+
+	os.Exit(exitStatus)
+	return nil
+}
+
+// runCmd runs the command as a child process, forwarding signals to it, and
+// returns its exit status once it exits, or 128+N if it was killed by signal
+// N.
+func runCmd(command string, args []string, env []string) (int, error) {
+	cmd := newCmd(command, args, env)
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan)
+	defer signal.Stop(sigChan)
 
 	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("Failed to start command: %v", err)
+		return 0, startError(command, err)
 	}
 
+	done := make(chan struct{})
+	defer close(done)
 	go func() {
 		for {
-			sig := <-sigChan
-			cmd.Process.Signal(sig)
+			select {
+			case sig := <-sigChan:
+				cmd.Process.Signal(sig)
+			case <-done:
+				return
+			}
 		}
 	}()
 
 	if err := cmd.Wait(); err != nil {
-		cmd.Process.Signal(os.Kill)
-		return fmt.Errorf("Failed to wait for command termination: %v", err)
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			cmd.Process.Signal(os.Kill)
+			return 0, fmt.Errorf("Failed to wait for command termination: %v", err)
+		}
 	}
 
-	waitStatus := cmd.ProcessState.Sys().(syscall.WaitStatus)
-	os.Exit(waitStatus.ExitStatus())
-	return nil
+	return exitStatus(cmd.ProcessState), nil
 }
 
 func execSyscall(command string, args []string, env []string) error {
@@ -167,12 +415,13 @@ func execSyscall(command string, args []string, env []string) error {
 
 	argv0, err := exec.LookPath(command)
 	if err != nil {
-		return err
+		return startError(command, err)
 	}
 
 	argv := make([]string, 0, 1+len(args))
 	argv = append(argv, command)
 	argv = append(argv, args...)
 
-	return syscall.Exec(argv0, argv, env)
+	err = syscall.Exec(argv0, argv, env)
+	return startError(command, err)
 }
@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/micvbang/confman-go/pkg/encryption"
+)
+
+// cacheKeyFile is the name of the file in the "confman" directory of the
+// user's config directory holding the key used to encrypt snapshots. The key
+// is kept out of the cache directory, such that copies of the cache can't be
+// decrypted.
+const cacheKeyFile = "cache.key"
+
+// configSnapshot is the last successfully read configuration of a service
+// path.
+type configSnapshot struct {
+	ServicePath string            `json:"service_path"`
+	CreatedAt   time.Time         `json:"created_at"`
+	Config      map[string]string `json:"config"`
+}
+
+// configCache stores encrypted snapshots of configurations in a local
+// directory, such that exec can fall back to the last known good
+// configuration when storage is unavailable.
+type configCache struct {
+	dir string
+	key []byte
+}
+
+// newConfigCache returns a cache storing snapshots in dir, encrypted using
+// the key in keyFile. When dir is empty, the "confman" directory in the
+// user's cache directory is used, and when keyFile is empty, cacheKeyFile in
+// the "confman" directory in the user's config directory is used. The
+// encryption key is created on first use, and must not be in dir.
+func newConfigCache(dir string, keyFile string) (*configCache, error) {
+	if len(dir) == 0 {
+		userCacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("finding cache directory: %w", err)
+		}
+		dir = filepath.Join(userCacheDir, "confman")
+	}
+
+	if len(keyFile) == 0 {
+		userConfigDir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, fmt.Errorf("finding config directory: %w", err)
+		}
+		keyFile = filepath.Join(userConfigDir, "confman", cacheKeyFile)
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	absKeyFile, err := filepath.Abs(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if rel, err := filepath.Rel(absDir, absKeyFile); err == nil && !strings.HasPrefix(rel, "..") {
+		return nil, fmt.Errorf("cache key file %s must not be in the cache directory %s", keyFile, dir)
+	}
+
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("creating cache directory: %w", err)
+	}
+
+	key, err := encryption.LoadOrCreateKeyFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading cache key: %w", err)
+	}
+
+	return &configCache{
+		dir: dir,
+		key: key,
+	}, nil
+}
+
+// Write stores a snapshot of config read from servicePath. Resolved and raw
+// configurations are stored separately.
+func (c *configCache) Write(servicePath string, raw bool, config map[string]string) error {
+	bs, err := json.Marshal(configSnapshot{
+		ServicePath: servicePath,
+		CreatedAt:   time.Now().UTC(),
+		Config:      config,
+	})
+	if err != nil {
+		return err
+	}
+
+	ciphertext, err := encryption.EncryptWithAdditionalData(c.key, bs, snapshotID(servicePath, raw))
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(c.path(servicePath, raw), ciphertext, 0600)
+}
+
+// Read returns the latest snapshot stored for servicePath. Snapshots are
+// bound to their service path, such that snapshots of other service paths,
+// e.g. copied or renamed files, are rejected.
+func (c *configCache) Read(servicePath string, raw bool) (configSnapshot, error) {
+	snapshot := configSnapshot{}
+
+	ciphertext, err := os.ReadFile(c.path(servicePath, raw))
+	if err != nil {
+		return snapshot, fmt.Errorf("no cached configuration for %s: %w", servicePath, err)
+	}
+
+	bs, err := encryption.DecryptWithAdditionalData(c.key, ciphertext, snapshotID(servicePath, raw))
+	if err != nil {
+		return snapshot, fmt.Errorf("reading cached configuration for %s: %w", servicePath, err)
+	}
+
+	err = json.Unmarshal(bs, &snapshot)
+	return snapshot, err
+}
+
+func (c *configCache) path(servicePath string, raw bool) string {
+	sum := sha256.Sum256(snapshotID(servicePath, raw))
+
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".snapshot")
+}
+
+// snapshotID identifies the snapshot of servicePath, which is used for naming
+// the snapshot file and is authenticated along with it.
+func snapshotID(servicePath string, raw bool) []byte {
+	if raw {
+		servicePath += "\x00raw"
+	}
+	return []byte(servicePath)
+}
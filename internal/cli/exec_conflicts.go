@@ -0,0 +1,153 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/go-helpy/mapy"
+)
+
+// Policies for handling keys defined by multiple service paths, or keys
+// already defined in the environment.
+const (
+	onConflictError   = "error"
+	onConflictFirst   = "first"
+	onConflictLast    = "last"
+	onConflictKeepEnv = "keep-env"
+)
+
+// sourceEnvironment is the source of variables whose value is taken from the
+// existing environment.
+const sourceEnvironment = "environment"
+
+var ErrConflict = errors.New("variable defined multiple times")
+
+// configSource is the configuration read from a single service path, before
+// keys are selected and renamed.
+type configSource struct {
+	servicePath string
+	config      map[string]string
+}
+
+// execVar is a variable in the environment of an executed command.
+type execVar struct {
+	Name  string `json:"name"`
+	value string
+
+	// key is the name of the key that the value is from, before renaming.
+	key string
+
+	// Source is the service path that the value is from, or "environment".
+	Source string `json:"source"`
+
+	// Overridden holds the sources of values that were discarded.
+	Overridden []string `json:"overridden,omitempty"`
+}
+
+// mergeConfigs selects and renames the keys of the given sources using
+// transform, and merges them, in order, with the existing environment env.
+// Keys that end up with the same name, whether from different service paths
+// or renamed within one service path, are resolved according to onConflict:
+//
+//   - error: a name defined more than once is an error
+//   - first: the first service path defining a name wins
+//   - last: the last service path defining a name wins
+//   - keep-env: like last, but existing environment variables win
+//
+// Within a service path, keys are merged in sorted order. With all policies
+// other than keep-env, service paths win over the existing environment.
+func mergeConfigs(log logger.Logger, sources []configSource, transform *keyTransform, env environ, onConflict string) (map[string]*execVar, error) {
+	vars := make(map[string]*execVar)
+
+	for _, source := range sources {
+		keys := mapy.Keys(source.config)
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			name, include := transform.Name(key)
+			if !include {
+				continue
+			}
+
+			value := source.config[key]
+			cur, exists := vars[name]
+			if !exists {
+				vars[name] = &execVar{Name: name, value: value, key: key, Source: source.servicePath}
+				continue
+			}
+
+			curOrigin := varOrigin(cur.Source, cur.key, name)
+			origin := varOrigin(source.servicePath, key, name)
+			switch onConflict {
+			case onConflictError:
+				return nil, fmt.Errorf("%w: %s is defined by both %s and %s", ErrConflict, name, curOrigin, origin)
+			case onConflictFirst:
+				log.Warnf("%s from %s ignored, using value from %s", name, origin, curOrigin)
+				cur.Overridden = append(cur.Overridden, source.servicePath)
+			default:
+				log.Warnf("%s from %s overwritten by value from %s", name, curOrigin, origin)
+				cur.Overridden = append(cur.Overridden, cur.Source)
+				cur.value = value
+				cur.key = key
+				cur.Source = source.servicePath
+			}
+		}
+	}
+
+	for key, cur := range vars {
+		if !env.Contains(key) {
+			continue
+		}
+
+		switch onConflict {
+		case onConflictError:
+			return nil, fmt.Errorf("%w: %s is defined by both the environment and %s", ErrConflict, key, cur.Source)
+		case onConflictKeepEnv:
+			log.Warnf("%s from %s ignored, keeping value from environment", key, cur.Source)
+			cur.Overridden = append(cur.Overridden, cur.Source)
+			cur.value = ""
+			cur.Source = sourceEnvironment
+		default:
+			log.Warnf("warning: overwriting var %s\n", key)
+			cur.Overridden = append(cur.Overridden, sourceEnvironment)
+		}
+	}
+
+	return vars, nil
+}
+
+// varOrigin describes where the value of the variable name is from, i.e.
+// the service path, along with the key if it was renamed.
+func varOrigin(servicePath string, key string, name string) string {
+	if key == name {
+		return servicePath
+	}
+	return fmt.Sprintf("%s (%s)", servicePath, key)
+}
+
+// outputExplanation writes the source of each variable to w.
+func outputExplanation(w io.Writer, vars map[string]*execVar) error {
+	tw := tabwriter.NewWriter(w, 25, 4, 2, ' ', 0)
+
+	headers := []string{"Key", "Source", "Overridden"}
+	headerUnderlining := make([]string, len(headers))
+	for i, key := range headers {
+		headerUnderlining[i] = strings.Repeat("=", len(key)+1)
+	}
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+	fmt.Fprintln(tw, strings.Join(headerUnderlining, "\t"))
+
+	names := mapy.Keys(vars)
+	sort.Strings(names)
+	for _, name := range names {
+		v := vars[name]
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", v.Name, v.Source, strings.Join(v.Overridden, ", "))
+	}
+
+	return tw.Flush()
+}
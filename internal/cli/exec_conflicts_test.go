@@ -0,0 +1,169 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMergeConfigs verifies that keys defined by multiple service paths or
+// already existing in the environment are resolved according to the given
+// conflict policy.
+func TestMergeConfigs(t *testing.T) {
+	log := logger.LogrusWrapper{Logger: logrus.New()}
+
+	sources := []configSource{
+		{servicePath: "/shared/production", config: map[string]string{"DB_HOST": "shared", "LOG_LEVEL": "info"}},
+		{servicePath: "/service/production", config: map[string]string{"DB_HOST": "service", "DB_USER": "user"}},
+	}
+	env := environ{"LOG_LEVEL=debug", "HOME=/home/user"}
+
+	tests := map[string]struct {
+		onConflict string
+		expected   map[string]execVar
+		err        error
+	}{
+		"error": {
+			onConflict: onConflictError,
+			err:        ErrConflict,
+		},
+		"first": {
+			onConflict: onConflictFirst,
+			expected: map[string]execVar{
+				"DB_HOST":   {Name: "DB_HOST", key: "DB_HOST", value: "shared", Source: "/shared/production", Overridden: []string{"/service/production"}},
+				"DB_USER":   {Name: "DB_USER", key: "DB_USER", value: "user", Source: "/service/production"},
+				"LOG_LEVEL": {Name: "LOG_LEVEL", key: "LOG_LEVEL", value: "info", Source: "/shared/production", Overridden: []string{sourceEnvironment}},
+			},
+		},
+		"last": {
+			onConflict: onConflictLast,
+			expected: map[string]execVar{
+				"DB_HOST":   {Name: "DB_HOST", key: "DB_HOST", value: "service", Source: "/service/production", Overridden: []string{"/shared/production"}},
+				"DB_USER":   {Name: "DB_USER", key: "DB_USER", value: "user", Source: "/service/production"},
+				"LOG_LEVEL": {Name: "LOG_LEVEL", key: "LOG_LEVEL", value: "info", Source: "/shared/production", Overridden: []string{sourceEnvironment}},
+			},
+		},
+		"keep-env": {
+			onConflict: onConflictKeepEnv,
+			expected: map[string]execVar{
+				"DB_HOST":   {Name: "DB_HOST", key: "DB_HOST", value: "service", Source: "/service/production", Overridden: []string{"/shared/production"}},
+				"DB_USER":   {Name: "DB_USER", key: "DB_USER", value: "user", Source: "/service/production"},
+				"LOG_LEVEL": {Name: "LOG_LEVEL", key: "LOG_LEVEL", Source: sourceEnvironment, Overridden: []string{"/shared/production"}},
+			},
+		},
+	}
+
+	transform, err := newKeyTransform(nil, nil, "", nil)
+	require.NoError(t, err)
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			vars, err := mergeConfigs(log, sources, transform, env, test.onConflict)
+			require.ErrorIs(t, err, test.err)
+			if test.err != nil {
+				return
+			}
+
+			require.Equal(t, len(test.expected), len(vars))
+			for name, expected := range test.expected {
+				require.Equal(t, expected, *vars[name])
+			}
+		})
+	}
+}
+
+// TestMergeConfigsEnvironmentConflictError verifies that a key which already
+// exists in the environment is an error with the error policy, even when it
+// is defined by a single service path.
+func TestMergeConfigsEnvironmentConflictError(t *testing.T) {
+	log := logger.LogrusWrapper{Logger: logrus.New()}
+
+	sources := []configSource{
+		{servicePath: "/service/production", config: map[string]string{"HOME": "/root"}},
+	}
+
+	transform, err := newKeyTransform(nil, nil, "", nil)
+	require.NoError(t, err)
+
+	_, err = mergeConfigs(log, sources, transform, environ{"HOME=/home/user"}, onConflictError)
+	require.ErrorIs(t, err, ErrConflict)
+}
+
+// TestMergeConfigsTransformConflict verifies that keys renamed to the same
+// name within a single service path are resolved according to the given
+// conflict policy, independently of map iteration order.
+func TestMergeConfigsTransformConflict(t *testing.T) {
+	log := logger.LogrusWrapper{Logger: logrus.New()}
+
+	sources := []configSource{
+		{servicePath: "/service/production", config: map[string]string{"DB_HOST": "db", "PGHOST": "pg", "APP_PORT": "80", "PORT": "8080"}},
+	}
+
+	tests := map[string]struct {
+		prefix     string
+		mapping    map[string]string
+		onConflict string
+		expected   execVar
+		err        error
+	}{
+		"map to existing key, error": {
+			mapping:    map[string]string{"DB_HOST": "PGHOST"},
+			onConflict: onConflictError,
+			err:        ErrConflict,
+		},
+		"map to existing key, first": {
+			mapping:    map[string]string{"DB_HOST": "PGHOST"},
+			onConflict: onConflictFirst,
+			expected:   execVar{Name: "PGHOST", key: "DB_HOST", value: "db", Source: "/service/production", Overridden: []string{"/service/production"}},
+		},
+		"map to same name, last": {
+			mapping:    map[string]string{"DB_HOST": "HOST", "PGHOST": "HOST"},
+			onConflict: onConflictLast,
+			expected:   execVar{Name: "HOST", key: "PGHOST", value: "pg", Source: "/service/production", Overridden: []string{"/service/production"}},
+		},
+		"map to prefixed name, error": {
+			prefix:     "APP_",
+			mapping:    map[string]string{"APP_PORT": "APP_PORT"},
+			onConflict: onConflictError,
+			err:        ErrConflict,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			transform, err := newKeyTransform(nil, nil, test.prefix, test.mapping)
+			require.NoError(t, err)
+
+			for i := 0; i < 10; i++ {
+				vars, err := mergeConfigs(log, sources, transform, environ{}, test.onConflict)
+				require.ErrorIs(t, err, test.err)
+				if test.err != nil {
+					continue
+				}
+
+				require.Equal(t, test.expected, *vars[test.expected.Name])
+			}
+		})
+	}
+}
+
+// TestOutputExplanation verifies that the explanation includes the source of
+// every variable, but none of the values.
+func TestOutputExplanation(t *testing.T) {
+	vars := map[string]*execVar{
+		"DB_PASSWORD": {Name: "DB_PASSWORD", value: "secret-password", Source: "/service/production", Overridden: []string{"/shared/production"}},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	err := outputExplanation(buf, vars)
+	require.NoError(t, err)
+
+	output := buf.String()
+	require.Contains(t, output, "DB_PASSWORD")
+	require.Contains(t, output, "/service/production")
+	require.Contains(t, output, "/shared/production")
+	require.NotContains(t, output, "secret-password")
+}
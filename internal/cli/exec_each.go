@@ -0,0 +1,311 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/micvbang/confman-go/pkg/confman"
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/storage"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var ErrCommandFailed = errors.New("command failed")
+
+type ExecEachCommandInput struct {
+	ServicePaths       string
+	Command            string
+	Args               []string
+	KeepAWSCredentials bool
+	Raw                bool
+	Parallel           bool
+	FailFast           bool
+}
+
+func ConfigureExecEachCommand(ctx context.Context, app *kingpin.Application, log logger.Logger) {
+	input := ExecEachCommandInput{}
+
+	cmd := app.Command("exec-each", "Runs a command once for each of the given configurations, e.g. /service/development+staging")
+	cmd.Arg("service", "Name of the service(s)").
+		Required().
+		StringVar(&input.ServicePaths)
+
+	cmd.Arg("cmd", "Command to execute").
+		Required().
+		StringVar(&input.Command)
+
+	cmd.Arg("args", "Command arguments").
+		StringsVar(&input.Args)
+
+	cmd.Flag("aws-credentials", "Whether to keep AWS credentials in environment of executed command").
+		Default("true").
+		Envar("CONFMAN_KEEP_AWS_CREDENTIALS").
+		BoolVar(&input.KeepAWSCredentials)
+
+	addFlagRaw(cmd, &input.Raw)
+
+	cmd.Flag("parallel", "Run the command for all service paths at the same time").
+		Default("false").
+		BoolVar(&input.Parallel)
+
+	cmd.Flag("fail-fast", "Don't run the command for the remaining service paths after it fails (ignored with \"--parallel\")").
+		Default("false").
+		BoolVar(&input.FailFast)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		app.FatalIfError(ExecEachCommand(ctx, input, os.Stdout, log, GlobalFlags.Storage), "exec-each")
+		return nil
+	})
+}
+
+// execEachResult is the result of running the command for a single service
+// path.
+type execEachResult struct {
+	servicePath string
+
+	// name identifies the service path in output, see execEachNames.
+	name string
+
+	// exitCode follows the exit codes of exec, e.g. exitStorageFailure if
+	// the configuration couldn't be read and exitNotFound if the command
+	// doesn't exist.
+	exitCode int
+	err      error
+	skipped  bool
+}
+
+// ExecEachCommand runs the command once for each service path in
+// input.ServicePaths, with the configuration of that service path added to
+// its environment. Each line of output of the commands is prefixed by the
+// shortest suffix of the service path that is unique among the service paths,
+// e.g. the environment. Once all commands have exited, a summary of their
+// exit codes is written to w.
+func ExecEachCommand(ctx context.Context, input ExecEachCommandInput, w io.Writer, log logger.Logger, storage storage.Storage) error {
+	servicePaths := confman.ParseServicePaths(input.ServicePaths)
+
+	names := execEachNames(servicePaths)
+	results := make([]execEachResult, len(servicePaths))
+	prefixWidth := 0
+	for i, servicePath := range servicePaths {
+		results[i] = execEachResult{
+			servicePath: servicePath,
+			name:        names[i],
+			skipped:     true,
+		}
+
+		if len(names[i]) > prefixWidth {
+			prefixWidth = len(names[i])
+		}
+	}
+
+	stdoutMu := &sync.Mutex{}
+	stderrMu := &sync.Mutex{}
+	run := func(result *execEachResult) {
+		prefix := fmt.Sprintf("[%-*s] ", prefixWidth, result.name)
+		stdout := newPrefixWriter(stdoutMu, w, prefix)
+		stderr := newPrefixWriter(stderrMu, os.Stderr, prefix)
+		defer stdout.Flush()
+		defer stderr.Flush()
+
+		result.skipped = false
+		result.exitCode, result.err = execOnce(ctx, input, log, storage, result.servicePath, stdout, stderr)
+		if result.err != nil {
+			fmt.Fprintf(stderr, "%s\n", result.err)
+		}
+	}
+
+	if input.Parallel {
+		wg := sync.WaitGroup{}
+		for i := range results {
+			wg.Add(1)
+			go func(result *execEachResult) {
+				defer wg.Done()
+				run(result)
+			}(&results[i])
+		}
+		wg.Wait()
+	} else {
+		for i := range results {
+			run(&results[i])
+			if input.FailFast && results[i].exitCode != 0 {
+				break
+			}
+		}
+	}
+
+	err := outputExecEachSummary(w, results)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.skipped || result.exitCode != 0 {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%w for %d of %d service paths", ErrCommandFailed, failed, len(results))
+	}
+
+	return nil
+}
+
+// execEachNames returns the shortest suffix of each service path, in whole
+// segments, that no other service path ends with, e.g. the environments of
+// "/service/development+production", or "a/production" and "b/production"
+// for "/service/a/production,/service/b/production". Service paths without
+// such a suffix are named by the full service path.
+func execEachNames(servicePaths []string) []string {
+	names := make([]string, len(servicePaths))
+	for i, servicePath := range servicePaths {
+		segments := strings.Split(strings.TrimPrefix(servicePath, "/"), "/")
+		names[i] = servicePath
+
+		for n := 1; n < len(segments); n++ {
+			suffix := "/" + strings.Join(segments[len(segments)-n:], "/")
+
+			unique := true
+			for j, other := range servicePaths {
+				if j != i && other != servicePath && strings.HasSuffix(other, suffix) {
+					unique = false
+					break
+				}
+			}
+
+			if unique {
+				names[i] = suffix[1:]
+				break
+			}
+		}
+	}
+
+	return names
+}
+
+// execOnce runs the command with the configuration of servicePath added to
+// its environment and returns its exit status, or the exit code of exec and
+// an error if the command couldn't be run.
+func execOnce(ctx context.Context, input ExecEachCommandInput, log logger.Logger, storage storage.Storage, servicePath string, stdout io.Writer, stderr io.Writer) (int, error) {
+	transform, err := newKeyTransform(nil, nil, "", nil)
+	if err != nil {
+		return exitError, err
+	}
+
+	execInput := ExecCommandInput{
+		ServicePaths:       servicePath,
+		KeepAWSCredentials: input.KeepAWSCredentials,
+		Raw:                input.Raw,
+		OnConflict:         onConflictLast,
+	}
+	env, err := execEnvironment(ctx, execInput, log, storage, transform, nil)
+	if err != nil {
+		return execExitCode(err), err
+	}
+
+	cmd := exec.CommandContext(ctx, input.Command, input.Args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.Env = env
+
+	err = cmd.Start()
+	if err != nil {
+		err = startError(input.Command, err)
+		return execExitCode(err), err
+	}
+
+	err = cmd.Wait()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return exitError, fmt.Errorf("Failed to wait for command termination: %v", err)
+		}
+	}
+
+	return exitStatus(cmd.ProcessState), nil
+}
+
+func outputExecEachSummary(w io.Writer, results []execEachResult) error {
+	tw := tabwriter.NewWriter(w, 25, 4, 2, ' ', 0)
+
+	headers := []string{"Service path", "Exit code"}
+	headerUnderlining := make([]string, len(headers))
+	for i, key := range headers {
+		headerUnderlining[i] = strings.Repeat("=", len(key)+1)
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+	fmt.Fprintln(tw, strings.Join(headerUnderlining, "\t"))
+
+	for _, result := range results {
+		exitCode := fmt.Sprint(result.exitCode)
+		if result.skipped {
+			exitCode = "skipped"
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", result.servicePath, exitCode)
+	}
+
+	return tw.Flush()
+}
+
+// prefixWriter writes each line written to it to w, prefixed by prefix.
+// Lines are only written to w once they are complete, such that lines of
+// writers sharing w and mu are not interleaved.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix []byte
+	buf    []byte
+}
+
+func newPrefixWriter(mu *sync.Mutex, w io.Writer, prefix string) *prefixWriter {
+	return &prefixWriter{
+		mu:     mu,
+		w:      w,
+		prefix: []byte(prefix),
+	}
+}
+
+func (p *prefixWriter) Write(bs []byte) (int, error) {
+	p.buf = append(p.buf, bs...)
+
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i == -1 {
+			return len(bs), nil
+		}
+
+		err := p.writeLine(p.buf[:i+1])
+		p.buf = p.buf[i+1:]
+		if err != nil {
+			return len(bs), err
+		}
+	}
+}
+
+// Flush writes any incomplete line, terminated by a newline.
+func (p *prefixWriter) Flush() error {
+	if len(p.buf) == 0 {
+		return nil
+	}
+
+	line := append(p.buf, '\n')
+	p.buf = nil
+	return p.writeLine(line)
+}
+
+func (p *prefixWriter) writeLine(line []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, err := p.w.Write(append(append([]byte{}, p.prefix...), line...))
+	return err
+}
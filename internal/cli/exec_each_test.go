@@ -0,0 +1,146 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/micvbang/confman-go/pkg/confman"
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/storage/memory"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// TestExecEachCommand verifies that ExecEachCommand runs the command once
+// for each environment, sequentially and in parallel, with the configuration
+// of the environment, that output is prefixed by the environment, and that an
+// error is returned when the command fails for any environment.
+func TestExecEachCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	ctx := context.Background()
+	log := logger.LogrusWrapper{Logger: logrus.New()}
+	confman.ChamberCompatible = false
+
+	m := memory.New(log)
+	for _, environment := range []string{"development", "staging", "production"} {
+		err := m.WriteKeys(ctx, "/service/"+environment, map[string]string{"ENVIRONMENT": environment})
+		require.NoError(t, err)
+	}
+
+	for _, parallel := range []bool{false, true} {
+		input := ExecEachCommandInput{
+			ServicePaths: "/service/development+staging+production",
+			Command:      "sh",
+			Args:         []string{"-c", `echo "running in $ENVIRONMENT"; test $ENVIRONMENT != staging`},
+			Raw:          true,
+			Parallel:     parallel,
+		}
+
+		output := bytes.NewBuffer(nil)
+		err := ExecEachCommand(ctx, input, output, log, m)
+		require.ErrorIs(t, err, ErrCommandFailed)
+
+		for _, expected := range []string{
+			"[development] running in development\n",
+			"[staging    ] running in staging\n",
+			"[production ] running in production\n",
+		} {
+			require.Contains(t, output.String(), expected)
+		}
+
+		lines := strings.Split(output.String(), "\n")
+		require.Contains(t, lines, "/service/development     0")
+		require.Contains(t, lines, "/service/staging         1")
+		require.Contains(t, lines, "/service/production      0")
+	}
+}
+
+// TestExecEachCommandFailFast verifies that the command is not run for the
+// remaining service paths after failing when FailFast is set.
+func TestExecEachCommandFailFast(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	ctx := context.Background()
+	log := logger.LogrusWrapper{Logger: logrus.New()}
+	confman.ChamberCompatible = false
+
+	input := ExecEachCommandInput{
+		ServicePaths: "/service/development+staging",
+		Command:      "sh",
+		Args:         []string{"-c", "exit 3"},
+		Raw:          true,
+		FailFast:     true,
+	}
+
+	output := bytes.NewBuffer(nil)
+	err := ExecEachCommand(ctx, input, output, log, memory.New(log))
+	require.ErrorIs(t, err, ErrCommandFailed)
+
+	lines := strings.Split(output.String(), "\n")
+	require.Contains(t, lines, "/service/development     3")
+	require.Contains(t, lines, "/service/staging         skipped")
+}
+
+// TestExecEachNames verifies that service paths are named by their shortest
+// unique suffix, such that environments of different services can be told
+// apart.
+func TestExecEachNames(t *testing.T) {
+	tests := map[string]struct {
+		servicePaths []string
+		expected     []string
+	}{
+		"environments": {
+			servicePaths: []string{"/service/development", "/service/production"},
+			expected:     []string{"development", "production"},
+		},
+		"same environment": {
+			servicePaths: []string{"/email/runtime/production", "/billing/runtime/production", "/billing/runtime/staging"},
+			expected:     []string{"/email/runtime/production", "/billing/runtime/production", "staging"},
+		},
+		"same service and environment": {
+			servicePaths: []string{"/email/a/runtime/production", "/email/b/runtime/production"},
+			expected:     []string{"a/runtime/production", "b/runtime/production"},
+		},
+		"suffix of other": {
+			servicePaths: []string{"/production", "/service/production"},
+			expected:     []string{"/production", "/service/production"},
+		},
+		"duplicate": {
+			servicePaths: []string{"/service/production", "/service/production"},
+			expected:     []string{"production", "production"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, test.expected, execEachNames(test.servicePaths))
+		})
+	}
+}
+
+// TestPrefixWriter verifies that complete lines are prefixed, and that
+// incomplete lines are only written when flushed.
+func TestPrefixWriter(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := newPrefixWriter(&sync.Mutex{}, buf, "[dev] ")
+
+	_, err := w.Write([]byte("first\nsec"))
+	require.NoError(t, err)
+	require.Equal(t, "[dev] first\n", buf.String())
+
+	_, err = w.Write([]byte("ond\nthird"))
+	require.NoError(t, err)
+	require.Equal(t, "[dev] first\n[dev] second\n", buf.String())
+
+	require.NoError(t, w.Flush())
+	require.Equal(t, "[dev] first\n[dev] second\n[dev] third\n", buf.String())
+}
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// Exit codes of exec when the command could not be run, following the
+// conventions of shells and "env". When the command runs, exec exits with the
+// exit status of the command, or 128+N if it was killed by signal N. All
+// other errors exit with exitError.
+const (
+	exitError          = 1
+	exitStorageFailure = 125
+	exitCannotExecute  = 126
+	exitNotFound       = 127
+	exitSignalBase     = 128
+)
+
+// execError is an error that makes exec exit with the given exit code.
+type execError struct {
+	exitCode int
+	err      error
+}
+
+func (e *execError) Error() string {
+	return e.err.Error()
+}
+
+func (e *execError) Unwrap() error {
+	return e.err
+}
+
+// execExitCode returns the exit code that exec must exit with when failing
+// with err.
+func execExitCode(err error) int {
+	var execErr *execError
+	if errors.As(err, &execErr) {
+		return execErr.exitCode
+	}
+
+	return exitError
+}
+
+// startError returns an execError with the exit code matching the error
+// returned when failing to start command.
+func startError(command string, err error) error {
+	exitCode := exitCannotExecute
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+		exitCode = exitNotFound
+	}
+
+	return &execError{
+		exitCode: exitCode,
+		err:      fmt.Errorf("Failed to start command %s: %w", command, err),
+	}
+}
+
+// exitStatus returns the exit status of an exited process, or 128+N if it
+// was killed by signal N.
+func exitStatus(state *os.ProcessState) int {
+	waitStatus := state.Sys().(syscall.WaitStatus)
+	if waitStatus.Signaled() {
+		return exitSignalBase + int(waitStatus.Signal())
+	}
+
+	return waitStatus.ExitStatus()
+}
@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/micvbang/confman-go/pkg/confman"
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/storage"
+	"github.com/micvbang/confman-go/pkg/storage/memory"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRunCmdExitStatus verifies that runCmd returns the exit status of the
+// command, 128+N when the command is killed by signal N, and errors with exit
+// codes 127 and 126 when the command is not found or can't be executed.
+func TestRunCmdExitStatus(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	notExecutable := filepath.Join(t.TempDir(), "not-executable")
+	require.NoError(t, os.WriteFile(notExecutable, []byte("#!/bin/sh\n"), 0600))
+
+	tests := map[string]struct {
+		command          string
+		args             []string
+		expectedStatus   int
+		expectedExitCode int
+	}{
+		"success":        {command: "sh", args: []string{"-c", "exit 0"}, expectedStatus: 0},
+		"failure":        {command: "sh", args: []string{"-c", "exit 3"}, expectedStatus: 3},
+		"signal":         {command: "sh", args: []string{"-c", "kill -TERM $$"}, expectedStatus: 143},
+		"not found":      {command: "confman-does-not-exist", expectedExitCode: exitNotFound},
+		"not executable": {command: notExecutable, expectedExitCode: exitCannotExecute},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			status, err := runCmd(test.command, test.args, os.Environ())
+			if test.expectedExitCode != 0 {
+				require.Error(t, err)
+				require.Equal(t, test.expectedExitCode, execExitCode(err))
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, test.expectedStatus, status)
+		})
+	}
+}
+
+// TestExecCommandStorageFailure verifies that ExecCommand returns an error
+// with exit code 125 when reading from storage fails, and that other errors
+// have exit code 1.
+func TestExecCommandStorageFailure(t *testing.T) {
+	ctx := context.Background()
+	log := logger.LogrusWrapper{Logger: logrus.New()}
+	confman.ChamberCompatible = false
+
+	expectedErr := errors.New("connection refused")
+	s := &storage.MockStorage{}
+	s.On("ReadAll", ctx, mock.Anything).Return(nil, expectedErr)
+
+	input := ExecCommandInput{
+		ServicePaths: "/service/env",
+		Command:      "true",
+		Raw:          true,
+		OnConflict:   onConflictLast,
+	}
+
+	err := ExecCommand(ctx, input, bytes.NewBuffer(nil), log, s)
+	require.ErrorIs(t, err, expectedErr)
+	require.Equal(t, exitStorageFailure, execExitCode(err))
+
+	input.Exclude = []string{"["}
+	err = ExecCommand(ctx, input, bytes.NewBuffer(nil), log, s)
+	require.Error(t, err)
+	require.Equal(t, exitError, execExitCode(err))
+}
+
+// TestExecCommandFallbackCache verifies that, when using the fallback cache,
+// the latest successfully read configuration is used when reading from
+// storage fails, and that snapshots are encrypted.
+func TestExecCommandFallbackCache(t *testing.T) {
+	ctx := context.Background()
+	log := logger.LogrusWrapper{Logger: logrus.New()}
+	confman.ChamberCompatible = false
+	cacheDir := t.TempDir()
+
+	input := ExecCommandInput{
+		ServicePaths:  "/service/env",
+		Command:       "true",
+		OnConflict:    onConflictLast,
+		Explain:       true,
+		FallbackCache: true,
+		CacheDir:      cacheDir,
+		CacheKeyFile:  filepath.Join(t.TempDir(), "cache.key"),
+	}
+
+	m := memory.New(log)
+	require.NoError(t, m.WriteKeys(ctx, "/service/env", map[string]string{"DB_PASSWORD": "secret-password"}))
+
+	err := ExecCommand(ctx, input, bytes.NewBuffer(nil), log, m)
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(cacheDir)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(entries))
+	for _, entry := range entries {
+		bs, err := os.ReadFile(filepath.Join(cacheDir, entry.Name()))
+		require.NoError(t, err)
+		require.NotContains(t, string(bs), "secret-password")
+	}
+
+	s := &storage.MockStorage{}
+	s.On("ReadAll", ctx, mock.Anything).Return(nil, errors.New("connection refused"))
+
+	output := bytes.NewBuffer(nil)
+	err = ExecCommand(ctx, input, output, log, s)
+	require.NoError(t, err)
+	require.Contains(t, output.String(), "DB_PASSWORD")
+
+	// Raw and resolved configurations are cached separately.
+	input.Raw = true
+	err = ExecCommand(ctx, input, bytes.NewBuffer(nil), log, s)
+	require.Equal(t, exitStorageFailure, execExitCode(err))
+}
+
+// TestNewConfigCacheKeyFile verifies that the key encrypting snapshots must
+// not be stored in the cache directory.
+func TestNewConfigCacheKeyFile(t *testing.T) {
+	cacheDir := t.TempDir()
+
+	_, err := newConfigCache(cacheDir, filepath.Join(cacheDir, "key"))
+	require.Error(t, err)
+
+	keyFile := filepath.Join(t.TempDir(), "cache.key")
+	_, err = newConfigCache(cacheDir, keyFile)
+	require.NoError(t, err)
+	require.FileExists(t, keyFile)
+}
+
+// TestConfigCacheRenamedSnapshot verifies that snapshots copied to the file
+// of another service path, or of the raw configuration, are rejected.
+func TestConfigCacheRenamedSnapshot(t *testing.T) {
+	cache, err := newConfigCache(t.TempDir(), filepath.Join(t.TempDir(), "cache.key"))
+	require.NoError(t, err)
+
+	require.NoError(t, cache.Write("/service/env", false, map[string]string{"DB_HOST": "db"}))
+	snapshot, err := cache.Read("/service/env", false)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"DB_HOST": "db"}, snapshot.Config)
+
+	bs, err := os.ReadFile(cache.path("/service/env", false))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(cache.path("/other/env", false), bs, 0600))
+	require.NoError(t, os.WriteFile(cache.path("/service/env", true), bs, 0600))
+
+	_, err = cache.Read("/other/env", false)
+	require.Error(t, err)
+
+	_, err = cache.Read("/service/env", true)
+	require.Error(t, err)
+}
@@ -0,0 +1,132 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/micvbang/confman-go/pkg/logger"
+)
+
+// tmpfsDir is used for files when it exists, such that values are never
+// written to disk.
+const tmpfsDir = "/dev/shm"
+
+// fileEnvSuffix is appended to the names of keys written to files to give the
+// name of the environment variable holding the path of the file.
+const fileEnvSuffix = "_FILE"
+
+// execFiles writes the values of keys to files in a private directory, such
+// that they can be given to commands without putting them in the environment.
+type execFiles struct {
+	dir       string
+	fileNames map[string]string
+}
+
+// newExecFiles creates a private directory in parentDir for the given file
+// specifications, which are either KEY or KEY=filename. When parentDir is
+// empty, /dev/shm is used if it exists, and the default temporary directory
+// otherwise. It returns nil if no file specifications are given.
+func newExecFiles(log logger.Logger, parentDir string, fileSpecs []string) (*execFiles, error) {
+	if len(fileSpecs) == 0 {
+		return nil, nil
+	}
+
+	fileNames := make(map[string]string, len(fileSpecs))
+	for _, fileSpec := range fileSpecs {
+		key, fileName := fileSpec, fileSpec
+		if i := strings.Index(fileSpec, "="); i != -1 {
+			key, fileName = fileSpec[:i], fileSpec[i+1:]
+		}
+
+		if len(key) == 0 || len(fileName) == 0 || fileName != filepath.Base(fileName) || fileName == ".." {
+			return nil, fmt.Errorf("invalid file '%s', expected KEY or KEY=filename", fileSpec)
+		}
+		fileNames[key] = fileName
+	}
+
+	if len(parentDir) == 0 {
+		parentDir = os.TempDir()
+		if info, err := os.Stat(tmpfsDir); err == nil && info.IsDir() {
+			parentDir = tmpfsDir
+		} else {
+			log.Debugf("%s does not exist, writing files to %s", tmpfsDir, parentDir)
+		}
+	}
+
+	dir, err := os.MkdirTemp(parentDir, "confman-")
+	if err != nil {
+		return nil, fmt.Errorf("creating directory for files: %w", err)
+	}
+
+	return &execFiles{
+		dir:       dir,
+		fileNames: fileNames,
+	}, nil
+}
+
+// Write writes the value of each selected key to its file and returns a copy
+// of config in which each selected KEY is replaced by KEY_FILE, holding the
+// path of the file.
+func (f *execFiles) Write(config map[string]string) (map[string]string, error) {
+	if f == nil {
+		return config, nil
+	}
+
+	newConfig := make(map[string]string, len(config))
+	for key, value := range config {
+		newConfig[key] = value
+	}
+
+	for key, fileName := range f.fileNames {
+		value, exists := config[key]
+		if !exists {
+			return nil, fmt.Errorf("key '%s' given in --file does not exist", key)
+		}
+
+		filePath := filepath.Join(f.dir, fileName)
+		err := writeFileAtomic(filePath, []byte(value), 0600)
+		if err != nil {
+			return nil, err
+		}
+
+		delete(newConfig, key)
+		newConfig[key+fileEnvSuffix] = filePath
+	}
+
+	return newConfig, nil
+}
+
+// Remove removes all written files.
+func (f *execFiles) Remove() error {
+	if f == nil {
+		return nil
+	}
+
+	return os.RemoveAll(f.dir)
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory as
+// path and renames it to path, such that readers never see partial contents.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	defer os.Remove(tmpPath)
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(perm)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+
+	return os.Rename(tmpPath, path)
+}
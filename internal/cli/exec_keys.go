@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/micvbang/go-helpy/stringy"
+)
+
+// keyTransform selects and renames keys before they are added to the
+// environment of executed commands.
+type keyTransform struct {
+	only    stringy.Set
+	exclude []string
+	prefix  string
+	mapping map[string]string
+}
+
+// newKeyTransform returns a keyTransform which keeps only the keys in only
+// (comma separated, all keys if empty), removes keys matching any of the
+// globs in exclude (see path.Match), renames keys in mapping and adds prefix
+// to the names of all other keys.
+func newKeyTransform(only []string, exclude []string, prefix string, mapping map[string]string) (*keyTransform, error) {
+	for _, pattern := range exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern '%s': %w", pattern, err)
+		}
+	}
+
+	onlyKeys := []string{}
+	for _, keys := range only {
+		for _, key := range strings.Split(keys, ",") {
+			key = strings.TrimSpace(key)
+			if len(key) > 0 {
+				onlyKeys = append(onlyKeys, key)
+			}
+		}
+	}
+
+	return &keyTransform{
+		only:    stringy.ToSet(onlyKeys),
+		exclude: exclude,
+		prefix:  prefix,
+		mapping: mapping,
+	}, nil
+}
+
+// Name returns the name that key has in the environment, and whether the key
+// is included at all.
+func (t *keyTransform) Name(key string) (string, bool) {
+	if len(t.only) > 0 && !t.only.Contains(key) {
+		return "", false
+	}
+
+	for _, pattern := range t.exclude {
+		if matched, _ := path.Match(pattern, key); matched {
+			return "", false
+		}
+	}
+
+	if name, exists := t.mapping[key]; exists {
+		return name, true
+	}
+
+	return t.prefix + key, true
+}
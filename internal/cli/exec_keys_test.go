@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestKeyTransformName verifies that keys are selected, excluded and renamed
+// as expected.
+func TestKeyTransformName(t *testing.T) {
+	config := map[string]string{
+		"DB_USER":     "user",
+		"DB_PASSWORD": "password",
+		"DB_HOST":     "localhost",
+		"LOG_LEVEL":   "info",
+	}
+
+	tests := map[string]struct {
+		only     []string
+		exclude  []string
+		prefix   string
+		mapping  map[string]string
+		expected map[string]string
+	}{
+		"no transformation": {
+			expected: config,
+		},
+		"only": {
+			only:     []string{"DB_USER, DB_HOST", "LOG_LEVEL"},
+			expected: map[string]string{"DB_USER": "user", "DB_HOST": "localhost", "LOG_LEVEL": "info"},
+		},
+		"exclude": {
+			exclude:  []string{"DB_*", "NON_EXISTING"},
+			expected: map[string]string{"LOG_LEVEL": "info"},
+		},
+		"only and exclude": {
+			only:     []string{"DB_USER,DB_PASSWORD"},
+			exclude:  []string{"*PASSWORD"},
+			expected: map[string]string{"DB_USER": "user"},
+		},
+		"prefix and map": {
+			exclude: []string{"LOG_LEVEL"},
+			prefix:  "APP_",
+			mapping: map[string]string{"DB_PASSWORD": "PGPASSWORD", "DB_USER": "PGUSER"},
+			expected: map[string]string{
+				"PGUSER":      "user",
+				"PGPASSWORD":  "password",
+				"APP_DB_HOST": "localhost",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			transform, err := newKeyTransform(test.only, test.exclude, test.prefix, test.mapping)
+			require.NoError(t, err)
+
+			got := map[string]string{}
+			for key, value := range config {
+				if name, include := transform.Name(key); include {
+					got[name] = value
+				}
+			}
+			require.Equal(t, test.expected, got)
+		})
+	}
+}
+
+// TestKeyTransformInvalidExclude verifies that invalid exclude globs are
+// reported as errors.
+func TestKeyTransformInvalidExclude(t *testing.T) {
+	_, err := newKeyTransform(nil, []string{"DB_["}, "", nil)
+	require.Error(t, err)
+}
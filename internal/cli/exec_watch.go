@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"os/signal"
+	"time"
+
+	"github.com/micvbang/confman-go/pkg/confman/client"
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/storage"
+)
+
+// execWatch runs the command as a child process and restarts it whenever the
+// configuration of the service paths changes. Signals are forwarded to the
+// child. The exit status of the child is returned when the child exits by
+// itself.
+func execWatch(ctx context.Context, input ExecCommandInput, log logger.Logger, storage storage.Storage, transform *keyTransform, files *execFiles, env environ) (int, error) {
+	restartSignal, err := parseSignal(input.RestartSignal)
+	if err != nil {
+		return 0, err
+	}
+
+	watcher, err := client.New(log, storage, input.ServicePaths).NewWatcher(input.WatchInterval)
+	if err != nil {
+		return 0, err
+	}
+	watcher.Raw = input.Raw
+	changes := watcher.Changes(ctx)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan)
+	defer signal.Stop(sigChan)
+
+	for {
+		cmd := newCmd(input.Command, input.Args, env)
+		if err := cmd.Start(); err != nil {
+			return 0, startError(input.Command, err)
+		}
+
+		exited := make(chan error, 1)
+		go func() {
+			exited <- cmd.Wait()
+		}()
+
+		restart := false
+		for !restart {
+			select {
+			case sig := <-sigChan:
+				cmd.Process.Signal(sig)
+
+			case <-exited:
+				return exitStatus(cmd.ProcessState), nil
+
+			case cs, ok := <-changes:
+				if !ok {
+					// Watcher stopped, i.e. ctx was cancelled or reading
+					// the initial configuration failed. Keep supervising
+					// the current child without watching.
+					changes = nil
+					continue
+				}
+
+				cs = selectChanges(transform, cs)
+				if len(cs) == 0 {
+					log.Debugf("Configuration changed, but no selected keys")
+					continue
+				}
+
+				for _, change := range cs {
+					log.Infof("%s %s/%s", change.Type, change.ServicePath, change.Key)
+				}
+
+				newEnv, err := execEnvironment(ctx, input, log, storage, transform, files)
+				if err != nil {
+					log.Errorf("Failed to read configuration, not restarting: %s", err)
+					continue
+				}
+
+				log.Warnf("Configuration changed, restarting %s", input.Command)
+				stopCmd(log, cmd, exited, restartSignal, input.GracePeriod)
+				env = newEnv
+				restart = true
+			}
+		}
+	}
+}
+
+// selectChanges returns the changes of keys that transform includes in the
+// environment, i.e. keys selected by "--only" and "--exclude".
+func selectChanges(transform *keyTransform, changes []client.Change) []client.Change {
+	selected := make([]client.Change, 0, len(changes))
+	for _, change := range changes {
+		if _, include := transform.Name(change.Key); include {
+			selected = append(selected, change)
+		}
+	}
+
+	return selected
+}
+
+// stopCmd sends sig to cmd and waits for it to exit. If cmd has not exited
+// after gracePeriod, it is killed.
+func stopCmd(log logger.Logger, cmd *exec.Cmd, exited <-chan error, sig os.Signal, gracePeriod time.Duration) {
+	err := cmd.Process.Signal(sig)
+	if err != nil {
+		log.Debugf("Failed to send %s to command: %s", sig, err)
+	}
+
+	select {
+	case <-exited:
+		return
+	case <-time.After(gracePeriod):
+	}
+
+	log.Warnf("Command did not exit within %s, killing it", gracePeriod)
+	cmd.Process.Kill()
+	<-exited
+}
@@ -0,0 +1,24 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/micvbang/confman-go/pkg/confman/client"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSelectChanges verifies that only changes of keys selected by "--only"
+// and "--exclude" cause a restart, also when they are renamed.
+func TestSelectChanges(t *testing.T) {
+	transform, err := newKeyTransform([]string{"DB_USER,DB_PASSWORD"}, []string{"*PASSWORD"}, "APP_", map[string]string{"DB_USER": "USER"})
+	require.NoError(t, err)
+
+	changes := []client.Change{
+		{ServicePath: "/service/env", Key: "DB_USER", Type: client.ChangeUpdated},
+		{ServicePath: "/service/env", Key: "DB_PASSWORD", Type: client.ChangeUpdated},
+		{ServicePath: "/service/env", Key: "LOG_LEVEL", Type: client.ChangeAdded},
+	}
+
+	require.Equal(t, changes[:1], selectChanges(transform, changes))
+	require.Empty(t, selectChanges(transform, changes[1:]))
+}
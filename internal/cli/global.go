@@ -11,26 +11,44 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
-	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/micvbang/confman-go/pkg/confman"
 	"github.com/micvbang/confman-go/pkg/logger"
 	"github.com/micvbang/confman-go/pkg/storage"
-	"github.com/micvbang/confman-go/pkg/storage/parameterstore"
+	"github.com/micvbang/confman-go/pkg/storage/backend"
+	"github.com/micvbang/confman-go/pkg/storage/git"
+	"github.com/micvbang/confman-go/pkg/storage/sqlite"
+	"github.com/micvbang/confman-go/pkg/storage/vault"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/alecthomas/kingpin.v2"
 	"gopkg.in/ini.v1"
 )
 
 var GlobalFlags struct {
-	Debug bool
+	Debug    bool
+	LogLevel string
 
 	// TODO: only do for storage backends that need it
 	AWSRegion         string
 	KMSKeyAlias       string
+	KMSKeyRules       []string
+	KMSKeyRulesFile   string
 	ChamberCompatible bool
 	AssumeProfile     string
 
+	StorageType string
+	RemoteURL   string
+	RemoteToken string
+
+	Vault vault.Config
+
+	SecretsManagerKMSKeyID string
+
+	Git    git.Config
+	SQLite sqlite.Config
+
+	Encryption backend.KeyProviderConfig
+
 	Storage storage.Storage
 }
 
@@ -41,11 +59,24 @@ func ConfigureGlobals(app *kingpin.Application) logger.Logger {
 	app.Flag("debug", "Show debugging output").
 		BoolVar(&GlobalFlags.Debug)
 
+	app.Flag("log-level", "Level of logs to show, e.g. info to show requests of \"serve\" (overridden by \"--debug\")").
+		Default("warn").
+		Envar("CONFMAN_LOG_LEVEL").
+		EnumVar(&GlobalFlags.LogLevel, "error", "warn", "info", "debug")
+
 	app.Flag("aws-kms-key-alias", "KMS key alias used for config en/decryption").
-		Default("parameter_store_key").
+		Default(backend.DefaultKMSKeyAlias).
 		Envar("CONFMAN_KMS_KEY_ALIAS").
 		StringVar(&GlobalFlags.KMSKeyAlias)
 
+	app.Flag("aws-kms-key-rule", "Rule selecting the KMS key of service paths as <path>=<KMS key>, e.g. \"/payments/*=alias/payments\", first match wins (repeatable, used with \"--storage parameterstore\")").
+		Envar("CONFMAN_KMS_KEY_RULES").
+		StringsVar(&GlobalFlags.KMSKeyRules)
+
+	app.Flag("aws-kms-key-rules-file", "Path of YAML file with a list of rules selecting the KMS key of service paths, given by \"path\" and \"key\" (used with \"--storage parameterstore\")").
+		Envar("CONFMAN_KMS_KEY_RULES_FILE").
+		StringVar(&GlobalFlags.KMSKeyRulesFile)
+
 	app.Flag("chamber-compatible", "Read and write data in a way that is compatible with chamber").
 		Default("false").
 		Envar("CONFMAN_CHAMBER_COMPATIBLE").
@@ -56,7 +87,71 @@ func ConfigureGlobals(app *kingpin.Application) logger.Logger {
 		Envar("CONFMAN_ASSUME_PROFILE").
 		StringVar(&GlobalFlags.AssumeProfile)
 
-	// TODO: determine storage backend from env/flags
+	app.Flag("storage", "Storage backend to use").
+		Default(backend.ParameterStore).
+		Envar("CONFMAN_STORAGE").
+		EnumVar(&GlobalFlags.StorageType, backend.Types...)
+
+	app.Flag("remote-url", "URL of confman server (used with \"--storage remote\")").
+		Envar("CONFMAN_REMOTE_URL").
+		StringVar(&GlobalFlags.RemoteURL)
+
+	app.Flag("remote-token", "Bearer token for confman server (used with \"--storage remote\")").
+		Envar("CONFMAN_REMOTE_TOKEN").
+		StringVar(&GlobalFlags.RemoteToken)
+
+	app.Flag("vault-addr", "Address of Vault (used with \"--storage vault\")").
+		Envar("VAULT_ADDR").
+		StringVar(&GlobalFlags.Vault.Address)
+
+	app.Flag("vault-token", "Vault token (used with \"--storage vault\")").
+		Envar("VAULT_TOKEN").
+		StringVar(&GlobalFlags.Vault.Token)
+
+	app.Flag("vault-namespace", "Vault namespace (used with \"--storage vault\")").
+		Envar("VAULT_NAMESPACE").
+		StringVar(&GlobalFlags.Vault.Namespace)
+
+	app.Flag("vault-mount", "Mount path of Vault KV v2 secrets engine (used with \"--storage vault\")").
+		Default(backend.DefaultVaultMount).
+		Envar("CONFMAN_VAULT_MOUNT").
+		StringVar(&GlobalFlags.Vault.Mount)
+
+	app.Flag("vault-role-id", "Role ID for Vault AppRole login, used when no token is given (used with \"--storage vault\")").
+		Envar("CONFMAN_VAULT_ROLE_ID").
+		StringVar(&GlobalFlags.Vault.RoleID)
+
+	app.Flag("vault-secret-id", "Secret ID for Vault AppRole login (used with \"--storage vault\")").
+		Envar("CONFMAN_VAULT_SECRET_ID").
+		StringVar(&GlobalFlags.Vault.SecretID)
+
+	app.Flag("vault-approle-mount", "Mount path of Vault AppRole auth method (used with \"--storage vault\")").
+		Default(backend.DefaultVaultAppRoleMount).
+		Envar("CONFMAN_VAULT_APPROLE_MOUNT").
+		StringVar(&GlobalFlags.Vault.AppRoleMount)
+
+	app.Flag("secretsmanager-kms-key-id", "KMS key used for creating secrets, defaults to the AWS managed key (used with \"--storage secretsmanager\")").
+		Envar("CONFMAN_SECRETSMANAGER_KMS_KEY_ID").
+		StringVar(&GlobalFlags.SecretsManagerKMSKeyID)
+
+	app.Flag("git-repo", "Path of git repository, initialized if necessary (used with \"--storage git\")").
+		Envar("CONFMAN_GIT_REPO").
+		StringVar(&GlobalFlags.Git.Repository)
+
+	app.Flag("git-key-file", "Path of key for encrypting configuration, defaults to .git/confman.key in the repository (used with \"--storage git\")").
+		Envar("CONFMAN_GIT_KEY_FILE").
+		StringVar(&GlobalFlags.Git.KeyFile)
+
+	app.Flag("sqlite-path", "Path of SQLite database, created if necessary (used with \"--storage sqlite\")").
+		Envar("CONFMAN_SQLITE_PATH").
+		StringVar(&GlobalFlags.SQLite.Path)
+
+	app.Flag("sqlite-key-file", "Path of key for encrypting values, which should be kept apart from the database, generated if the database holds no configuration yet (used with \"--storage sqlite\")").
+		Envar("CONFMAN_SQLITE_KEY_FILE").
+		StringVar(&GlobalFlags.SQLite.KeyFile)
+
+	addKeyProviderFlags(app.Flag, "encryption", "CONFMAN_ENCRYPTION", backend.KeyProviderNone, &GlobalFlags.Encryption)
+
 	// TODO: determine AWS config from env/flags
 
 	app.PreAction(func(c *kingpin.ParseContext) (err error) {
@@ -69,32 +164,69 @@ func ConfigureGlobals(app *kingpin.Application) logger.Logger {
 			}
 
 			logrusLog.Level = logrus.WarnLevel
+			if len(GlobalFlags.LogLevel) > 0 {
+				logrusLog.Level, err = logrus.ParseLevel(GlobalFlags.LogLevel)
+				if err != nil {
+					return err
+				}
+			}
 		}
 
-		awsCfg, err := config.LoadDefaultConfig(context.TODO())
-		if err != nil {
-			return fmt.Errorf("failed to init aws config: %v", err)
+		confman.ChamberCompatible = GlobalFlags.ChamberCompatible
+		if c.SelectedCommand != nil {
+			GlobalFlags.Git.Command = c.SelectedCommand.FullCommand()
+			GlobalFlags.SQLite.Command = c.SelectedCommand.FullCommand()
 		}
+		GlobalFlags.Storage, err = newStorage(context.TODO(), log)
+		return err
+	})
 
-		if len(GlobalFlags.AssumeProfile) > 0 {
-			roleARN, err := getAWSProfileRoleARN(GlobalFlags.AssumeProfile)
-			if err != nil {
-				return err
-			}
-
-			stsClient := sts.NewFromConfig(awsCfg)
-			assumeRoleProvider := stscreds.NewAssumeRoleProvider(stsClient, roleARN)
-			awsCfg.Credentials = aws.NewCredentialsCache(assumeRoleProvider)
-		}
+	return log
+}
 
-		confman.ChamberCompatible = GlobalFlags.ChamberCompatible
-		ssmClient := ssm.NewFromConfig(awsCfg)
-		GlobalFlags.Storage = parameterstore.New(log, ssmClient, "parameter_store_key")
+// newStorage returns the storage backend selected by GlobalFlags, encrypting
+// values client-side if a key provider is selected.
+func newStorage(ctx context.Context, log logger.Logger) (storage.Storage, error) {
+	rules, err := backend.KMSKeyRules(GlobalFlags.KMSKeyRules, GlobalFlags.KMSKeyRulesFile)
+	if err != nil {
+		return nil, err
+	}
 
-		return nil
+	return backend.New(ctx, log, backend.Config{
+		Type:                   GlobalFlags.StorageType,
+		KMSKeyAlias:            GlobalFlags.KMSKeyAlias,
+		KMSKeyRules:            rules,
+		RemoteURL:              GlobalFlags.RemoteURL,
+		RemoteToken:            GlobalFlags.RemoteToken,
+		Vault:                  GlobalFlags.Vault,
+		SecretsManagerKMSKeyID: GlobalFlags.SecretsManagerKMSKeyID,
+		Git:                    GlobalFlags.Git,
+		SQLite:                 GlobalFlags.SQLite,
+		Encryption:             GlobalFlags.Encryption,
+		AWSConfig:              newAWSConfig,
 	})
+}
 
-	return log
+// newAWSConfig returns the default AWS config, assuming the profile given by
+// GlobalFlags.AssumeProfile if any.
+func newAWSConfig(ctx context.Context) (aws.Config, error) {
+	awsCfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return awsCfg, fmt.Errorf("failed to init aws config: %v", err)
+	}
+
+	if len(GlobalFlags.AssumeProfile) > 0 {
+		roleARN, err := getAWSProfileRoleARN(GlobalFlags.AssumeProfile)
+		if err != nil {
+			return awsCfg, err
+		}
+
+		stsClient := sts.NewFromConfig(awsCfg)
+		assumeRoleProvider := stscreds.NewAssumeRoleProvider(stsClient, roleARN)
+		awsCfg.Credentials = aws.NewCredentialsCache(assumeRoleProvider)
+	}
+
+	return awsCfg, nil
 }
 
 func getAWSProfileRoleARN(profileName string) (string, error) {
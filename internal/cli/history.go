@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/micvbang/confman-go/pkg/confman"
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/storage"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var ErrHistoryUnsupported = errors.New("storage does not keep history")
+
+type HistoryCommandInput struct {
+	ServicePath string
+	Format      string
+}
+
+type RollbackCommandInput struct {
+	ServicePath string
+	Revision    string
+}
+
+func ConfigureHistoryCommand(ctx context.Context, app *kingpin.Application, log logger.Logger) {
+	input := HistoryCommandInput{}
+
+	cmd := app.Command("history", "Lists changes to configuration (requires storage that keeps history, e.g. \"--storage git\")")
+	cmd.Arg("service", "Name of the service").
+		Required().
+		StringVar(&input.ServicePath)
+
+	addFlagOutputFormat(cmd, &input.Format)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		app.FatalIfError(HistoryCommand(ctx, input, os.Stdout, log, GlobalFlags.Storage), "history")
+		return nil
+	})
+}
+
+func ConfigureRollbackCommand(ctx context.Context, app *kingpin.Application, log logger.Logger) {
+	input := RollbackCommandInput{}
+
+	cmd := app.Command("rollback", "Restores configuration to a revision listed by \"history\"")
+	cmd.Arg("service", "Name of the service").
+		Required().
+		StringVar(&input.ServicePath)
+
+	cmd.Arg("revision", "Revision to restore").
+		Required().
+		StringVar(&input.Revision)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		app.FatalIfError(RollbackCommand(ctx, input, os.Stdout, log, GlobalFlags.Storage), "rollback")
+		return nil
+	})
+}
+
+func HistoryCommand(ctx context.Context, input HistoryCommandInput, w io.Writer, log logger.Logger, s storage.Storage) error {
+	historian, ok := storage.Find[storage.Historian](s)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrHistoryUnsupported, s)
+	}
+
+	servicePath := confman.FormatServicePath(input.ServicePath)
+	revisions, err := historian.History(ctx, servicePath)
+	if err != nil {
+		return err
+	}
+
+	if input.Format != formatText {
+		return outputFormat(input.Format, w, map[string]interface{}{
+			servicePath: revisions,
+		})
+	}
+
+	tw := tabwriter.NewWriter(w, 25, 4, 2, ' ', 0)
+
+	headers := []string{"Revision", "Date", "Author", "Message"}
+	headerUnderlining := make([]string, len(headers))
+	for i, key := range headers {
+		headerUnderlining[i] = strings.Repeat("=", len(key)+1)
+	}
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+	fmt.Fprintln(tw, strings.Join(headerUnderlining, "\t"))
+
+	for _, revision := range revisions {
+		// Only the first line of messages fits in a table.
+		message := strings.SplitN(revision.Message, "\n", 2)[0]
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", revision.ID, revision.Date.Format(time.RFC3339), revision.Author, message)
+	}
+
+	return tw.Flush()
+}
+
+func RollbackCommand(ctx context.Context, input RollbackCommandInput, w io.Writer, log logger.Logger, s storage.Storage) error {
+	historian, ok := storage.Find[storage.Historian](s)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrHistoryUnsupported, s)
+	}
+
+	servicePath := confman.FormatServicePath(input.ServicePath)
+	err := historian.Rollback(ctx, servicePath, input.Revision)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Restored %s to %s\n", servicePath, input.Revision)
+	return nil
+}
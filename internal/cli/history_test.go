@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/micvbang/confman-go/pkg/confman"
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/storage/git"
+	"github.com/micvbang/confman-go/pkg/storage/memory"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHistoryRollbackCommand verifies that HistoryCommand lists the changes
+// to a service path, and that RollbackCommand restores a listed revision.
+func TestHistoryRollbackCommand(t *testing.T) {
+	_, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git is not installed")
+	}
+
+	confman.ChamberCompatible = false
+	ctx := context.Background()
+	log := logger.LogrusWrapper{Logger: logrus.New()}
+	servicePath := "/email-dispatch/runtime/production"
+
+	s, err := git.New(log, git.Config{Repository: t.TempDir()})
+	require.NoError(t, err)
+
+	require.NoError(t, s.Write(ctx, servicePath, "DB_HOST", "localhost"))
+	require.NoError(t, s.Write(ctx, servicePath, "DB_HOST", "db.internal"))
+
+	revisions, err := s.History(ctx, servicePath)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(revisions))
+
+	buf := bytes.NewBuffer(nil)
+	err = HistoryCommand(ctx, HistoryCommandInput{ServicePath: "email-dispatch/runtime/production", Format: formatText}, buf, log, s)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Equal(t, 4, len(lines))
+	require.True(t, strings.HasPrefix(lines[2], revisions[0].ID))
+	require.True(t, strings.HasPrefix(lines[3], revisions[1].ID))
+	require.Contains(t, lines[3], "Write /email-dispatch/runtime/production: DB_HOST")
+
+	buf.Reset()
+	err = RollbackCommand(ctx, RollbackCommandInput{ServicePath: servicePath, Revision: revisions[1].ID}, buf, log, s)
+	require.NoError(t, err)
+	require.Contains(t, buf.String(), revisions[1].ID)
+
+	value, err := s.Read(ctx, servicePath, "DB_HOST")
+	require.NoError(t, err)
+	require.Equal(t, "localhost", value)
+}
+
+// TestHistoryCommandUnsupported verifies that HistoryCommand and
+// RollbackCommand return ErrHistoryUnsupported for storage that doesn't keep
+// history.
+func TestHistoryCommandUnsupported(t *testing.T) {
+	ctx := context.Background()
+	log := logger.LogrusWrapper{Logger: logrus.New()}
+	s := memory.New(log)
+
+	err := HistoryCommand(ctx, HistoryCommandInput{ServicePath: "/service", Format: formatText}, bytes.NewBuffer(nil), log, s)
+	require.ErrorIs(t, err, ErrHistoryUnsupported)
+
+	err = RollbackCommand(ctx, RollbackCommandInput{ServicePath: "/service", Revision: "HEAD"}, bytes.NewBuffer(nil), log, s)
+	require.ErrorIs(t, err, ErrHistoryUnsupported)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strings"
 
 	"text/tabwriter"
@@ -12,6 +13,7 @@ import (
 	"github.com/micvbang/confman-go/pkg/confman"
 	"github.com/micvbang/confman-go/pkg/logger"
 	"github.com/micvbang/confman-go/pkg/storage"
+	"github.com/micvbang/go-helpy/mapy"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
@@ -21,6 +23,9 @@ type ListCommandInput struct {
 	Format       string
 	Reveal       bool
 	Quiet        bool
+	Raw          bool
+	ShowTags     bool
+	Tags         map[string]string
 }
 
 func ConfigureListCommand(ctx context.Context, app *kingpin.Application, log logger.Logger) {
@@ -35,7 +40,14 @@ func ConfigureListCommand(ctx context.Context, app *kingpin.Application, log log
 		Envar("CONFMAN_REVEAL_VALUES").
 		BoolVar(&input.Reveal)
 
+	cmd.Flag("tags", "Show tags of keys (requires a request per key with \"--storage parameterstore\")").
+		BoolVar(&input.ShowTags)
+
+	cmd.Flag("tag", "Only list keys with the tag given as <name>=<value>, e.g. \"owner=team-x\" (repeatable)").
+		StringMapVar(&input.Tags)
+
 	addFlagOutputFormat(cmd, &input.Format)
+	addFlagRaw(cmd, &input.Raw)
 
 	cmd.Action(func(c *kingpin.ParseContext) error {
 		app.FatalIfError(ListCommand(ctx, input, os.Stdout, log, GlobalFlags.Storage), "list")
@@ -49,13 +61,24 @@ func ListCommand(ctx context.Context, input ListCommandInput, w io.Writer, log l
 	var metadataKeys []string
 	servicePaths := confman.ParseServicePaths(input.ServicePaths)
 	for _, servicePath := range servicePaths {
-		cm := confman.New(log, s, servicePath)
+		cm := newConfman(log, s, servicePath, input.Raw)
 		configKeys, err := cm.ReadAllMetadata(ctx)
 		if err != nil {
 			return err
 		}
+
+		if input.ShowTags || len(input.Tags) > 0 {
+			configKeys, err = addTags(ctx, cm, configKeys, input.Tags)
+			if err != nil {
+				return err
+			}
+		}
+
 		serviceConfigKeys[servicePath] = configKeys
 		metadataKeys = cm.MetadataKeys()
+		if input.ShowTags {
+			metadataKeys = append(metadataKeys, "tags")
+		}
 	}
 
 	if !input.Reveal {
@@ -102,3 +125,48 @@ func ListCommand(ctx context.Context, input ListCommandInput, w io.Writer, log l
 
 	return tw.Flush()
 }
+
+// addTags returns the keys of configKeys having all of filterTags, with their
+// tags added to their metadata as "tags", e.g. "owner=team-x,team=payments".
+func addTags(ctx context.Context, cm confman.Confman, configKeys []storage.KeyMetadata, filterTags map[string]string) ([]storage.KeyMetadata, error) {
+	tags, err := cm.ReadTags(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := make([]storage.KeyMetadata, 0, len(configKeys))
+	for _, km := range configKeys {
+		keyTags := tags[km.Key]
+		if !hasTags(keyTags, filterTags) {
+			continue
+		}
+
+		names := mapy.Keys(keyTags)
+		sort.Strings(names)
+		formatted := make([]string, len(names))
+		for i, name := range names {
+			formatted[i] = fmt.Sprintf("%s=%s", name, keyTags[name])
+		}
+
+		// Storage may share metadata maps between keys.
+		metadata := make(map[string]string, len(km.Metadata)+1)
+		for k, v := range km.Metadata {
+			metadata[k] = v
+		}
+		metadata["tags"] = strings.Join(formatted, ",")
+
+		km.Metadata = metadata
+		filtered = append(filtered, km)
+	}
+
+	return filtered, nil
+}
+
+func hasTags(tags map[string]string, wantTags map[string]string) bool {
+	for name, value := range wantTags {
+		if tagValue, exists := tags[name]; !exists || tagValue != value {
+			return false
+		}
+	}
+	return true
+}
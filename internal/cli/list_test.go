@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/micvbang/confman-go/pkg/confman"
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/storage"
+	"github.com/micvbang/confman-go/pkg/storage/memory"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// TestListCommandTags verifies that ListCommand adds the tags of keys to
+// their metadata, and only lists keys having the tags given as filter.
+func TestListCommandTags(t *testing.T) {
+	confman.ChamberCompatible = false
+	ctx := context.Background()
+	log := logger.LogrusWrapper{Logger: logrus.New()}
+	servicePath := "/service/production"
+
+	base := memory.New(log)
+	require.NoError(t, base.WriteKeys(ctx, servicePath, map[string]string{"DB_HOST": "db", "DB_PASSWORD": "secret", "LOG_LEVEL": "info"}))
+	s := &taggedStorage{Storage: base, tags: map[string]map[string]string{
+		"DB_HOST":     {"owner": "team-x"},
+		"DB_PASSWORD": {"owner": "team-x", "data": "secret"},
+		"LOG_LEVEL":   {"owner": "team-y"},
+	}}
+
+	buf := bytes.NewBuffer(nil)
+	err := ListCommand(ctx, ListCommandInput{ServicePaths: servicePath, Format: formatJSON, Tags: map[string]string{"owner": "team-x"}}, buf, log, s)
+	require.NoError(t, err)
+
+	got := map[string][]storage.KeyMetadata{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+
+	tags := map[string]string{}
+	for _, km := range got[servicePath] {
+		tags[km.Key] = km.Metadata["tags"]
+	}
+	require.Equal(t, map[string]string{"DB_HOST": "owner=team-x", "DB_PASSWORD": "data=secret,owner=team-x"}, tags)
+
+	err = ListCommand(ctx, ListCommandInput{ServicePaths: servicePath, Format: formatJSON, ShowTags: true}, bytes.NewBuffer(nil), log, base)
+	require.ErrorIs(t, err, storage.ErrTagsUnsupported)
+}
+
+// taggedStorage adds fixed tags to keys of the storage it embeds.
+type taggedStorage struct {
+	storage.Storage
+	tags map[string]map[string]string
+}
+
+func (s *taggedStorage) ReadTags(ctx context.Context, servicePath string) (map[string]map[string]string, error) {
+	return s.tags, nil
+}
@@ -6,7 +6,6 @@ import (
 	"io"
 	"os"
 
-	"github.com/micvbang/confman-go/pkg/confman"
 	"github.com/micvbang/confman-go/pkg/logger"
 	"github.com/micvbang/confman-go/pkg/storage"
 	"gopkg.in/alecthomas/kingpin.v2"
@@ -17,6 +16,7 @@ type ReadCommandInput struct {
 	Keys        []string
 	Quiet       bool
 	Format      string
+	Raw         bool
 }
 
 func ConfigureReadCommand(ctx context.Context, app *kingpin.Application, log logger.Logger) {
@@ -37,6 +37,7 @@ func ConfigureReadCommand(ctx context.Context, app *kingpin.Application, log log
 		BoolVar(&input.Quiet)
 
 	addFlagOutputFormat(cmd, &input.Format)
+	addFlagRaw(cmd, &input.Raw)
 
 	cmd.Action(func(c *kingpin.ParseContext) error {
 		app.FatalIfError(ReadCommand(ctx, input, os.Stdout, log, GlobalFlags.Storage), "read")
@@ -45,7 +46,7 @@ func ConfigureReadCommand(ctx context.Context, app *kingpin.Application, log log
 }
 
 func ReadCommand(ctx context.Context, input ReadCommandInput, w io.Writer, log logger.Logger, storage storage.Storage) error {
-	cm := confman.New(log, storage, input.ServicePath)
+	cm := newConfman(log, storage, input.ServicePath, input.Raw)
 	config, err := cm.ReadKeys(ctx, input.Keys)
 	if err != nil {
 		return err
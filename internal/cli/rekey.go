@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/micvbang/confman-go/pkg/confman"
+	"github.com/micvbang/confman-go/pkg/encryption"
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/storage"
+	"github.com/micvbang/confman-go/pkg/storage/backend"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	ErrListUnsupported  = errors.New("storage can't list service paths")
+	ErrRekeyUnsupported = errors.New("storage doesn't encrypt values")
+)
+
+type RekeyCommandInput struct {
+	Prefix    string
+	Recursive bool
+	To        backend.KeyProviderConfig
+}
+
+func ConfigureRekeyCommand(ctx context.Context, app *kingpin.Application, log logger.Logger) {
+	input := RekeyCommandInput{}
+
+	cmd := app.Command("rekey", "Re-encrypts values using the key provider given by \"--to\", decrypting them using the key provider given by \"--encryption\". Without \"--to\", values are re-encrypted using the key currently configured for them, e.g. the KMS key selected by \"--aws-kms-key-rule\"")
+	cmd.Arg("prefix", "Service path to re-encrypt, including the service paths below it").
+		Required().
+		StringVar(&input.Prefix)
+
+	cmd.Flag("recursive", "Re-encrypt service paths below prefix as well (requires storage that can list service paths)").
+		Default("true").
+		BoolVar(&input.Recursive)
+
+	addKeyProviderFlags(cmd.Flag, "to", "CONFMAN_REKEY_TO", backend.KeyProviderNone, &input.To)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		to, err := backend.NewKeyProvider(ctx, input.To, newAWSConfig)
+		app.FatalIfError(err, "rekey")
+
+		app.FatalIfError(RekeyCommand(ctx, input, os.Stdout, log, GlobalFlags.Storage, to), "rekey")
+		return nil
+	})
+}
+
+// RekeyCommand re-encrypts the values of the service paths below
+// input.Prefix that are not encrypted using the key provider to, including
+// values that are not encrypted at all. If to is nil, values are re-encrypted
+// by the storage itself, using the key it is configured to use for them.
+func RekeyCommand(ctx context.Context, input RekeyCommandInput, w io.Writer, log logger.Logger, s storage.Storage, to encryption.KeyProvider) error {
+	var rekeyer storage.Rekeyer
+	if to != nil {
+		if e, ok := storage.Find[*storage.Encrypting](s); ok {
+			rekeyer = e.WithProvider(to)
+		} else {
+			rekeyer = storage.NewEncrypting(log, s, to)
+		}
+	} else {
+		var ok bool
+		rekeyer, ok = storage.Find[storage.Rekeyer](s)
+		if !ok {
+			return fmt.Errorf("%w: %s, use --to", ErrRekeyUnsupported, s)
+		}
+	}
+
+	prefix := confman.FormatServicePath(input.Prefix)
+	servicePaths := []string{prefix}
+	if input.Recursive {
+		lister, ok := storage.Find[storage.Lister](s)
+		if !ok {
+			return fmt.Errorf("%w: %s, use --no-recursive", ErrListUnsupported, s)
+		}
+
+		var err error
+		servicePaths, err = lister.ListServicePaths(ctx, prefix)
+		if err != nil {
+			return err
+		}
+	}
+
+	total := 0
+	for _, servicePath := range servicePaths {
+		numRekeyed, err := rekeyer.Rekey(ctx, servicePath)
+		if err != nil {
+			return err
+		}
+
+		if numRekeyed > 0 {
+			fmt.Fprintf(w, "Re-encrypted %d keys of %s\n", numRekeyed, servicePath)
+		}
+		total += numRekeyed
+	}
+
+	if to != nil {
+		fmt.Fprintf(w, "Re-encrypted %d keys of %d service paths using %s\n", total, len(servicePaths), to.KeyID())
+	} else {
+		fmt.Fprintf(w, "Re-encrypted %d keys of %d service paths\n", total, len(servicePaths))
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/micvbang/confman-go/pkg/confman"
+	"github.com/micvbang/confman-go/pkg/encryption"
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/storage"
+	"github.com/micvbang/confman-go/pkg/storage/memory"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRekeyCommand verifies that RekeyCommand re-encrypts the values of the
+// service paths below the prefix, decrypting them using the key provider of
+// the given storage.
+func TestRekeyCommand(t *testing.T) {
+	confman.ChamberCompatible = false
+	ctx := context.Background()
+	log := logger.LogrusWrapper{Logger: logrus.New()}
+	oldProvider := newTestKeyProvider(t)
+	newProvider := newTestKeyProvider(t)
+
+	base := memory.New(log)
+	require.NoError(t, base.Write(ctx, "/service/development", "PLAINTEXT", "plain"))
+	s := storage.NewEncrypting(log, base, oldProvider)
+	require.NoError(t, s.Write(ctx, "/service/production", "OLD", "old"))
+	require.NoError(t, s.Write(ctx, "/service/production/nested", "OLD", "old"))
+	require.NoError(t, s.Write(ctx, "/other", "OLD", "old"))
+
+	buf := bytes.NewBuffer(nil)
+	err := RekeyCommand(ctx, RekeyCommandInput{Prefix: "service", Recursive: true}, buf, log, s, newProvider)
+	require.NoError(t, err)
+	require.Contains(t, buf.String(), "Re-encrypted 3 keys of 3 service paths")
+
+	rekeyed := storage.NewEncrypting(log, base, newProvider)
+	for _, servicePath := range []string{"/service/development", "/service/production", "/service/production/nested"} {
+		_, err := rekeyed.ReadAll(ctx, servicePath)
+		require.NoError(t, err, servicePath)
+	}
+
+	_, err = rekeyed.ReadAll(ctx, "/other")
+	require.ErrorIs(t, err, storage.ErrUnknownKeyID)
+
+	// Without recursion, only the prefix itself is re-encrypted.
+	buf.Reset()
+	err = RekeyCommand(ctx, RekeyCommandInput{Prefix: "/other", Recursive: false}, buf, log, s, newProvider)
+	require.NoError(t, err)
+	require.Contains(t, buf.String(), "Re-encrypted 1 keys of 1 service paths")
+}
+
+// TestRekeyCommandListUnsupported verifies that RekeyCommand returns
+// ErrListUnsupported when recursing through storage that can't list service
+// paths.
+func TestRekeyCommandListUnsupported(t *testing.T) {
+	ctx := context.Background()
+	log := logger.LogrusWrapper{Logger: logrus.New()}
+
+	s := &storage.MockStorage{}
+	s.On("String").Return("MockStorage")
+
+	err := RekeyCommand(ctx, RekeyCommandInput{Prefix: "/service", Recursive: true}, bytes.NewBuffer(nil), log, s, newTestKeyProvider(t))
+	require.ErrorIs(t, err, ErrListUnsupported)
+}
+
+// TestRekeyCommandStorage verifies that RekeyCommand lets the storage
+// re-encrypt values when no key provider is given, and returns
+// ErrRekeyUnsupported if the storage doesn't encrypt values.
+func TestRekeyCommandStorage(t *testing.T) {
+	confman.ChamberCompatible = false
+	ctx := context.Background()
+	log := logger.LogrusWrapper{Logger: logrus.New()}
+
+	base := memory.New(log)
+	require.NoError(t, base.Write(ctx, "/service/production", "KEY", "value"))
+	require.NoError(t, base.Write(ctx, "/service/development", "KEY", "value"))
+
+	err := RekeyCommand(ctx, RekeyCommandInput{Prefix: "/service", Recursive: true}, bytes.NewBuffer(nil), log, base, nil)
+	require.ErrorIs(t, err, ErrRekeyUnsupported)
+
+	s := &rekeyingStorage{Storage: base}
+	buf := bytes.NewBuffer(nil)
+	err = RekeyCommand(ctx, RekeyCommandInput{Prefix: "/service", Recursive: true}, buf, log, s, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"/service/development", "/service/production"}, s.rekeyed)
+	require.Contains(t, buf.String(), "Re-encrypted 2 keys of 2 service paths")
+}
+
+// rekeyingStorage records the service paths it is asked to re-encrypt,
+// re-encrypting one key of each.
+type rekeyingStorage struct {
+	storage.Storage
+	rekeyed []string
+}
+
+func (s *rekeyingStorage) Rekey(ctx context.Context, servicePath string) (int, error) {
+	s.rekeyed = append(s.rekeyed, servicePath)
+	return 1, nil
+}
+
+func (s *rekeyingStorage) Unwrap() storage.Storage {
+	return s.Storage
+}
+
+func newTestKeyProvider(t *testing.T) encryption.KeyProvider {
+	key, err := encryption.GenerateKey()
+	require.NoError(t, err)
+
+	provider, err := encryption.NewKeyProvider(key)
+	require.NoError(t, err)
+	return provider
+}
@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/micvbang/confman-go/pkg/confman"
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/render"
+	"github.com/micvbang/confman-go/pkg/storage"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type RenderCommandInput struct {
+	ServicePaths string
+	TemplatePath string
+	OutputPath   string
+	Raw          bool
+}
+
+func ConfigureRenderCommand(ctx context.Context, app *kingpin.Application, log logger.Logger) {
+	input := RenderCommandInput{}
+
+	cmd := app.Command("render", "Renders a Go text/template file with the given configurations as data")
+	cmd.Arg("service", "Name of the service(s)").
+		Required().
+		StringVar(&input.ServicePaths)
+
+	cmd.Arg("template", "Path of the template file, or - to read from stdin").
+		Required().
+		StringVar(&input.TemplatePath)
+
+	cmd.Flag("output", "Write to the given file with permissions 0600 instead of stdout").
+		Short('o').
+		StringVar(&input.OutputPath)
+
+	addFlagRaw(cmd, &input.Raw)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		app.FatalIfError(RenderCommand(ctx, input, os.Stdin, os.Stdout, log, GlobalFlags.Storage), "render")
+		return nil
+	})
+}
+
+// RenderCommand renders the template with the merged configuration of the
+// service paths as data. When the same key exists on several service paths,
+// the value from the service path given last takes precedence. Nothing is
+// written if rendering fails.
+func RenderCommand(ctx context.Context, input RenderCommandInput, r io.Reader, w io.Writer, log logger.Logger, storage storage.Storage) error {
+	templateName := filepath.Base(input.TemplatePath)
+	if input.TemplatePath == "-" {
+		templateName = "stdin"
+	} else {
+		f, err := os.Open(input.TemplatePath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	text, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("reading template: %w", err)
+	}
+
+	config := make(map[string]string)
+	for _, servicePath := range confman.ParseServicePaths(input.ServicePaths) {
+		cm := newConfman(log, storage, servicePath, input.Raw)
+		curConfig, err := cm.ReadAll(ctx)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", cm.ServicePath(), err)
+		}
+
+		for key, value := range curConfig {
+			config[key] = value
+		}
+	}
+
+	buf := bytes.NewBuffer(nil)
+	err = render.Render(buf, templateName, string(text), config)
+	if err != nil {
+		return err
+	}
+
+	if len(input.OutputPath) > 0 {
+		return writeFileAtomic(input.OutputPath, buf.Bytes(), 0600)
+	}
+
+	_, err = w.Write(buf.Bytes())
+	return err
+}
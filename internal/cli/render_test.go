@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/micvbang/confman-go/pkg/confman"
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/render"
+	"github.com/micvbang/confman-go/pkg/storage/memory"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRenderCommand verifies that the template is rendered with the merged
+// configuration of the service paths, and that output is written to the
+// output file with permissions 0600.
+func TestRenderCommand(t *testing.T) {
+	ctx := context.Background()
+	log := logger.LogrusWrapper{Logger: logrus.New()}
+	confman.ChamberCompatible = false
+
+	m := memory.New(log)
+	require.NoError(t, m.WriteKeys(ctx, "/shared/production", map[string]string{"DB_HOST": "shared-db", "DB_PORT": "5432"}))
+	require.NoError(t, m.WriteKeys(ctx, "/service/production", map[string]string{"DB_HOST": "service-db"}))
+
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "pgbouncer.ini.tmpl")
+	require.NoError(t, os.WriteFile(templatePath, []byte("host={{ .DB_HOST }} port={{ .DB_PORT }}\n"), 0644))
+
+	input := RenderCommandInput{
+		ServicePaths: "/shared/production,/service/production",
+		TemplatePath: templatePath,
+	}
+
+	output := bytes.NewBuffer(nil)
+	err := RenderCommand(ctx, input, nil, output, log, m)
+	require.NoError(t, err)
+	require.Equal(t, "host=service-db port=5432\n", output.String())
+
+	input.OutputPath = filepath.Join(dir, "pgbouncer.ini")
+	err = RenderCommand(ctx, input, nil, bytes.NewBuffer(nil), log, m)
+	require.NoError(t, err)
+
+	bs, err := os.ReadFile(input.OutputPath)
+	require.NoError(t, err)
+	require.Equal(t, "host=service-db port=5432\n", string(bs))
+
+	info, err := os.Stat(input.OutputPath)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+// TestRenderCommandStdinRequired verifies that templates can be read from
+// stdin, and that the output file is not written when rendering fails.
+func TestRenderCommandStdinRequired(t *testing.T) {
+	ctx := context.Background()
+	log := logger.LogrusWrapper{Logger: logrus.New()}
+	confman.ChamberCompatible = false
+
+	input := RenderCommandInput{
+		ServicePaths: "/service/production",
+		TemplatePath: "-",
+		OutputPath:   filepath.Join(t.TempDir(), "output"),
+	}
+
+	stdin := strings.NewReader(`{{ required "DB_HOST must be set" .DB_HOST }}`)
+	err := RenderCommand(ctx, input, stdin, bytes.NewBuffer(nil), log, memory.New(log))
+	require.ErrorIs(t, err, render.ErrRequired)
+
+	_, err = os.Stat(input.OutputPath)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,24 @@
+package cli
+
+import (
+	"github.com/micvbang/confman-go/pkg/confman"
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/storage"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+func addFlagRaw(cmd *kingpin.CmdClause, raw *bool) {
+	cmd.Flag("raw", "Don't resolve references to other keys, i.e. output values as they are stored").
+		Default("false").
+		BoolVar(raw)
+}
+
+// newConfman returns a Confman that resolves references in values, unless
+// raw is true.
+func newConfman(log logger.Logger, s storage.Storage, servicePath string, raw bool) confman.Confman {
+	if raw {
+		return confman.New(log, s, servicePath)
+	}
+
+	return confman.NewResolving(log, s, servicePath)
+}
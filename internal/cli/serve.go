@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/server"
+	"github.com/micvbang/confman-go/pkg/storage"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type ServeCommandInput struct {
+	ConfigPath  string
+	Listen      string
+	TLSCertFile string
+	TLSKeyFile  string
+}
+
+func ConfigureServeCommand(ctx context.Context, app *kingpin.Application, log logger.Logger) {
+	input := ServeCommandInput{}
+
+	cmd := app.Command("serve", "Serves configuration over an HTTP JSON API")
+	cmd.Flag("config", "Path of the server config file, listing tokens and their permissions").
+		Required().
+		Envar("CONFMAN_SERVER_CONFIG").
+		StringVar(&input.ConfigPath)
+
+	cmd.Flag("listen", "Address to listen on").
+		Default("127.0.0.1:8080").
+		Envar("CONFMAN_SERVER_LISTEN").
+		StringVar(&input.Listen)
+
+	cmd.Flag("tls-cert", "Path of TLS certificate file").
+		StringVar(&input.TLSCertFile)
+
+	cmd.Flag("tls-key", "Path of TLS key file (used with \"--tls-cert\")").
+		StringVar(&input.TLSKeyFile)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		app.FatalIfError(ServeCommand(ctx, input, log, GlobalFlags.Storage), "serve")
+		return nil
+	})
+}
+
+func ServeCommand(ctx context.Context, input ServeCommandInput, log logger.Logger, storage storage.Storage) error {
+	config, err := server.ReadConfig(input.ConfigPath)
+	if err != nil {
+		return err
+	}
+
+	s, err := server.New(log, storage, config)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Serving %s on %s", storage, input.Listen)
+	return s.ListenAndServe(ctx, input.Listen, input.TLSCertFile, input.TLSKeyFile)
+}
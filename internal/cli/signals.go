@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+// signalsByName holds the signals that can be given by name on the command
+// line. Platform specific signals are added in init functions.
+var signalsByName = map[string]syscall.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGKILL": syscall.SIGKILL,
+	"SIGTERM": syscall.SIGTERM,
+}
+
+// parseSignal parses a signal name, e.g. "SIGTERM", "TERM" or "term".
+func parseSignal(name string) (syscall.Signal, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+
+	sig, exists := signalsByName[name]
+	if !exists {
+		return 0, fmt.Errorf("unsupported signal '%s'", name)
+	}
+
+	return sig, nil
+}
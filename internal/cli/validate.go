@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/micvbang/confman-go/pkg/confman"
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/schema"
+	"github.com/micvbang/confman-go/pkg/storage"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var ErrSchemaViolation = errors.New("configuration violates schema")
+
+type ValidateCommandInput struct {
+	ServicePaths string
+	SchemaPath   string
+	Format       string
+}
+
+func ConfigureValidateCommand(ctx context.Context, app *kingpin.Application, log logger.Logger) {
+	input := ValidateCommandInput{}
+
+	cmd := app.Command("validate", "Validates stored configuration against a schema")
+	cmd.Arg("service", "Name of the service(s)").
+		Required().
+		StringVar(&input.ServicePaths)
+
+	addFlagSchema(cmd, &input.SchemaPath)
+	addFlagOutputFormat(cmd, &input.Format)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		app.FatalIfError(ValidateCommand(ctx, input, os.Stdout, log, GlobalFlags.Storage), "validate")
+		return nil
+	})
+}
+
+func addFlagSchema(cmd *kingpin.CmdClause, schemaPath *string) {
+	cmd.Flag("schema", "Schema file, or folder containing schema files, to validate configuration against").
+		Envar("CONFMAN_SCHEMA").
+		StringVar(schemaPath)
+}
+
+func ValidateCommand(ctx context.Context, input ValidateCommandInput, w io.Writer, log logger.Logger, storage storage.Storage) error {
+	if len(input.SchemaPath) == 0 {
+		return fmt.Errorf("no schema given, use --schema or CONFMAN_SCHEMA")
+	}
+
+	s, err := schema.Read(input.SchemaPath)
+	if err != nil {
+		return err
+	}
+
+	violations := []schema.Violation{}
+	for _, servicePath := range confman.ParseServicePaths(input.ServicePaths) {
+		cm := confman.NewResolving(log, storage, servicePath)
+		config, err := cm.ReadAll(ctx)
+		if err != nil {
+			return err
+		}
+
+		violations = append(violations, s.Validate(cm.ServicePath(), config)...)
+	}
+
+	if input.Format != formatText {
+		err = outputFormat(input.Format, w, violations)
+		if err != nil {
+			return err
+		}
+	} else {
+		outputViolations(w, violations)
+	}
+
+	if len(violations) > 0 {
+		return ErrSchemaViolation
+	}
+
+	return nil
+}
+
+func outputViolations[T error](w io.Writer, violations []T) {
+	for _, violation := range violations {
+		fmt.Fprintf(w, "%s\n", violation)
+	}
+}
@@ -19,6 +19,14 @@ type WriteCommandInput struct {
 	Key         string
 	Value       string
 	Format      string
+	Type        string
+	Description string
+	Tags        map[string]string
+	Tier        string
+
+	ExpiresIn            storage.Duration
+	NotifyBefore         storage.Duration
+	NoChangeNotification storage.Duration
 }
 
 func ConfigureWriteCommand(ctx context.Context, app *kingpin.Application, log logger.Logger) {
@@ -39,6 +47,27 @@ func ConfigureWriteCommand(ctx context.Context, app *kingpin.Application, log lo
 		Short('v').
 		StringVar(&input.Value)
 
+	cmd.Flag("type", "Parameter type of the key, defaults to the current type of existing keys and SecureString for new keys (used with \"--storage parameterstore\")").
+		EnumVar(&input.Type, storage.ParameterTypes...)
+
+	cmd.Flag("description", "Description of the key, e.g. its purpose (used with \"--storage parameterstore\")").
+		StringVar(&input.Description)
+
+	cmd.Flag("tag", "Tag to add to the key as <name>=<value>, e.g. \"owner=team-x\" (repeatable, used with \"--storage parameterstore\")").
+		StringMapVar(&input.Tags)
+
+	cmd.Flag("tier", "Parameter tier of the key, defaults to Advanced if required by the value or policies (used with \"--storage parameterstore\")").
+		EnumVar(&input.Tier, storage.ParameterTiers...)
+
+	cmd.Flag("expires-in", "Duration after which the key is deleted, e.g. \"90d\" or \"36h\" (used with \"--storage parameterstore\")").
+		SetValue(&input.ExpiresIn)
+
+	cmd.Flag("notify-before", "Duration before expiration at which to notify, e.g. \"7d\" (used with \"--expires-in\")").
+		SetValue(&input.NotifyBefore)
+
+	cmd.Flag("no-change-notification", "Duration after which to notify if the key hasn't changed, e.g. \"30d\" (used with \"--storage parameterstore\")").
+		SetValue(&input.NoChangeNotification)
+
 	cmd.Action(func(c *kingpin.ParseContext) error {
 
 		app.FatalIfError(WriteCommand(ctx, input, os.Stdout, log, GlobalFlags.Storage), "write")
@@ -46,8 +75,8 @@ func ConfigureWriteCommand(ctx context.Context, app *kingpin.Application, log lo
 	})
 }
 
-func WriteCommand(ctx context.Context, input WriteCommandInput, w io.Writer, log logger.Logger, storage storage.Storage) error {
-	cm := confman.New(log, storage, input.ServicePath)
+func WriteCommand(ctx context.Context, input WriteCommandInput, w io.Writer, log logger.Logger, s storage.Storage) error {
+	cm := confman.New(log, s, input.ServicePath)
 
 	var err error
 	value := input.Value
@@ -58,7 +87,23 @@ func WriteCommand(ctx context.Context, input WriteCommandInput, w io.Writer, log
 		}
 	}
 
-	err = cm.Write(ctx, input.Key, value)
+	options := storage.WriteOptions{
+		Type:        input.Type,
+		Description: input.Description,
+		Tags:        input.Tags,
+		Tier:        input.Tier,
+
+		ExpiresIn:            input.ExpiresIn,
+		NotifyBefore:         input.NotifyBefore,
+		NoChangeNotification: input.NoChangeNotification,
+	}
+	if !options.IsZero() {
+		err = cm.WriteKeysWithOptions(ctx, map[string]string{input.Key: value}, map[string]storage.WriteOptions{
+			input.Key: options,
+		})
+	} else {
+		err = cm.Write(ctx, input.Key, value)
+	}
 	if err != nil {
 		return err
 	}
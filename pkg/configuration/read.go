@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/micvbang/confman-go/pkg/storage"
 	"github.com/micvbang/go-helpy/filepathy"
 	"github.com/micvbang/go-helpy/mapy"
 )
@@ -22,30 +23,33 @@ func Read(path string) ([]ServiceConfig, error) {
 
 	serviceConfigs := make([]ServiceConfig, 0, len(configPaths))
 	for _, configPath := range configPaths {
-		config, err := readConfiguration(configPath)
+		config, options, err := readConfiguration(configPath)
 		if err != nil {
 			return nil, err
 		}
 
 		serviceConfigs = append(serviceConfigs, ServiceConfig{
-			Path:   configPath,
-			Config: config,
+			Path:    configPath,
+			Config:  config,
+			Options: options,
 		})
 	}
 
 	return serviceConfigs, nil
 }
 
-var extensionReader map[string]func(string) (map[string]string, error) = map[string]func(string) (map[string]string, error){
+type configurationReader func(path string) (map[string]string, map[string]storage.WriteOptions, error)
+
+var extensionReader map[string]configurationReader = map[string]configurationReader{
 	".yml": readYML,
 }
 
-func readConfiguration(path string) (map[string]string, error) {
+func readConfiguration(path string) (map[string]string, map[string]storage.WriteOptions, error) {
 	ext := filepath.Ext(path)
 	f, exists := extensionReader[ext]
 	if !exists {
 		supportedFormats := mapy.Keys(extensionReader)
-		return nil, ConfigError{msg: fmt.Sprintf("failed to parse file \"%s\". Configuration in \"%s\" format not supported. Supported formats are: %v", path, ext, supportedFormats)}
+		return nil, nil, ConfigError{msg: fmt.Sprintf("failed to parse file \"%s\". Configuration in \"%s\" format not supported. Supported formats are: %v", path, ext, supportedFormats)}
 	}
 
 	return f(path)
@@ -76,6 +80,9 @@ func getConfigPaths(path string) []string {
 type ServiceConfig struct {
 	Path   string
 	Config map[string]string
+
+	// Options holds the options of the keys of Config that have any.
+	Options map[string]storage.WriteOptions
 }
 
 type ConfigError struct {
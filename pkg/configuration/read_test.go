@@ -0,0 +1,95 @@
+package configuration_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/micvbang/confman-go/pkg/configuration"
+	"github.com/micvbang/confman-go/pkg/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// TestReadOptions verifies that keys can be given either as values or as maps
+// of values and options, and that only keys given options have any.
+func TestReadOptions(t *testing.T) {
+	filePath := writeConfigFile(t, `
+DB_PASSWORD: hunter2
+PORT: 8080
+INSTANCE_SIZE:
+  value: t3.micro
+  type: String
+HOSTS:
+  value: a,b
+  type: StringList
+DB_HOST:
+  value: db.internal
+  description: Primary database
+  tags:
+    owner: team-x
+API_TOKEN:
+  value: secret
+  expires_in: 90d
+  notify_before: 7d
+  no_change_notification: 720h
+`)
+
+	serviceConfigs, err := configuration.Read(filePath)
+	require.NoError(t, err)
+	require.Len(t, serviceConfigs, 1)
+
+	require.Equal(t, map[string]string{
+		"DB_PASSWORD":   "hunter2",
+		"PORT":          "8080",
+		"INSTANCE_SIZE": "t3.micro",
+		"HOSTS":         "a,b",
+		"DB_HOST":       "db.internal",
+		"API_TOKEN":     "secret",
+	}, serviceConfigs[0].Config)
+	require.Equal(t, map[string]storage.WriteOptions{
+		"INSTANCE_SIZE": {Type: storage.ParameterTypeString},
+		"HOSTS":         {Type: storage.ParameterTypeStringList},
+		"DB_HOST":       {Description: "Primary database", Tags: map[string]string{"owner": "team-x"}},
+		"API_TOKEN": {
+			ExpiresIn:            storage.Duration(90 * 24 * time.Hour),
+			NotifyBefore:         storage.Duration(7 * 24 * time.Hour),
+			NoChangeNotification: storage.Duration(30 * 24 * time.Hour),
+		},
+	}, serviceConfigs[0].Options)
+}
+
+// TestReadOptionsInvalid verifies that unsupported parameter types, invalid
+// policies, unknown options and missing values are rejected.
+func TestReadOptionsInvalid(t *testing.T) {
+	contents := []string{`
+INSTANCE_SIZE:
+  value: t3.micro
+  type: Plain
+`, `
+API_TOKEN:
+  value: secret
+  notify_before: 7d
+`, `
+INSTANCE_SIZE:
+  value: t3.micro
+  descripton: EC2 instance type of workers
+`, `
+INSTANCE_SIZE:
+  type: String
+  description: EC2 instance type of workers
+`}
+
+	for _, content := range contents {
+		filePath := writeConfigFile(t, content)
+
+		_, err := configuration.Read(filePath)
+		require.ErrorAs(t, err, &configuration.ConfigError{})
+	}
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	filePath := filepath.Join(t.TempDir(), "production.yml")
+	require.NoError(t, os.WriteFile(filePath, []byte(content), 0600))
+	return filePath
+}
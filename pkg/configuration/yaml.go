@@ -1,20 +1,91 @@
 package configuration
 
 import (
+	"fmt"
 	"os"
 
+	"github.com/micvbang/confman-go/pkg/storage"
 	"gopkg.in/yaml.v2"
 )
 
-func readYML(path string) (map[string]string, error) {
+func readYML(path string) (map[string]string, map[string]storage.WriteOptions, error) {
 	f, err := os.Open(path)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer f.Close()
 
-	// This type definition enforces that we only parse non-nested yaml, i.e. only string values.
-	config := map[string]string{}
-	err = yaml.NewDecoder(f).Decode(&config)
-	return config, err
+	keyConfigs := map[string]ymlKeyConfig{}
+	err = yaml.NewDecoder(f).Decode(&keyConfigs)
+	if err != nil {
+		return nil, nil, ConfigError{msg: fmt.Sprintf("failed to parse file \"%s\": %s", path, err)}
+	}
+
+	config := make(map[string]string, len(keyConfigs))
+	options := map[string]storage.WriteOptions{}
+	for key, keyConfig := range keyConfigs {
+		config[key] = keyConfig.Value
+		if !keyConfig.Options.IsZero() {
+			err := keyConfig.Options.Validate()
+			if err != nil {
+				return nil, nil, ConfigError{msg: fmt.Sprintf("failed to parse file \"%s\": key %s: %s", path, key, err)}
+			}
+			options[key] = keyConfig.Options
+		}
+	}
+
+	return config, options, nil
+}
+
+// ymlKeyConfig is the configuration of a key, given either as its value, or
+// as a map of its value and options:
+//
+//	INSTANCE_SIZE:
+//	  value: t3.micro
+//	  type: String
+//	  description: EC2 instance type of workers
+//	  tags:
+//	    owner: team-x
+type ymlKeyConfig struct {
+	Value   string
+	Options storage.WriteOptions
+}
+
+func (c *ymlKeyConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	// Only scalar values are accepted, unless given as a map of value and
+	// options.
+	err := unmarshal(&c.Value)
+	if err == nil {
+		return nil
+	}
+
+	// The map is decoded strictly to reject misspelled options, which would
+	// otherwise be ignored silently.
+	raw := yaml.MapSlice{}
+	err = unmarshal(&raw)
+	if err != nil {
+		return err
+	}
+
+	bs, err := yaml.Marshal(raw)
+	if err != nil {
+		return err
+	}
+
+	keyConfig := struct {
+		Value                *string `yaml:"value"`
+		storage.WriteOptions `yaml:",inline"`
+	}{}
+	err = yaml.UnmarshalStrict(bs, &keyConfig)
+	if err != nil {
+		return err
+	}
+
+	if keyConfig.Value == nil {
+		return fmt.Errorf("missing value")
+	}
+
+	c.Value = *keyConfig.Value
+	c.Options = keyConfig.WriteOptions
+	return nil
 }
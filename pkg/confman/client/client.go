@@ -0,0 +1,75 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/micvbang/confman-go/pkg/confman"
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/storage"
+)
+
+// Client reads the configuration of one or more service paths for use in
+// services.
+type Client struct {
+	log          logger.Logger
+	storage      storage.Storage
+	servicePaths []string
+	options      confman.Options
+}
+
+// New returns a Client reading configuration from the given service paths.
+// Service paths use the same syntax as the CLI, e.g.
+// "/email-dispatch/runtime/production,/shared/db/production".
+func New(log logger.Logger, s storage.Storage, servicePaths string) *Client {
+	return NewWithOptions(log, s, servicePaths, confman.DefaultOptions())
+}
+
+// NewWithOptions returns a Client like New, reading configuration using
+// options instead of the package variables of confman, e.g.
+// confman.ChamberCompatible.
+func NewWithOptions(log logger.Logger, s storage.Storage, servicePaths string, options confman.Options) *Client {
+	return &Client{
+		log:          log,
+		storage:      s,
+		servicePaths: confman.ParseServicePaths(servicePaths),
+		options:      options,
+	}
+}
+
+// ServicePaths returns the service paths that the client reads from.
+func (c *Client) ServicePaths() []string {
+	return c.servicePaths
+}
+
+// ReadAll returns the merged configuration of all service paths. When the
+// same key exists on several service paths, the value from the service path
+// given last takes precedence. References in values are resolved.
+func (c *Client) ReadAll(ctx context.Context) (map[string]string, error) {
+	config := make(map[string]string)
+
+	for _, servicePath := range c.servicePaths {
+		cm := confman.NewResolvingWithOptions(c.log, c.storage, servicePath, c.options)
+		curConfig, err := cm.ReadAll(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", cm.ServicePath(), err)
+		}
+
+		for key, value := range curConfig {
+			config[key] = value
+		}
+	}
+
+	return config, nil
+}
+
+// Load reads the configuration of all service paths and stores it in the
+// struct pointed to by v. See Unmarshal for details.
+func (c *Client) Load(ctx context.Context, v interface{}) error {
+	config, err := c.ReadAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	return Unmarshal(config, v)
+}
@@ -0,0 +1,188 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+
+	"github.com/micvbang/confman-go/pkg/confman"
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/storage/backend"
+	"github.com/micvbang/go-helpy/mapy"
+	"github.com/sirupsen/logrus"
+)
+
+// Environment variables used by NewFromEnvironment
+const (
+	EnvServicePaths      = "CONFMAN_SERVICE_PATHS"
+	EnvKMSKeyAlias       = backend.EnvKMSKeyAlias
+	EnvChamberCompatible = "CONFMAN_CHAMBER_COMPATIBLE"
+)
+
+var (
+	ErrNoServicePaths = fmt.Errorf("%s not set", EnvServicePaths)
+	ErrEnvConflict    = errors.New("key already set in environment")
+)
+
+// OverwritePolicy controls what PopulateEnvironment does when a key is
+// already set in the environment.
+type OverwritePolicy string
+
+const (
+	// OverwriteAlways replaces existing environment variables. This is the
+	// default, and matches the behavior of `confman exec`.
+	OverwriteAlways OverwritePolicy = "always"
+
+	// OverwriteNever keeps existing environment variables.
+	OverwriteNever OverwritePolicy = "never"
+
+	// OverwriteError makes PopulateEnvironment fail without changing the
+	// environment if any key is already set.
+	OverwriteError OverwritePolicy = "error"
+)
+
+type PopulateEnvironmentInput struct {
+	Overwrite OverwritePolicy
+
+	// Include holds glob patterns (see path.Match) of keys to set. When
+	// empty, all keys are included.
+	Include []string
+
+	// Exclude holds glob patterns (see path.Match) of keys not to set.
+	Exclude []string
+}
+
+// NewFromEnvironment returns a Client reading from the storage configured by
+// the environment variables of the CLI, e.g. CONFMAN_STORAGE, see
+// backend.ConfigFromEnvironment. AWS storage uses the default AWS
+// configuration. The service paths to read are given by
+// CONFMAN_SERVICE_PATHS using the same syntax as the CLI, e.g.
+// "/email-dispatch/runtime/production,/shared/db/production".
+// CONFMAN_CHAMBER_COMPATIBLE is used the same way as in the CLI, defaulting
+// to false, but only applies to the returned Client.
+func NewFromEnvironment(ctx context.Context) (*Client, error) {
+	servicePaths := os.Getenv(EnvServicePaths)
+	if len(servicePaths) == 0 {
+		return nil, ErrNoServicePaths
+	}
+
+	// Unlike confman.DefaultOptions, which follows the package variable,
+	// the default is that of the CLI flag.
+	options := confman.Options{ChamberCompatible: false}
+	chamberCompatible := os.Getenv(EnvChamberCompatible)
+	if len(chamberCompatible) > 0 {
+		b, err := strconv.ParseBool(chamberCompatible)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", EnvChamberCompatible, err)
+		}
+		options.ChamberCompatible = b
+	}
+
+	logrusLog := logrus.New()
+	logrusLog.Level = logrus.WarnLevel
+	log := logger.LogrusWrapper{Logger: logrusLog}
+
+	backendConfig, err := backend.ConfigFromEnvironment()
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := backend.New(ctx, log, backendConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWithOptions(log, s, servicePaths, options), nil
+}
+
+// PopulateEnvironment reads the configuration of the service paths given in
+// CONFMAN_SERVICE_PATHS and sets it in the environment of the current
+// process, overwriting existing environment variables. See NewFromEnvironment
+// and Client.PopulateEnvironment for more control.
+func PopulateEnvironment(ctx context.Context) error {
+	c, err := NewFromEnvironment(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.PopulateEnvironment(ctx, PopulateEnvironmentInput{})
+	return err
+}
+
+// PopulateEnvironment reads the configuration of all service paths and sets
+// it in the environment of the current process. It returns the keys that
+// were set.
+func (c *Client) PopulateEnvironment(ctx context.Context, input PopulateEnvironmentInput) ([]string, error) {
+	if len(input.Overwrite) == 0 {
+		input.Overwrite = OverwriteAlways
+	}
+
+	switch input.Overwrite {
+	case OverwriteAlways, OverwriteNever, OverwriteError:
+	default:
+		return nil, fmt.Errorf("unknown overwrite policy '%s'", input.Overwrite)
+	}
+
+	for _, pattern := range append(input.Include, input.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+	}
+
+	config, err := c.ReadAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := mapy.Keys(config)
+	sort.Strings(keys)
+
+	setKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if !matchesAny(input.Include, key, true) || matchesAny(input.Exclude, key, false) {
+			c.log.Debugf("Skipping key %s", key)
+			continue
+		}
+
+		if _, exists := os.LookupEnv(key); exists {
+			switch input.Overwrite {
+			case OverwriteNever:
+				c.log.Debugf("Keeping existing env var %s", key)
+				continue
+			case OverwriteError:
+				return nil, fmt.Errorf("%w: %s", ErrEnvConflict, key)
+			}
+		}
+
+		setKeys = append(setKeys, key)
+	}
+
+	for _, key := range setKeys {
+		err := os.Setenv(key, config[key])
+		if err != nil {
+			return nil, fmt.Errorf("setting %s: %w", key, err)
+		}
+	}
+
+	return setKeys, nil
+}
+
+// matchesAny returns whether key matches any of the given patterns, or
+// matchEmpty if there are no patterns.
+func matchesAny(patterns []string, key string, matchEmpty bool) bool {
+	if len(patterns) == 0 {
+		return matchEmpty
+	}
+
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, key); matched {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,165 @@
+package client_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/micvbang/confman-go/pkg/confman"
+	"github.com/micvbang/confman-go/pkg/confman/client"
+	"github.com/micvbang/confman-go/pkg/storage"
+	"github.com/micvbang/confman-go/pkg/storage/backend"
+	"github.com/micvbang/confman-go/pkg/storage/sqlite"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPopulateEnvironment verifies that PopulateEnvironment sets the expected
+// environment variables given its overwrite policy and key filters.
+func TestPopulateEnvironment(t *testing.T) {
+	const servicePath = "/email-dispatch/runtime/production"
+	config := map[string]string{
+		"CONFMAN_TEST_DB_USER":     "user",
+		"CONFMAN_TEST_DB_PASSWORD": "password",
+		"CONFMAN_TEST_LOG_LEVEL":   "info",
+	}
+
+	tests := map[string]struct {
+		input       client.PopulateEnvironmentInput
+		existingEnv map[string]string
+		expectedEnv map[string]string
+		err         error
+	}{
+		"overwrite by default": {
+			input:       client.PopulateEnvironmentInput{},
+			existingEnv: map[string]string{"CONFMAN_TEST_LOG_LEVEL": "debug"},
+			expectedEnv: config,
+		},
+		"overwrite never": {
+			input:       client.PopulateEnvironmentInput{Overwrite: client.OverwriteNever},
+			existingEnv: map[string]string{"CONFMAN_TEST_LOG_LEVEL": "debug"},
+			expectedEnv: map[string]string{
+				"CONFMAN_TEST_DB_USER":     "user",
+				"CONFMAN_TEST_DB_PASSWORD": "password",
+				"CONFMAN_TEST_LOG_LEVEL":   "debug",
+			},
+		},
+		"overwrite error": {
+			input:       client.PopulateEnvironmentInput{Overwrite: client.OverwriteError},
+			existingEnv: map[string]string{"CONFMAN_TEST_LOG_LEVEL": "debug"},
+			expectedEnv: map[string]string{"CONFMAN_TEST_LOG_LEVEL": "debug"},
+			err:         client.ErrEnvConflict,
+		},
+		"include and exclude": {
+			input: client.PopulateEnvironmentInput{
+				Include: []string{"CONFMAN_TEST_DB_*"},
+				Exclude: []string{"*PASSWORD"},
+			},
+			expectedEnv: map[string]string{"CONFMAN_TEST_DB_USER": "user"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			for key := range config {
+				t.Setenv(key, "")
+				os.Unsetenv(key)
+			}
+			for key, value := range test.existingEnv {
+				t.Setenv(key, value)
+			}
+
+			s := &storage.MockStorage{}
+			s.On("ReadAll", ctx, servicePath).Return(config, nil)
+
+			c := client.NewWithOptions(log, s, servicePath, confman.Options{})
+			_, err := c.PopulateEnvironment(ctx, test.input)
+			require.ErrorIs(t, err, test.err)
+
+			for key := range config {
+				value, exists := os.LookupEnv(key)
+				expectedValue, expectedExists := test.expectedEnv[key]
+				require.Equal(t, expectedExists, exists, key)
+				require.Equal(t, expectedValue, value, key)
+			}
+		})
+	}
+}
+
+// TestNewFromEnvironmentNoServicePaths verifies that NewFromEnvironment
+// returns an error when no service paths are given.
+func TestNewFromEnvironmentNoServicePaths(t *testing.T) {
+	t.Setenv(client.EnvServicePaths, "")
+
+	_, err := client.NewFromEnvironment(context.Background())
+	require.ErrorIs(t, err, client.ErrNoServicePaths)
+}
+
+// TestNewFromEnvironment verifies that NewFromEnvironment reads from the
+// storage selected by the environment variables of the CLI, and that
+// CONFMAN_CHAMBER_COMPATIBLE defaults to false as in the CLI and only applies
+// to the returned client.
+func TestNewFromEnvironment(t *testing.T) {
+	ctx := context.Background()
+	const servicePath = "/email-dispatch/runtime/production"
+	config := sqlite.Config{
+		Path:    filepath.Join(t.TempDir(), "confman.db"),
+		KeyFile: filepath.Join(t.TempDir(), "confman.key"),
+	}
+
+	// Keys are stored in lower case, which chamber compatibility reads in
+	// upper case.
+	s, err := sqlite.New(log, config)
+	require.NoError(t, err)
+	require.NoError(t, s.WriteKeys(ctx, servicePath, map[string]string{"db_host": "db"}))
+	require.NoError(t, s.Close())
+
+	tests := map[string]struct {
+		chamberCompatible *string
+		expected          map[string]string
+	}{
+		"unset": {
+			chamberCompatible: nil,
+			expected:          map[string]string{"db_host": "db"},
+		},
+		"false": {
+			chamberCompatible: stringPtr("false"),
+			expected:          map[string]string{"db_host": "db"},
+		},
+		"true": {
+			chamberCompatible: stringPtr("true"),
+			expected:          map[string]string{"DB_HOST": "db"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(client.EnvServicePaths, servicePath)
+			t.Setenv(client.EnvChamberCompatible, "")
+			if test.chamberCompatible != nil {
+				t.Setenv(client.EnvChamberCompatible, *test.chamberCompatible)
+			} else {
+				os.Unsetenv(client.EnvChamberCompatible)
+			}
+			t.Setenv(backend.EnvStorage, backend.SQLite)
+			t.Setenv(backend.EnvSQLitePath, config.Path)
+			t.Setenv(backend.EnvSQLiteKeyFile, config.KeyFile)
+			t.Setenv(backend.EnvEncryption, "")
+
+			chamberCompatible := confman.ChamberCompatible
+			c, err := client.NewFromEnvironment(ctx)
+			require.NoError(t, err)
+			require.Equal(t, chamberCompatible, confman.ChamberCompatible)
+
+			got, err := c.ReadAll(ctx)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, got)
+		})
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,250 @@
+package client
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	tagName        = "confman"
+	tagNameDefault = "default"
+	tagRequired    = "required"
+)
+
+var (
+	ErrInvalidTarget = errors.New("target must be a non-nil pointer to a struct")
+	ErrMissingKey    = errors.New("required key is missing")
+)
+
+// FieldError describes a struct field that could not be set.
+type FieldError struct {
+	Field string
+	Key   string
+	Err   error
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s (%s): %s", e.Key, e.Field, e.Err)
+}
+
+func (e FieldError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError holds all errors that occurred while loading configuration
+// into a struct.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+
+	return fmt.Sprintf("invalid configuration: %s", strings.Join(msgs, "; "))
+}
+
+// Is makes it possible to use errors.Is on the individual field errors.
+func (e ValidationError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// As makes it possible to use errors.As on the individual field errors,
+// finding the first field error that matches target.
+func (e ValidationError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	urlType             = reflect.TypeOf(url.URL{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Unmarshal sets the fields of the struct pointed to by v using the values in
+// config. Fields are mapped to keys using struct tags, e.g.
+//
+//	type Config struct {
+//		Port    int           `confman:"DB_PORT,required" default:"5432"`
+//		Timeout time.Duration `confman:"TIMEOUT" default:"5s"`
+//		Hosts   []string      `confman:"HOSTS"`
+//		API     *url.URL      `confman:"API_URL,required"`
+//		DB      DBConfig      // nested structs are traversed
+//	}
+//
+// Fields without a confman tag are ignored, unless they are structs. Slices
+// are parsed from comma separated values. Errors for all fields are returned
+// together as a ValidationError.
+func Unmarshal(config map[string]string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return ErrInvalidTarget
+	}
+
+	fieldErrors := unmarshalStruct(config, rv.Elem(), "")
+	if len(fieldErrors) > 0 {
+		return ValidationError{Errors: fieldErrors}
+	}
+
+	return nil
+}
+
+func unmarshalStruct(config map[string]string, rv reflect.Value, fieldPrefix string) []FieldError {
+	fieldErrors := []FieldError{}
+
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if len(field.PkgPath) > 0 {
+			// Unexported field
+			continue
+		}
+
+		fieldName := fieldPrefix + field.Name
+		fv := rv.Field(i)
+
+		tag, hasTag := field.Tag.Lookup(tagName)
+		if !hasTag || tag == "-" {
+			if field.Type.Kind() == reflect.Struct && field.Type != urlType {
+				fieldErrors = append(fieldErrors, unmarshalStruct(config, fv, fieldName+".")...)
+			}
+			continue
+		}
+
+		key, required := parseTag(tag)
+		value, exists := config[key]
+		if !exists {
+			value, exists = field.Tag.Lookup(tagNameDefault)
+		}
+
+		if !exists {
+			if required {
+				fieldErrors = append(fieldErrors, FieldError{Field: fieldName, Key: key, Err: ErrMissingKey})
+			}
+			continue
+		}
+
+		err := setValue(fv, value)
+		if err != nil {
+			fieldErrors = append(fieldErrors, FieldError{Field: fieldName, Key: key, Err: err})
+		}
+	}
+
+	return fieldErrors
+}
+
+func parseTag(tag string) (key string, required bool) {
+	parts := strings.Split(tag, ",")
+	for _, option := range parts[1:] {
+		if strings.TrimSpace(option) == tagRequired {
+			required = true
+		}
+	}
+
+	return strings.TrimSpace(parts[0]), required
+}
+
+func setValue(fv reflect.Value, value string) error {
+	if fv.CanAddr() && fv.Addr().Type().Implements(textUnmarshalerType) {
+		return fv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+
+	switch fv.Type() {
+	case durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+
+	case urlType:
+		u, err := url.Parse(value)
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(*u))
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(i)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(u)
+
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+
+	case reflect.Ptr:
+		ptr := reflect.New(fv.Type().Elem())
+		err := setValue(ptr.Elem(), value)
+		if err != nil {
+			return err
+		}
+		fv.Set(ptr)
+
+	case reflect.Slice:
+		values := []string{}
+		if len(strings.TrimSpace(value)) > 0 {
+			values = strings.Split(value, ",")
+		}
+
+		slice := reflect.MakeSlice(fv.Type(), len(values), len(values))
+		for i, v := range values {
+			err := setValue(slice.Index(i), strings.TrimSpace(v))
+			if err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+		}
+		fv.Set(slice)
+
+	default:
+		return fmt.Errorf("unsupported type %s", fv.Type())
+	}
+
+	return nil
+}
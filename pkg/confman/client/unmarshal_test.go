@@ -0,0 +1,130 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/micvbang/confman-go/pkg/confman"
+	"github.com/micvbang/confman-go/pkg/confman/client"
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/storage"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+var log = logger.LogrusWrapper{Logger: logrus.New()}
+
+type dbConfig struct {
+	Host string `confman:"DB_HOST,required"`
+	Port int    `confman:"DB_PORT" default:"5432"`
+}
+
+type serviceConfig struct {
+	DB         dbConfig
+	Debug      bool          `confman:"DEBUG"`
+	Timeout    time.Duration `confman:"TIMEOUT" default:"5s"`
+	Hosts      []string      `confman:"HOSTS"`
+	Ports      []uint16      `confman:"PORTS"`
+	API        url.URL       `confman:"API_URL"`
+	Callback   *url.URL      `confman:"CALLBACK_URL"`
+	Ratio      float64       `confman:"RATIO"`
+	Optional   *int          `confman:"OPTIONAL"`
+	Ignored    string
+	unexported string `confman:"UNEXPORTED"`
+}
+
+// TestUnmarshal verifies that values are converted to the types of the
+// tagged fields, that defaults are used for missing keys, and that nested
+// structs are traversed.
+func TestUnmarshal(t *testing.T) {
+	config := map[string]string{
+		"DB_HOST":      "db.example.com",
+		"DEBUG":        "true",
+		"HOSTS":        "a, b,c",
+		"PORTS":        "80,443",
+		"API_URL":      "https://example.com/api",
+		"CALLBACK_URL": "https://example.com/callback",
+		"RATIO":        "0.5",
+		"UNEXPORTED":   "ignored",
+	}
+
+	got := serviceConfig{}
+	err := client.Unmarshal(config, &got)
+	require.NoError(t, err)
+
+	require.Equal(t, "db.example.com", got.DB.Host)
+	require.Equal(t, 5432, got.DB.Port)
+	require.True(t, got.Debug)
+	require.Equal(t, 5*time.Second, got.Timeout)
+	require.Equal(t, []string{"a", "b", "c"}, got.Hosts)
+	require.Equal(t, []uint16{80, 443}, got.Ports)
+	require.Equal(t, "example.com", got.API.Host)
+	require.Equal(t, "/callback", got.Callback.Path)
+	require.Equal(t, 0.5, got.Ratio)
+	require.Nil(t, got.Optional)
+	require.Empty(t, got.Ignored)
+	require.Empty(t, got.unexported)
+}
+
+// TestUnmarshalAggregatesErrors verifies that errors for all invalid fields
+// are returned together.
+func TestUnmarshalAggregatesErrors(t *testing.T) {
+	config := map[string]string{
+		"DB_PORT": "not a port",
+		"TIMEOUT": "10",
+		"PORTS":   "80,99999",
+	}
+
+	got := serviceConfig{}
+	err := client.Unmarshal(config, &got)
+
+	validationErr := client.ValidationError{}
+	require.True(t, errors.As(err, &validationErr))
+	require.ErrorIs(t, err, client.ErrMissingKey)
+
+	fieldErr := client.FieldError{}
+	require.True(t, errors.As(err, &fieldErr))
+	require.Equal(t, "DB_HOST", fieldErr.Key)
+
+	keys := []string{}
+	for _, fieldErr := range validationErr.Errors {
+		keys = append(keys, fieldErr.Key)
+	}
+	require.Equal(t, []string{"DB_HOST", "DB_PORT", "TIMEOUT", "PORTS"}, keys)
+}
+
+// TestUnmarshalInvalidTarget verifies that Unmarshal rejects targets that
+// aren't pointers to structs.
+func TestUnmarshalInvalidTarget(t *testing.T) {
+	config := map[string]string{}
+
+	require.ErrorIs(t, client.Unmarshal(config, serviceConfig{}), client.ErrInvalidTarget)
+	require.ErrorIs(t, client.Unmarshal(config, (*serviceConfig)(nil)), client.ErrInvalidTarget)
+	require.ErrorIs(t, client.Unmarshal(config, &config), client.ErrInvalidTarget)
+}
+
+// TestClientLoad verifies that Load merges the configuration of all service
+// paths, with later service paths taking precedence.
+func TestClientLoad(t *testing.T) {
+	ctx := context.Background()
+
+	s := &storage.MockStorage{}
+	s.On("ReadAll", ctx, "/shared/db/production").Return(map[string]string{
+		"DB_HOST": "db.example.com",
+		"DB_PORT": "1234",
+	}, nil)
+	s.On("ReadAll", ctx, "/email-dispatch/runtime/production").Return(map[string]string{
+		"DB_PORT": "4321",
+	}, nil)
+	defer s.AssertExpectations(t)
+
+	c := client.NewWithOptions(log, s, "/shared/db/production,/email-dispatch/runtime/production", confman.Options{})
+
+	got := dbConfig{}
+	err := c.Load(ctx, &got)
+	require.NoError(t, err)
+	require.Equal(t, dbConfig{Host: "db.example.com", Port: 4321}, got)
+}
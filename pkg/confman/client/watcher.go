@@ -0,0 +1,388 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/micvbang/confman-go/pkg/confman"
+	"github.com/micvbang/confman-go/pkg/storage"
+)
+
+const defaultWatchMaxBackoff = 5 * time.Minute
+
+var (
+	ErrInvalidInterval = errors.New("watch interval must be positive and at most the max backoff")
+	ErrInvalidJitter   = errors.New("watch jitter must be between 0 and 1")
+)
+
+type ChangeType string
+
+const (
+	ChangeAdded   ChangeType = "added"
+	ChangeUpdated ChangeType = "updated"
+	ChangeDeleted ChangeType = "deleted"
+)
+
+// Change describes a change of a single key.
+type Change struct {
+	ServicePath string
+	Key         string
+	Type        ChangeType
+
+	// OldValue is empty for added keys.
+	OldValue string
+
+	// NewValue is empty for deleted keys.
+	NewValue string
+}
+
+// Watcher polls the versions of the keys of the client's service paths, and
+// reports changes of keys whose version changed. Only the values of these
+// keys are read, if the storage can read versions without values (see
+// storage.Versioner); otherwise the metadata of the service paths, which
+// includes values, is read in every poll.
+//
+// NOTE: since changes are detected using the metadata of the keys on the
+// watched service paths, changes to keys that are referenced from the watched
+// service paths are not detected.
+type Watcher struct {
+	// Interval between polls, given to NewWatcher.
+	Interval time.Duration
+
+	// MaxBackoff is the maximum interval between polls when polling fails.
+	// The interval is doubled for every consecutive failure. Defaults to 5
+	// minutes, or Interval if it is longer.
+	MaxBackoff time.Duration
+
+	// Jitter randomly changes each interval between polls by up to the given
+	// fraction of it, e.g. 0.1 for up to 10% shorter or longer intervals,
+	// such that many watchers started at the same time don't poll storage at
+	// the same time. Must be between 0 and 1, defaults to 0.
+	Jitter float64
+
+	// OnError, if set, is called with errors that occur while polling.
+	OnError func(error)
+
+	// Raw makes the watcher report values as they are stored, i.e. without
+	// resolving references to other keys.
+	Raw bool
+
+	client   *Client
+	versions map[string]map[string]string
+
+	mu     sync.Mutex
+	values map[string]map[string]string
+}
+
+// NewWatcher returns a Watcher for the client's service paths, polling with
+// the given interval. It returns ErrInvalidInterval unless interval is
+// positive.
+func (c *Client) NewWatcher(interval time.Duration) (*Watcher, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidInterval, interval)
+	}
+
+	maxBackoff := defaultWatchMaxBackoff
+	if maxBackoff < interval {
+		maxBackoff = interval
+	}
+
+	return &Watcher{
+		Interval:   interval,
+		MaxBackoff: maxBackoff,
+		client:     c,
+	}, nil
+}
+
+// Init reads the current state of the service paths, which is returned by
+// Values and which later changes are reported relative to. It is called by
+// Watch if it hasn't been called already.
+func (w *Watcher) Init(ctx context.Context) error {
+	_, err := w.poll(ctx)
+	return err
+}
+
+// Watch polls for changes until ctx is cancelled, calling onChange with the
+// changes found in each poll. Unless Init has been called, the current state
+// of the service paths is read before Watch starts polling; if this fails,
+// the error is returned immediately. Otherwise, Watch returns ctx.Err() when
+// ctx is cancelled.
+func (w *Watcher) Watch(ctx context.Context, onChange func([]Change)) error {
+	if w.Interval <= 0 || w.MaxBackoff < w.Interval {
+		return fmt.Errorf("%w: interval %s, max backoff %s", ErrInvalidInterval, w.Interval, w.MaxBackoff)
+	}
+	if w.Jitter < 0 || w.Jitter > 1 {
+		return fmt.Errorf("%w: %v", ErrInvalidJitter, w.Jitter)
+	}
+
+	if w.versions == nil {
+		err := w.Init(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	interval := w.Interval
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(w.jitter(interval)):
+		}
+
+		changes, err := w.poll(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			if w.OnError != nil {
+				w.OnError(err)
+			}
+			w.client.log.Warnf("Polling for changes failed: %s", err)
+
+			interval *= 2
+			if interval > w.MaxBackoff {
+				interval = w.MaxBackoff
+			}
+			continue
+		}
+		interval = w.Interval
+
+		if len(changes) > 0 {
+			onChange(changes)
+		}
+	}
+}
+
+// jitter returns interval randomly changed by up to w.Jitter of it.
+func (w *Watcher) jitter(interval time.Duration) time.Duration {
+	if w.Jitter <= 0 {
+		return interval
+	}
+
+	return interval + time.Duration((rand.Float64()*2-1)*w.Jitter*float64(interval))
+}
+
+// Changes starts Watch in a new goroutine and returns a channel on which
+// changes are delivered. The channel is closed when ctx is cancelled or
+// reading the current state of the service paths fails.
+func (w *Watcher) Changes(ctx context.Context) <-chan []Change {
+	changesChan := make(chan []Change)
+
+	go func() {
+		defer close(changesChan)
+
+		err := w.Watch(ctx, func(changes []Change) {
+			select {
+			case changesChan <- changes:
+			case <-ctx.Done():
+			}
+		})
+		if err != nil && ctx.Err() == nil {
+			if w.OnError != nil {
+				w.OnError(err)
+			}
+			w.client.log.Errorf("Watching for changes failed: %s", err)
+		}
+	}()
+
+	return changesChan
+}
+
+// Values returns the values of the watched service paths as they were in
+// the latest successful poll.
+func (w *Watcher) Values() map[string]map[string]string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	values := make(map[string]map[string]string, len(w.values))
+	for servicePath, config := range w.values {
+		values[servicePath] = make(map[string]string, len(config))
+		for key, value := range config {
+			values[servicePath][key] = value
+		}
+	}
+
+	return values
+}
+
+// poll returns the changes since the last poll. State is only updated when
+// all service paths were read successfully.
+func (w *Watcher) poll(ctx context.Context) ([]Change, error) {
+	c := w.client
+
+	newVersions := make(map[string]map[string]string, len(c.servicePaths))
+	newValues := make(map[string]map[string]string, len(c.servicePaths))
+	changes := []Change{}
+
+	for _, servicePath := range c.servicePaths {
+		var cm confman.Confman
+		if w.Raw {
+			cm = confman.NewWithOptions(c.log, c.storage, servicePath, c.options)
+		} else {
+			cm = confman.NewResolvingWithOptions(c.log, c.storage, servicePath, c.options)
+		}
+		servicePath = cm.ServicePath()
+
+		oldVersions := w.versions[servicePath]
+		oldValues := w.values[servicePath]
+		versions, values, err := w.read(ctx, cm, oldVersions, oldValues)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", servicePath, err)
+		}
+
+		for key := range versions {
+			oldVersion, exists := oldVersions[key]
+			if exists && oldVersion == versions[key] {
+				continue
+			}
+
+			oldValue, exists := oldValues[key]
+			switch {
+			case !exists:
+				changes = append(changes, Change{ServicePath: servicePath, Key: key, Type: ChangeAdded, NewValue: values[key]})
+			case oldValue != values[key]:
+				changes = append(changes, Change{ServicePath: servicePath, Key: key, Type: ChangeUpdated, OldValue: oldValue, NewValue: values[key]})
+			}
+		}
+
+		for key, oldValue := range oldValues {
+			if _, exists := versions[key]; !exists {
+				changes = append(changes, Change{ServicePath: servicePath, Key: key, Type: ChangeDeleted, OldValue: oldValue})
+			}
+		}
+
+		newVersions[servicePath] = versions
+		newValues[servicePath] = values
+	}
+
+	// The first poll establishes the current state
+	if w.versions == nil {
+		changes = []Change{}
+	}
+
+	w.mu.Lock()
+	w.versions = newVersions
+	w.values = newValues
+	w.mu.Unlock()
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].ServicePath != changes[j].ServicePath {
+			return changes[i].ServicePath < changes[j].ServicePath
+		}
+		return changes[i].Key < changes[j].Key
+	})
+
+	return changes, nil
+}
+
+// read returns the versions and values of the keys of cm. Values of keys
+// whose version is unchanged since oldVersions are taken from oldValues.
+func (w *Watcher) read(ctx context.Context, cm confman.Confman, oldVersions map[string]string, oldValues map[string]string) (map[string]string, map[string]string, error) {
+	versioner, ok := storage.Find[storage.Versioner](w.client.storage)
+	if !ok {
+		return w.readMetadata(ctx, cm, oldVersions, oldValues)
+	}
+
+	versions, err := versioner.ReadVersions(ctx, cm.ServicePath())
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading versions: %w", err)
+	}
+
+	// Keys are read in upper case when chamber compatible, see
+	// storage.ChamberCompatibility.
+	_, chamberCompatible := storage.Find[*storage.ChamberCompatibility](w.client.storage)
+	if chamberCompatible || w.client.options.ChamberCompatible {
+		upperVersions := make(map[string]string, len(versions))
+		for key, version := range versions {
+			upperVersions[strings.ToUpper(key)] = version
+		}
+		versions = upperVersions
+	}
+
+	values := make(map[string]string, len(versions))
+	changedKeys := []string{}
+	for key, version := range versions {
+		oldVersion, exists := oldVersions[key]
+		if exists && oldVersion == version {
+			values[key] = oldValues[key]
+			continue
+		}
+		changedKeys = append(changedKeys, key)
+	}
+
+	if len(changedKeys) == 0 {
+		return versions, values, nil
+	}
+
+	var config map[string]string
+	if oldVersions == nil {
+		config, err = cm.ReadAll(ctx)
+	} else {
+		sort.Strings(changedKeys)
+		config, err = cm.ReadKeys(ctx, changedKeys)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, key := range changedKeys {
+		value, exists := config[key]
+		if !exists {
+			// Deleted since reading versions; picked up by the next poll.
+			delete(versions, key)
+			continue
+		}
+		values[key] = value
+	}
+
+	return versions, values, nil
+}
+
+// readMetadata returns the versions and values of the keys of cm using their
+// metadata, which includes values. Values of keys whose version is unchanged
+// since oldVersions are taken from oldValues.
+func (w *Watcher) readMetadata(ctx context.Context, cm confman.Confman, oldVersions map[string]string, oldValues map[string]string) (map[string]string, map[string]string, error) {
+	keyMetadata, err := cm.ReadAllMetadata(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading metadata: %w", err)
+	}
+
+	versions := make(map[string]string, len(keyMetadata))
+	values := make(map[string]string, len(keyMetadata))
+	for _, keyMeta := range keyMetadata {
+		versions[keyMeta.Key] = keyVersion(keyMeta)
+
+		oldVersion, exists := oldVersions[keyMeta.Key]
+		if exists && oldVersion == versions[keyMeta.Key] {
+			values[keyMeta.Key] = oldValues[keyMeta.Key]
+			continue
+		}
+
+		// The metadata holds the resolved value already
+		values[keyMeta.Key] = keyMeta.Value
+	}
+
+	return versions, values, nil
+}
+
+// keyVersion returns a string identifying the version of a key, using the
+// most precise metadata available from the storage.
+func keyVersion(keyMeta storage.KeyMetadata) string {
+	if version := keyMeta.Metadata["version"]; len(version) > 0 {
+		return version
+	}
+
+	if lastModified := keyMeta.Metadata["last_modified_date"]; len(lastModified) > 0 {
+		return lastModified
+	}
+
+	return keyMeta.Value
+}
@@ -0,0 +1,171 @@
+package client_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micvbang/confman-go/pkg/confman"
+	"github.com/micvbang/confman-go/pkg/confman/client"
+	"github.com/micvbang/confman-go/pkg/storage"
+	"github.com/micvbang/confman-go/pkg/storage/memory"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWatcherChanges verifies that added, updated and deleted keys are
+// reported, and that writing an unchanged value is not reported.
+func TestWatcherChanges(t *testing.T) {
+	const servicePath = "/service/env"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := memory.New(log)
+	err := s.WriteKeys(ctx, servicePath, map[string]string{
+		"UNCHANGED": "value",
+		"UPDATED":   "old value",
+		"DELETED":   "value",
+	})
+	require.NoError(t, err)
+
+	w, err := client.NewWithOptions(log, s, servicePath, confman.Options{}).NewWatcher(5 * time.Millisecond)
+	require.NoError(t, err)
+
+	// Make sure that the initial state has been read before changing
+	// anything.
+	changesChan := w.Changes(ctx)
+	require.Eventually(t, func() bool {
+		return len(w.Values()[servicePath]) == 3
+	}, time.Second, time.Millisecond)
+
+	err = s.WriteKeys(ctx, servicePath, map[string]string{
+		"UNCHANGED": "value",
+		"UPDATED":   "new value",
+		"ADDED":     "value",
+	})
+	require.NoError(t, err)
+	err = s.Delete(ctx, servicePath, "DELETED")
+	require.NoError(t, err)
+
+	expected := []client.Change{
+		{ServicePath: servicePath, Key: "ADDED", Type: client.ChangeAdded, NewValue: "value"},
+		{ServicePath: servicePath, Key: "DELETED", Type: client.ChangeDeleted, OldValue: "value"},
+		{ServicePath: servicePath, Key: "UPDATED", Type: client.ChangeUpdated, OldValue: "old value", NewValue: "new value"},
+	}
+
+	got := []client.Change{}
+	for len(got) < len(expected) {
+		select {
+		case changes := <-changesChan:
+			got = append(got, changes...)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for changes, got %v", got)
+		}
+	}
+
+	// Changes may be split across polls; compare without ordering.
+	require.ElementsMatch(t, expected, got)
+	require.Equal(t, map[string]string{"UNCHANGED": "value", "UPDATED": "new value", "ADDED": "value"}, w.Values()[servicePath])
+}
+
+// TestWatcherReadsMetadataOnly verifies that values are taken from the
+// metadata, with references resolved unless Raw is set, instead of being read
+// once more.
+func TestWatcherReadsMetadataOnly(t *testing.T) {
+	ctx := context.Background()
+	const servicePath = "/service/env"
+
+	s := &storage.MockStorage{}
+	s.On("ReadAllMetadata", ctx, servicePath).Return([]storage.KeyMetadata{
+		{Key: "HOST", Value: "db", Metadata: map[string]string{"version": "1"}},
+		{Key: "URL", Value: "postgres://${HOST}", Metadata: map[string]string{"version": "3"}},
+	}, nil).Once()
+	defer s.AssertExpectations(t)
+
+	w, err := client.NewWithOptions(log, s, servicePath, confman.Options{}).NewWatcher(time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, w.Init(ctx))
+	require.Equal(t, map[string]string{"HOST": "db", "URL": "postgres://db"}, w.Values()[servicePath])
+
+	s.On("ReadAllMetadata", ctx, servicePath).Return([]storage.KeyMetadata{
+		{Key: "URL", Value: "postgres://${HOST}", Metadata: map[string]string{"version": "3"}},
+	}, nil).Once()
+
+	w, err = client.NewWithOptions(log, s, servicePath, confman.Options{}).NewWatcher(time.Minute)
+	require.NoError(t, err)
+	w.Raw = true
+	require.NoError(t, w.Init(ctx))
+	require.Equal(t, map[string]string{"URL": "postgres://${HOST}"}, w.Values()[servicePath])
+}
+
+// versionedStorage is a MockStorage implementing storage.Versioner.
+type versionedStorage struct {
+	*storage.MockStorage
+}
+
+func (s versionedStorage) ReadVersions(ctx context.Context, servicePath string) (map[string]string, error) {
+	args := s.Called(ctx, servicePath)
+	return args.Get(0).(map[string]string), args.Error(1)
+}
+
+// TestWatcherReadsChangedKeysOnly verifies that, when storage can read
+// versions without values, only the values of keys whose version changed are
+// read.
+func TestWatcherReadsChangedKeysOnly(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	const servicePath = "/service/env"
+
+	s := versionedStorage{MockStorage: &storage.MockStorage{}}
+	s.On("ReadVersions", mock.Anything, servicePath).Return(map[string]string{"HOST": "1", "PORT": "1", "USER": "1"}, nil).Once()
+	s.On("ReadAll", mock.Anything, servicePath).Return(map[string]string{"HOST": "db", "PORT": "5432", "USER": "app"}, nil).Once()
+	s.On("ReadVersions", mock.Anything, servicePath).Return(map[string]string{"HOST": "2", "PORT": "1", "NAME": "1"}, nil).Once()
+	s.On("ReadKeys", mock.Anything, servicePath, []string{"HOST", "NAME"}).Return(map[string]string{"HOST": "new-db", "NAME": "confman"}, nil).Once()
+	defer s.AssertExpectations(t)
+
+	w, err := client.NewWithOptions(log, s, servicePath, confman.Options{}).NewWatcher(time.Millisecond)
+	require.NoError(t, err)
+	require.NoError(t, w.Init(ctx))
+	require.Equal(t, map[string]string{"HOST": "db", "PORT": "5432", "USER": "app"}, w.Values()[servicePath])
+
+	var changes []client.Change
+	err = w.Watch(ctx, func(cs []client.Change) {
+		changes = cs
+		cancel()
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, []client.Change{
+		{ServicePath: servicePath, Key: "HOST", Type: client.ChangeUpdated, OldValue: "db", NewValue: "new-db"},
+		{ServicePath: servicePath, Key: "NAME", Type: client.ChangeAdded, NewValue: "confman"},
+		{ServicePath: servicePath, Key: "USER", Type: client.ChangeDeleted, OldValue: "app"},
+	}, changes)
+	require.Equal(t, map[string]string{"HOST": "new-db", "PORT": "5432", "NAME": "confman"}, w.Values()[servicePath])
+}
+
+// TestWatcherInvalidInterval verifies that intervals that would make the
+// watcher poll continuously are rejected.
+func TestWatcherInvalidInterval(t *testing.T) {
+	c := client.NewWithOptions(log, memory.New(log), "/service/env", confman.Options{})
+
+	_, err := c.NewWatcher(0)
+	require.ErrorIs(t, err, client.ErrInvalidInterval)
+
+	w, err := c.NewWatcher(time.Minute)
+	require.NoError(t, err)
+	w.MaxBackoff = 0
+	require.ErrorIs(t, w.Watch(context.Background(), func([]client.Change) {}), client.ErrInvalidInterval)
+}
+
+// TestWatcherInvalidJitter verifies that jitter outside of [0, 1], which
+// could make intervals negative, is rejected.
+func TestWatcherInvalidJitter(t *testing.T) {
+	c := client.NewWithOptions(log, memory.New(log), "/service/env", confman.Options{})
+
+	for _, jitter := range []float64{-0.1, 1.5} {
+		w, err := c.NewWatcher(time.Minute)
+		require.NoError(t, err)
+		w.Jitter = jitter
+		require.ErrorIs(t, w.Watch(context.Background(), func([]client.Change) {}), client.ErrInvalidJitter)
+	}
+}
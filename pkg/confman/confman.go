@@ -17,11 +17,24 @@ type Confman interface {
 	Write(ctx context.Context, key string, value string) error
 	WriteKeys(ctx context.Context, config map[string]string) error
 
+	// WriteKeysWithOptions writes config with the options of each key given
+	// by options. Options are ignored by storage that doesn't support them.
+	WriteKeysWithOptions(ctx context.Context, config map[string]string, options map[string]storage.WriteOptions) error
+
+	// ValidateKeys returns all violations of the rules of the storage, e.g.
+	// allowed characters of keys and sizes of values, by writing config with
+	// options.
+	ValidateKeys(ctx context.Context, config map[string]string, options map[string]storage.WriteOptions) ([]storage.Violation, error)
+
 	Read(ctx context.Context, key string) (value string, _ error)
 	ReadKeys(ctx context.Context, keys []string) (map[string]string, error)
 	ReadAll(ctx context.Context) (map[string]string, error)
 	ReadAllMetadata(ctx context.Context) ([]storage.KeyMetadata, error)
 
+	// ReadTags returns the tags of keys that have any, or
+	// storage.ErrTagsUnsupported if the storage doesn't support tags.
+	ReadTags(ctx context.Context) (map[string]map[string]string, error)
+
 	Delete(ctx context.Context, key string) error
 	DeleteKeys(ctx context.Context, keys []string) error
 	DeleteAll(ctx context.Context) error
@@ -45,16 +58,40 @@ type Confman interface {
 	String() string
 }
 
+// ChamberCompatible is the default of Options.ChamberCompatible, used by New
+// and NewResolving.
 var ChamberCompatible bool = true
 
+// Options configure a Confman.
+type Options struct {
+	// ChamberCompatible makes Confman read and write keys the way chamber
+	// does.
+	ChamberCompatible bool
+}
+
+// DefaultOptions returns the options used by New and NewResolving, given by
+// the package variables.
+func DefaultOptions() Options {
+	return Options{
+		ChamberCompatible: ChamberCompatible,
+	}
+}
+
 type confman struct {
 	log         logger.Logger
 	storage     storage.Storage
 	servicePath string
 }
 
+// New returns a Confman for the given service path using DefaultOptions.
 func New(log logger.Logger, s storage.Storage, servicePath string) Confman {
-	if ChamberCompatible {
+	return NewWithOptions(log, s, servicePath, DefaultOptions())
+}
+
+// NewWithOptions returns a Confman for the given service path using options
+// instead of the package variables.
+func NewWithOptions(log logger.Logger, s storage.Storage, servicePath string, options Options) Confman {
+	if options.ChamberCompatible {
 		s = storage.NewChamberCompatibility(log, s)
 	}
 
@@ -73,6 +110,14 @@ func (c *confman) WriteKeys(ctx context.Context, config map[string]string) error
 	return c.storage.WriteKeys(ctx, c.servicePath, config)
 }
 
+func (c *confman) WriteKeysWithOptions(ctx context.Context, config map[string]string, options map[string]storage.WriteOptions) error {
+	return storage.WriteKeysWithOptions(ctx, c.storage, c.servicePath, config, options)
+}
+
+func (c *confman) ValidateKeys(ctx context.Context, config map[string]string, options map[string]storage.WriteOptions) ([]storage.Violation, error) {
+	return storage.ValidateKeys(ctx, c.storage, c.servicePath, config, options)
+}
+
 func (c *confman) Read(ctx context.Context, key string) (value string, _ error) {
 	return c.storage.Read(ctx, c.servicePath, key)
 }
@@ -104,6 +149,10 @@ func (c *confman) ReadAllMetadata(ctx context.Context) ([]storage.KeyMetadata, e
 	return keyMetadata, nil
 }
 
+func (c *confman) ReadTags(ctx context.Context) (map[string]map[string]string, error) {
+	return storage.ReadTags(ctx, c.storage, c.servicePath)
+}
+
 func (c *confman) Move(ctx context.Context, dst Confman) error {
 	c.log.Debugf("Attempting to move %v to %v", c, dst)
 
@@ -273,3 +273,63 @@ func (_m *MockConfman) WriteKeys(ctx context.Context, config map[string]string)
 
 	return r0
 }
+
+// WriteKeysWithOptions provides a mock function with given fields: ctx, config, options
+func (_m *MockConfman) WriteKeysWithOptions(ctx context.Context, config map[string]string, options map[string]storage.WriteOptions) error {
+	ret := _m.Called(ctx, config, options)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, map[string]string, map[string]storage.WriteOptions) error); ok {
+		r0 = rf(ctx, config, options)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ReadTags provides a mock function with given fields: ctx
+func (_m *MockConfman) ReadTags(ctx context.Context) (map[string]map[string]string, error) {
+	ret := _m.Called(ctx)
+
+	var r0 map[string]map[string]string
+	if rf, ok := ret.Get(0).(func(context.Context) map[string]map[string]string); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]map[string]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ValidateKeys provides a mock function with given fields: ctx, config, options
+func (_m *MockConfman) ValidateKeys(ctx context.Context, config map[string]string, options map[string]storage.WriteOptions) ([]storage.Violation, error) {
+	ret := _m.Called(ctx, config, options)
+
+	var r0 []storage.Violation
+	if rf, ok := ret.Get(0).(func(context.Context, map[string]string, map[string]storage.WriteOptions) []storage.Violation); ok {
+		r0 = rf(ctx, config, options)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]storage.Violation)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, map[string]string, map[string]storage.WriteOptions) error); ok {
+		r1 = rf(ctx, config, options)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
@@ -0,0 +1,266 @@
+package confman
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/storage"
+)
+
+var (
+	ErrReferenceNotFound = errors.New("referenced key not found")
+	ErrReferenceCycle    = errors.New("reference cycle")
+	ErrReferenceInvalid  = errors.New("invalid reference")
+)
+
+// resolvingConfman wraps a Confman and resolves references in values when
+// they are read. Writes and deletes are passed through untouched, i.e. the
+// unresolved templates are what is stored.
+type resolvingConfman struct {
+	Confman
+	log     logger.Logger
+	storage storage.Storage
+	options Options
+}
+
+// NewResolving returns a Confman for the given service path which resolves
+// references to other keys when values are read. References are written as
+// either `${KEY}`, referring to KEY on the same service path, or
+// `${/service/path/KEY}`, referring to KEY on another service path.
+// References are resolved recursively; `$${` is output as a literal `${`.
+func NewResolving(log logger.Logger, s storage.Storage, servicePath string) Confman {
+	return NewResolvingWithOptions(log, s, servicePath, DefaultOptions())
+}
+
+// NewResolvingWithOptions returns a resolving Confman like NewResolving,
+// using options instead of the package variables for the given service path
+// as well as referenced service paths.
+func NewResolvingWithOptions(log logger.Logger, s storage.Storage, servicePath string, options Options) Confman {
+	return &resolvingConfman{
+		Confman: NewWithOptions(log, s, servicePath, options),
+		log:     log,
+		storage: s,
+		options: options,
+	}
+}
+
+// ResolveConfigs resolves references in configs, a map of service paths to
+// their configuration, as if configs were stored, e.g. to validate
+// configuration before it is written. References to service paths not in
+// configs are read from s, using DefaultOptions.
+func ResolveConfigs(ctx context.Context, log logger.Logger, s storage.Storage, configs map[string]map[string]string) (map[string]map[string]string, error) {
+	return ResolveConfigsWithOptions(ctx, log, s, configs, DefaultOptions())
+}
+
+// ResolveConfigsWithOptions resolves references like ResolveConfigs, using
+// options instead of the package variables.
+func ResolveConfigsWithOptions(ctx context.Context, log logger.Logger, s storage.Storage, configs map[string]map[string]string, options Options) (map[string]map[string]string, error) {
+	r := &resolver{
+		log:     log,
+		storage: s,
+		options: options,
+		configs: make(map[string]map[string]string, len(configs)),
+	}
+	for servicePath, config := range configs {
+		r.configs[FormatServicePath(servicePath)] = config
+	}
+
+	resolved := make(map[string]map[string]string, len(configs))
+	for servicePath, config := range configs {
+		resolvedConfig, err := r.resolveConfig(ctx, FormatServicePath(servicePath), config)
+		if err != nil {
+			return nil, err
+		}
+		resolved[servicePath] = resolvedConfig
+	}
+
+	return resolved, nil
+}
+
+func (c *resolvingConfman) Read(ctx context.Context, key string) (value string, _ error) {
+	value, err := c.Confman.Read(ctx, key)
+	if err != nil {
+		return "", err
+	}
+
+	r := c.newResolver()
+	return r.resolve(ctx, c.ServicePath(), key, value)
+}
+
+func (c *resolvingConfman) ReadKeys(ctx context.Context, keys []string) (map[string]string, error) {
+	config, err := c.Confman.ReadKeys(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.newResolver().resolveConfig(ctx, c.ServicePath(), config)
+}
+
+func (c *resolvingConfman) ReadAll(ctx context.Context) (map[string]string, error) {
+	config, err := c.Confman.ReadAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r := c.newResolver()
+	r.configs[c.ServicePath()] = config
+	return r.resolveConfig(ctx, c.ServicePath(), config)
+}
+
+func (c *resolvingConfman) ReadAllMetadata(ctx context.Context) ([]storage.KeyMetadata, error) {
+	keyMetadata, err := c.Confman.ReadAllMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	config := make(map[string]string, len(keyMetadata))
+	for _, keyMeta := range keyMetadata {
+		config[keyMeta.Key] = keyMeta.Value
+	}
+
+	r := c.newResolver()
+	r.configs[c.ServicePath()] = config
+	for i, keyMeta := range keyMetadata {
+		value, err := r.resolve(ctx, c.ServicePath(), keyMeta.Key, keyMeta.Value)
+		if err != nil {
+			return nil, err
+		}
+		keyMetadata[i].Value = value
+	}
+
+	return keyMetadata, nil
+}
+
+func (c *resolvingConfman) String() string {
+	return fmt.Sprintf("Resolving(%s)", c.Confman)
+}
+
+func (c *resolvingConfman) newResolver() *resolver {
+	return &resolver{
+		log:     c.log,
+		storage: c.storage,
+		options: c.options,
+		configs: make(map[string]map[string]string),
+	}
+}
+
+// resolver resolves references in values. Configurations of referenced
+// service paths are read at most once per resolver.
+type resolver struct {
+	log     logger.Logger
+	storage storage.Storage
+	options Options
+	configs map[string]map[string]string
+}
+
+func (r *resolver) resolveConfig(ctx context.Context, servicePath string, config map[string]string) (map[string]string, error) {
+	resolved := make(map[string]string, len(config))
+	for key, value := range config {
+		value, err := r.resolve(ctx, servicePath, key, value)
+		if err != nil {
+			return nil, err
+		}
+		resolved[key] = value
+	}
+
+	return resolved, nil
+}
+
+func (r *resolver) resolve(ctx context.Context, servicePath string, key string, value string) (string, error) {
+	return r.expand(ctx, servicePath, value, []string{path.Join(servicePath, key)})
+}
+
+// expand replaces all references in value. chain holds the key paths
+// currently being resolved, and is used to detect reference cycles.
+func (r *resolver) expand(ctx context.Context, servicePath string, value string, chain []string) (string, error) {
+	if !strings.Contains(value, "${") {
+		return value, nil
+	}
+
+	var sb strings.Builder
+	for len(value) > 0 {
+		i := strings.Index(value, "${")
+		if i == -1 {
+			sb.WriteString(value)
+			break
+		}
+
+		// Escaped reference, i.e. `$${`
+		if i > 0 && value[i-1] == '$' {
+			sb.WriteString(value[:i-1])
+			sb.WriteString("${")
+			value = value[i+2:]
+			continue
+		}
+
+		sb.WriteString(value[:i])
+		value = value[i+2:]
+
+		end := strings.Index(value, "}")
+		if end == -1 {
+			return "", fmt.Errorf("%w: missing '}' in '%s'", ErrReferenceInvalid, chain[len(chain)-1])
+		}
+		reference := strings.TrimSpace(value[:end])
+		value = value[end+1:]
+
+		refValue, err := r.lookup(ctx, servicePath, reference, chain)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(refValue)
+	}
+
+	return sb.String(), nil
+}
+
+func (r *resolver) lookup(ctx context.Context, servicePath string, reference string, chain []string) (string, error) {
+	if len(reference) == 0 {
+		return "", fmt.Errorf("%w: empty reference in '%s'", ErrReferenceInvalid, chain[len(chain)-1])
+	}
+
+	refServicePath, refKey := servicePath, reference
+	if strings.Contains(reference, "/") {
+		refServicePath, refKey = path.Split(FormatServicePath(reference))
+		refServicePath = FormatServicePath(refServicePath)
+	}
+
+	refKeyPath := path.Join(refServicePath, refKey)
+	for _, keyPath := range chain {
+		if keyPath == refKeyPath {
+			return "", fmt.Errorf("%w: %s -> %s", ErrReferenceCycle, strings.Join(chain, " -> "), refKeyPath)
+		}
+	}
+
+	config, err := r.readConfig(ctx, refServicePath)
+	if err != nil {
+		return "", err
+	}
+
+	value, exists := config[refKey]
+	if !exists {
+		return "", fmt.Errorf("%w: '%s' referenced from '%s'", ErrReferenceNotFound, refKeyPath, chain[len(chain)-1])
+	}
+
+	r.log.Debugf("Resolving reference %s", refKeyPath)
+
+	return r.expand(ctx, refServicePath, value, append(chain, refKeyPath))
+}
+
+func (r *resolver) readConfig(ctx context.Context, servicePath string) (map[string]string, error) {
+	config, exists := r.configs[servicePath]
+	if exists {
+		return config, nil
+	}
+
+	config, err := NewWithOptions(r.log, r.storage, servicePath, r.options).ReadAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.configs[servicePath] = config
+
+	return config, nil
+}
@@ -0,0 +1,145 @@
+package confman_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/micvbang/confman-go/pkg/confman"
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/storage"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+var log = logger.LogrusWrapper{Logger: logrus.New()}
+
+// TestResolvingReadAll verifies that references to keys on the same and on
+// other service paths are resolved, including references that themselves
+// contain references, and that escaped references are output literally.
+func TestResolvingReadAll(t *testing.T) {
+	ctx := context.Background()
+	const (
+		servicePath = "/email-dispatch/runtime/production"
+		sharedPath  = "/shared/db/production"
+	)
+
+	s := &storage.MockStorage{}
+	s.On("ReadAll", ctx, servicePath).Return(map[string]string{
+		"DB_USER":  "dispatcher",
+		"DB_HOST":  "${/shared/db/production/HOST}",
+		"DB_URL":   "postgres://${DB_USER}@${DB_HOST}:${ /shared/db/production/PORT }",
+		"TEMPLATE": "$${DB_USER} is literal",
+	}, nil)
+	s.On("ReadAll", ctx, sharedPath).Return(map[string]string{
+		"HOST":   "${DOMAIN}",
+		"PORT":   "5432",
+		"DOMAIN": "db.example.com",
+	}, nil).Once()
+	defer s.AssertExpectations(t)
+
+	cm := confman.NewResolvingWithOptions(log, s, servicePath, confman.Options{})
+	got, err := cm.ReadAll(ctx)
+	require.NoError(t, err)
+
+	expected := map[string]string{
+		"DB_USER":  "dispatcher",
+		"DB_HOST":  "db.example.com",
+		"DB_URL":   "postgres://dispatcher@db.example.com:5432",
+		"TEMPLATE": "${DB_USER} is literal",
+	}
+	require.Equal(t, expected, got)
+}
+
+// TestResolveConfigs verifies that references are resolved using the given
+// configurations of their service paths instead of the stored ones, and
+// using storage for other service paths.
+func TestResolveConfigs(t *testing.T) {
+	ctx := context.Background()
+	const (
+		servicePath = "/email-dispatch/runtime/production"
+		sharedPath  = "/shared/db/production"
+		otherPath   = "/shared/network/production"
+	)
+
+	s := &storage.MockStorage{}
+	s.On("ReadAll", ctx, otherPath).Return(map[string]string{
+		"DOMAIN": "example.com",
+	}, nil).Once()
+	defer s.AssertExpectations(t)
+
+	got, err := confman.ResolveConfigsWithOptions(ctx, log, s, map[string]map[string]string{
+		servicePath: {
+			"DB_HOST": "${/shared/db/production/HOST}",
+			"DB_URL":  "postgres://${DB_HOST}:${/shared/db/production/PORT}",
+		},
+		sharedPath: {
+			"HOST": "db.${/shared/network/production/DOMAIN}",
+			"PORT": "5432",
+		},
+	}, confman.Options{})
+	require.NoError(t, err)
+
+	expected := map[string]map[string]string{
+		servicePath: {
+			"DB_HOST": "db.example.com",
+			"DB_URL":  "postgres://db.example.com:5432",
+		},
+		sharedPath: {
+			"HOST": "db.example.com",
+			"PORT": "5432",
+		},
+	}
+	require.Equal(t, expected, got)
+}
+
+// TestResolvingReadErrors verifies that reference cycles, references to
+// non-existing keys, and malformed references are reported as errors.
+func TestResolvingReadErrors(t *testing.T) {
+	const servicePath = "/service/env"
+
+	tests := map[string]struct {
+		config map[string]string
+		key    string
+		err    error
+	}{
+		"self reference": {
+			config: map[string]string{"A": "${A}"},
+			key:    "A",
+			err:    confman.ErrReferenceCycle,
+		},
+		"indirect cycle": {
+			config: map[string]string{"A": "${B}", "B": "x${C}", "C": "${/service/env/A}"},
+			key:    "A",
+			err:    confman.ErrReferenceCycle,
+		},
+		"missing key": {
+			config: map[string]string{"A": "${B}"},
+			key:    "A",
+			err:    confman.ErrReferenceNotFound,
+		},
+		"unterminated reference": {
+			config: map[string]string{"A": "${B"},
+			key:    "A",
+			err:    confman.ErrReferenceInvalid,
+		},
+		"empty reference": {
+			config: map[string]string{"A": "${}"},
+			key:    "A",
+			err:    confman.ErrReferenceInvalid,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			s := &storage.MockStorage{}
+			s.On("ReadKeys", ctx, servicePath, []string{test.key}).Return(map[string]string{test.key: test.config[test.key]}, nil)
+			s.On("ReadAll", ctx, servicePath).Return(test.config, nil).Maybe()
+
+			cm := confman.NewResolvingWithOptions(log, s, servicePath, confman.Options{})
+			_, err := cm.ReadKeys(ctx, []string{test.key})
+			require.ErrorIs(t, err, test.err)
+		})
+	}
+}
@@ -31,9 +31,9 @@ func parseServicePath(servicePath string) []string {
 
 // FormatServicePath takes as input a short-hand service path and returns
 // the full one, ensuring a prefixed "/", and no suffix "/", e.g.
-// translating `service/name` to `/service/name`.
+// translating `service/name` to `/service/name`. Which service paths are
+// valid depends on the storage, see Confman.ValidateKeys.
 func FormatServicePath(servicePath string) string {
-	// TODO: validate if valid service name
 	if !strings.HasPrefix(servicePath, "/") {
 		servicePath = fmt.Sprintf("/%s", servicePath)
 	}
@@ -0,0 +1,48 @@
+package encryption
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+)
+
+type AWSKMSClient interface {
+	Encrypt(ctx context.Context, params *kms.EncryptInput, optFns ...func(*kms.Options)) (*kms.EncryptOutput, error)
+	Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+}
+
+// awsKMS implements KMS using AWS KMS.
+type awsKMS struct {
+	client AWSKMSClient
+}
+
+// NewAWSKMS returns a KMS using AWS KMS. Key IDs are key IDs, key ARNs or
+// aliases, e.g. "alias/confman".
+func NewAWSKMS(client AWSKMSClient) KMS {
+	return &awsKMS{client: client}
+}
+
+func (k *awsKMS) Encrypt(ctx context.Context, keyID string, plaintext []byte) ([]byte, error) {
+	output, err := k.client.Encrypt(ctx, &kms.EncryptInput{
+		KeyId:     aws.String(keyID),
+		Plaintext: plaintext,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return output.CiphertextBlob, nil
+}
+
+func (k *awsKMS) Decrypt(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error) {
+	output, err := k.client.Decrypt(ctx, &kms.DecryptInput{
+		KeyId:          aws.String(keyID),
+		CiphertextBlob: ciphertext,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return output.Plaintext, nil
+}
@@ -0,0 +1,162 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// KeySize is the size of keys in bytes, selecting AES-256.
+const KeySize = 32
+
+var (
+	ErrInvalidKey = errors.New("invalid key")
+	ErrDecrypt    = errors.New("failed to decrypt")
+)
+
+// GenerateKey returns a new random key.
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	_, err := io.ReadFull(rand.Reader, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// LoadKeyFile reads the key stored at path.
+func LoadKeyFile(path string) ([]byte, error) {
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("%w: key file %s has %d bytes, expected %d", ErrInvalidKey, path, len(key), KeySize)
+	}
+	return key, nil
+}
+
+// LoadOrCreateKeyFile reads the key stored at path. If the file does not
+// exist, a new key is generated and written to path with permissions 0600.
+func LoadOrCreateKeyFile(path string) ([]byte, error) {
+	key, err := LoadKeyFile(path)
+	if !errors.Is(err, os.ErrNotExist) {
+		return key, err
+	}
+
+	key, err = GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	// The key is written to a temporary file, created with permissions
+	// 0600, which is then linked into place, such that concurrent readers
+	// never see a partially written key, and a key written concurrently by
+	// another process is never overwritten.
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	_, err = f.Write(key)
+	if err != nil {
+		return nil, err
+	}
+
+	err = f.Sync()
+	if err != nil {
+		return nil, err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Link(f.Name(), path)
+	if errors.Is(err, os.ErrExist) {
+		return LoadKeyFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// Encrypt encrypts and authenticates plaintext using AES-GCM. The returned
+// ciphertext is prefixed by the randomly generated nonce.
+func Encrypt(key []byte, plaintext []byte) ([]byte, error) {
+	return EncryptWithAdditionalData(key, plaintext, nil)
+}
+
+// EncryptWithAdditionalData is like Encrypt, but also authenticates
+// additionalData, which must be given to DecryptWithAdditionalData as well.
+// This binds ciphertexts to their context, e.g. where they are stored.
+func EncryptWithAdditionalData(key []byte, plaintext []byte, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// Decrypt decrypts ciphertext returned by Encrypt.
+func Decrypt(key []byte, ciphertext []byte) ([]byte, error) {
+	return DecryptWithAdditionalData(key, ciphertext, nil)
+}
+
+// DecryptWithAdditionalData decrypts ciphertext returned by
+// EncryptWithAdditionalData with the same additionalData.
+func DecryptWithAdditionalData(key []byte, ciphertext []byte, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: ciphertext too short", ErrDecrypt)
+	}
+
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrDecrypt, err)
+	}
+
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("%w: expected %d bytes, got %d", ErrInvalidKey, KeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,96 @@
+package encryption_test
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/micvbang/confman-go/pkg/encryption"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEncryptDecrypt verifies that ciphertexts can be decrypted using the
+// same key, but not using another key or when modified.
+func TestEncryptDecrypt(t *testing.T) {
+	key, err := encryption.GenerateKey()
+	require.NoError(t, err)
+
+	plaintext := []byte("secret-password")
+	ciphertext, err := encryption.Encrypt(key, plaintext)
+	require.NoError(t, err)
+	require.NotContains(t, string(ciphertext), string(plaintext))
+
+	got, err := encryption.Decrypt(key, ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, plaintext, got)
+
+	otherKey, err := encryption.GenerateKey()
+	require.NoError(t, err)
+	_, err = encryption.Decrypt(otherKey, ciphertext)
+	require.ErrorIs(t, err, encryption.ErrDecrypt)
+
+	ciphertext[len(ciphertext)-1] ^= 1
+	_, err = encryption.Decrypt(key, ciphertext)
+	require.ErrorIs(t, err, encryption.ErrDecrypt)
+
+	_, err = encryption.Decrypt(key, []byte("short"))
+	require.ErrorIs(t, err, encryption.ErrDecrypt)
+
+	_, err = encryption.Encrypt([]byte("too short key"), plaintext)
+	require.ErrorIs(t, err, encryption.ErrInvalidKey)
+}
+
+// TestLoadOrCreateKeyFile verifies that a key file is created with
+// permissions 0600 when it does not exist, and that the same key is returned
+// when the file exists.
+func TestLoadOrCreateKeyFile(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "dir", "key")
+
+	key, err := encryption.LoadOrCreateKeyFile(keyPath)
+	require.NoError(t, err)
+	require.Equal(t, encryption.KeySize, len(key))
+
+	info, err := os.Stat(keyPath)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	got, err := encryption.LoadOrCreateKeyFile(keyPath)
+	require.NoError(t, err)
+	require.Equal(t, key, got)
+
+	err = os.WriteFile(keyPath, []byte("invalid"), 0600)
+	require.NoError(t, err)
+	_, err = encryption.LoadOrCreateKeyFile(keyPath)
+	require.ErrorIs(t, err, encryption.ErrInvalidKey)
+}
+
+// TestLoadOrCreateKeyFileConcurrent verifies that concurrent calls never see
+// a partially written key, and all return the same key.
+func TestLoadOrCreateKeyFileConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "key")
+
+	const n = 20
+	keys := make([][]byte, n)
+	errs := make([]error, n)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			keys[i], errs[i] = encryption.LoadOrCreateKeyFile(keyPath)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < n; i++ {
+		require.NoError(t, errs[i])
+		require.Equal(t, keys[0], keys[i])
+	}
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
@@ -0,0 +1,214 @@
+package encryption
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+var ErrUnwrapKey = errors.New("failed to unwrap key")
+
+// KeyProvider wraps and unwraps data keys, i.e. the keys that encrypt data,
+// using a key encryption key that is never stored alongside the data.
+type KeyProvider interface {
+	// KeyID identifies the key encryption key. It is stored alongside wrapped
+	// data keys, such that the provider able to unwrap them can be found.
+	KeyID() string
+
+	WrapKey(ctx context.Context, dataKey []byte) ([]byte, error)
+	UnwrapKey(ctx context.Context, wrappedKey []byte) ([]byte, error)
+}
+
+// keyProvider wraps data keys using a key encryption key held in memory.
+type keyProvider struct {
+	id  string
+	key []byte
+}
+
+// NewKeyProvider returns a KeyProvider wrapping data keys using key, e.g.
+// read using LoadOrCreateKeyFile. Its key ID is derived from a hash of key.
+func NewKeyProvider(key []byte) (KeyProvider, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("%w: expected %d bytes, got %d", ErrInvalidKey, KeySize, len(key))
+	}
+
+	hash := sha256.Sum256(key)
+	return &keyProvider{
+		id:  "key:" + hex.EncodeToString(hash[:8]),
+		key: key,
+	}, nil
+}
+
+func (kp *keyProvider) KeyID() string {
+	return kp.id
+}
+
+func (kp *keyProvider) WrapKey(ctx context.Context, dataKey []byte) ([]byte, error) {
+	return Encrypt(kp.key, dataKey)
+}
+
+func (kp *keyProvider) UnwrapKey(ctx context.Context, wrappedKey []byte) ([]byte, error) {
+	dataKey, err := Decrypt(kp.key, wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnwrapKey, err)
+	}
+	return dataKey, nil
+}
+
+// scrypt parameters recommended for interactive use as of 2017.
+const (
+	scryptN    = 32768
+	scryptR    = 8
+	scryptP    = 1
+	saltLength = 16
+)
+
+// passphraseProvider wraps data keys using key encryption keys derived from
+// a passphrase using scrypt. Wrapped keys are prefixed by the salt of the key
+// encryption key.
+type passphraseProvider struct {
+	id         string
+	passphrase []byte
+
+	mu   sync.Mutex
+	salt []byte
+	keys map[string][]byte
+}
+
+// NewPassphraseProvider returns a KeyProvider wrapping data keys using keys
+// derived from passphrase. Its key ID is derived from passphrase as well,
+// such that different passphrases have different key IDs.
+func NewPassphraseProvider(passphrase string) (KeyProvider, error) {
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("%w: passphrase must not be empty", ErrInvalidKey)
+	}
+
+	pp := &passphraseProvider{
+		passphrase: []byte(passphrase),
+		keys:       map[string][]byte{},
+	}
+
+	idKey, err := pp.deriveKey([]byte("confman key id"))
+	if err != nil {
+		return nil, err
+	}
+	pp.id = "passphrase:" + hex.EncodeToString(idKey[:8])
+
+	return pp, nil
+}
+
+func (pp *passphraseProvider) KeyID() string {
+	return pp.id
+}
+
+func (pp *passphraseProvider) WrapKey(ctx context.Context, dataKey []byte) ([]byte, error) {
+	pp.mu.Lock()
+	if pp.salt == nil {
+		pp.salt = make([]byte, saltLength)
+		_, err := io.ReadFull(rand.Reader, pp.salt)
+		if err != nil {
+			pp.mu.Unlock()
+			return nil, err
+		}
+	}
+	salt := pp.salt
+	pp.mu.Unlock()
+
+	key, err := pp.deriveKey(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := Encrypt(key, dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(append([]byte{}, salt...), ciphertext...), nil
+}
+
+func (pp *passphraseProvider) UnwrapKey(ctx context.Context, wrappedKey []byte) ([]byte, error) {
+	if len(wrappedKey) < saltLength {
+		return nil, fmt.Errorf("%w: wrapped key too short", ErrUnwrapKey)
+	}
+
+	key, err := pp.deriveKey(wrappedKey[:saltLength])
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := Decrypt(key, wrappedKey[saltLength:])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnwrapKey, err)
+	}
+	return dataKey, nil
+}
+
+// deriveKey returns the key derived from the passphrase and salt. Since
+// scrypt is deliberately slow, keys are cached.
+func (pp *passphraseProvider) deriveKey(salt []byte) ([]byte, error) {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+
+	key, exists := pp.keys[string(salt)]
+	if exists {
+		return key, nil
+	}
+
+	key, err := scrypt.Key(pp.passphrase, salt, scryptN, scryptR, scryptP, KeySize)
+	if err != nil {
+		return nil, err
+	}
+
+	pp.keys[string(salt)] = key
+	return key, nil
+}
+
+// KMS encrypts and decrypts small amounts of data, e.g. data keys, using keys
+// managed by a key management service.
+type KMS interface {
+	Encrypt(ctx context.Context, keyID string, plaintext []byte) ([]byte, error)
+	Decrypt(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error)
+}
+
+// kmsProvider wraps data keys using a key managed by a KMS.
+type kmsProvider struct {
+	kms   KMS
+	keyID string
+}
+
+// NewKMSProvider returns a KeyProvider wrapping data keys using the key
+// keyID of kms.
+func NewKMSProvider(kms KMS, keyID string) (KeyProvider, error) {
+	if len(keyID) == 0 {
+		return nil, fmt.Errorf("%w: KMS key ID must not be empty", ErrInvalidKey)
+	}
+
+	return &kmsProvider{
+		kms:   kms,
+		keyID: keyID,
+	}, nil
+}
+
+func (kp *kmsProvider) KeyID() string {
+	return "kms:" + kp.keyID
+}
+
+func (kp *kmsProvider) WrapKey(ctx context.Context, dataKey []byte) ([]byte, error) {
+	return kp.kms.Encrypt(ctx, kp.keyID, dataKey)
+}
+
+func (kp *kmsProvider) UnwrapKey(ctx context.Context, wrappedKey []byte) ([]byte, error) {
+	dataKey, err := kp.kms.Decrypt(ctx, kp.keyID, wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnwrapKey, err)
+	}
+	return dataKey, nil
+}
@@ -0,0 +1,104 @@
+package encryption_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/micvbang/confman-go/pkg/encryption"
+	"github.com/stretchr/testify/require"
+)
+
+// TestKeyProviders verifies that data keys wrapped by each KeyProvider can
+// be unwrapped by the same provider, but not by a provider with another key.
+func TestKeyProviders(t *testing.T) {
+	kms := &fakeKMS{key: mustGenerateKey(t)}
+
+	tests := map[string]struct {
+		newProvider   func() (encryption.KeyProvider, error)
+		otherProvider func() (encryption.KeyProvider, error)
+		keyIDPrefix   string
+	}{
+		"key": {
+			newProvider:   func() (encryption.KeyProvider, error) { return encryption.NewKeyProvider(kms.key) },
+			otherProvider: func() (encryption.KeyProvider, error) { return encryption.NewKeyProvider(mustGenerateKey(t)) },
+			keyIDPrefix:   "key:",
+		},
+		"passphrase": {
+			newProvider:   func() (encryption.KeyProvider, error) { return encryption.NewPassphraseProvider("correct horse") },
+			otherProvider: func() (encryption.KeyProvider, error) { return encryption.NewPassphraseProvider("battery staple") },
+			keyIDPrefix:   "passphrase:",
+		},
+		"kms": {
+			newProvider: func() (encryption.KeyProvider, error) { return encryption.NewKMSProvider(kms, "alias/confman") },
+			otherProvider: func() (encryption.KeyProvider, error) {
+				return encryption.NewKMSProvider(&fakeKMS{key: mustGenerateKey(t)}, "alias/other")
+			},
+			keyIDPrefix: "kms:",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			dataKey := mustGenerateKey(t)
+
+			provider, err := test.newProvider()
+			require.NoError(t, err)
+			require.True(t, strings.HasPrefix(provider.KeyID(), test.keyIDPrefix))
+
+			wrappedKey, err := provider.WrapKey(ctx, dataKey)
+			require.NoError(t, err)
+			require.NotContains(t, string(wrappedKey), string(dataKey))
+
+			// A new instance with the same key gives the same key ID and
+			// can unwrap the key.
+			sameProvider, err := test.newProvider()
+			require.NoError(t, err)
+			require.Equal(t, provider.KeyID(), sameProvider.KeyID())
+
+			got, err := sameProvider.UnwrapKey(ctx, wrappedKey)
+			require.NoError(t, err)
+			require.Equal(t, dataKey, got)
+
+			otherProvider, err := test.otherProvider()
+			require.NoError(t, err)
+			require.NotEqual(t, provider.KeyID(), otherProvider.KeyID())
+
+			_, err = otherProvider.UnwrapKey(ctx, wrappedKey)
+			require.ErrorIs(t, err, encryption.ErrUnwrapKey)
+		})
+	}
+}
+
+// TestKeyProvidersInvalid verifies that key providers can't be created
+// without a valid key.
+func TestKeyProvidersInvalid(t *testing.T) {
+	_, err := encryption.NewKeyProvider([]byte("too short key"))
+	require.ErrorIs(t, err, encryption.ErrInvalidKey)
+
+	_, err = encryption.NewPassphraseProvider("")
+	require.ErrorIs(t, err, encryption.ErrInvalidKey)
+
+	_, err = encryption.NewKMSProvider(&fakeKMS{}, "")
+	require.ErrorIs(t, err, encryption.ErrInvalidKey)
+}
+
+// fakeKMS implements encryption.KMS using a single key.
+type fakeKMS struct {
+	key []byte
+}
+
+func (k *fakeKMS) Encrypt(ctx context.Context, keyID string, plaintext []byte) ([]byte, error) {
+	return encryption.Encrypt(k.key, plaintext)
+}
+
+func (k *fakeKMS) Decrypt(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error) {
+	return encryption.Decrypt(k.key, ciphertext)
+}
+
+func mustGenerateKey(t *testing.T) []byte {
+	key, err := encryption.GenerateKey()
+	require.NoError(t, err)
+	return key
+}
@@ -0,0 +1,93 @@
+package render
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+var ErrRequired = errors.New("required value missing")
+
+// Funcs returns the helper functions available in templates:
+//
+//   - required MSG VALUE: fails rendering with MSG if VALUE is empty
+//   - default DEFAULT VALUE: returns DEFAULT if VALUE is empty
+//   - quote VALUE: returns VALUE as a double-quoted string with Go escapes
+//   - b64enc VALUE, b64dec VALUE: base64 encodes/decodes VALUE
+//   - toJSON VALUE: returns VALUE encoded as JSON
+//   - upper VALUE, lower VALUE, trim VALUE: changes case or trims whitespace
+//   - indent N VALUE: indents every line of VALUE by N spaces
+func Funcs() template.FuncMap {
+	return template.FuncMap{
+		"required": required,
+		"default":  defaultValue,
+		"quote":    strconv.Quote,
+		"b64enc":   b64enc,
+		"b64dec":   b64dec,
+		"toJSON":   toJSON,
+		"upper":    strings.ToUpper,
+		"lower":    strings.ToLower,
+		"trim":     strings.TrimSpace,
+		"indent":   indent,
+	}
+}
+
+// Parse parses text as a template named name. Keys that are missing from the
+// configuration render as empty strings, such that they can be handled using
+// "required" and "default".
+func Parse(name string, text string) (*template.Template, error) {
+	return template.New(name).
+		Option("missingkey=zero").
+		Funcs(Funcs()).
+		Parse(text)
+}
+
+// Render parses text as a template and executes it with config as data,
+// writing the output to w. Keys are available as fields of the data, e.g.
+// {{ .DB_HOST }}.
+func Render(w io.Writer, name string, text string, config map[string]string) error {
+	tmpl, err := Parse(name, text)
+	if err != nil {
+		return err
+	}
+
+	return tmpl.Execute(w, config)
+}
+
+func required(msg string, value string) (string, error) {
+	if len(value) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrRequired, msg)
+	}
+	return value, nil
+}
+
+func defaultValue(defaultValue string, value string) string {
+	if len(value) == 0 {
+		return defaultValue
+	}
+	return value
+}
+
+func b64enc(value string) string {
+	return base64.StdEncoding.EncodeToString([]byte(value))
+}
+
+func b64dec(value string) (string, error) {
+	bs, err := base64.StdEncoding.DecodeString(value)
+	return string(bs), err
+}
+
+func toJSON(value interface{}) (string, error) {
+	bs, err := json.Marshal(value)
+	return string(bs), err
+}
+
+func indent(spaces int, value string) string {
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.ReplaceAll(value, "\n", "\n"+pad)
+}
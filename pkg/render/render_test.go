@@ -0,0 +1,62 @@
+package render_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/micvbang/confman-go/pkg/render"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRender verifies that keys and helper functions can be used in
+// templates.
+func TestRender(t *testing.T) {
+	config := map[string]string{
+		"DB_HOST":     "localhost",
+		"DB_PASSWORD": `pass"word`,
+		"CERT":        "line1\nline2",
+	}
+
+	tests := map[string]struct {
+		text     string
+		expected string
+	}{
+		"key":            {text: "{{ .DB_HOST }}", expected: "localhost"},
+		"missing key":    {text: "[{{ .MISSING }}]", expected: "[]"},
+		"index":          {text: `{{ index . "DB_HOST" }}`, expected: "localhost"},
+		"default":        {text: `{{ .MISSING | default "5432" }}`, expected: "5432"},
+		"default unused": {text: `{{ .DB_HOST | default "db" }}`, expected: "localhost"},
+		"required":       {text: `{{ required "DB_HOST must be set" .DB_HOST }}`, expected: "localhost"},
+		"quote":          {text: "{{ .DB_PASSWORD | quote }}", expected: `"pass\"word"`},
+		"b64enc":         {text: "{{ .DB_HOST | b64enc }}", expected: "bG9jYWxob3N0"},
+		"b64dec":         {text: `{{ "bG9jYWxob3N0" | b64dec }}`, expected: "localhost"},
+		"toJSON":         {text: "{{ .DB_PASSWORD | toJSON }}", expected: `"pass\"word"`},
+		"toJSON all":     {text: "{{ toJSON . }}", expected: `{"CERT":"line1\nline2","DB_HOST":"localhost","DB_PASSWORD":"pass\"word"}`},
+		"upper":          {text: "{{ .DB_HOST | upper }}", expected: "LOCALHOST"},
+		"indent":         {text: "{{ .CERT | indent 2 }}", expected: "  line1\n  line2"},
+		"range":          {text: "{{ range $k, $v := . }}{{ $k }};{{ end }}", expected: "CERT;DB_HOST;DB_PASSWORD;"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			buf := bytes.NewBuffer(nil)
+			err := render.Render(buf, name, test.text, config)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, buf.String())
+		})
+	}
+}
+
+// TestRenderErrors verifies that missing required values and invalid
+// templates are reported as errors.
+func TestRenderErrors(t *testing.T) {
+	err := render.Render(bytes.NewBuffer(nil), "tmpl", `{{ required "DB_HOST must be set" .DB_HOST }}`, map[string]string{})
+	require.ErrorIs(t, err, render.ErrRequired)
+	require.Contains(t, err.Error(), "DB_HOST must be set")
+
+	err = render.Render(bytes.NewBuffer(nil), "tmpl", "{{ .DB_HOST", map[string]string{})
+	require.Error(t, err)
+
+	err = render.Render(bytes.NewBuffer(nil), "tmpl", "{{ .DB_HOST | unknown }}", map[string]string{})
+	require.Error(t, err)
+}
@@ -0,0 +1,297 @@
+package schema
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/micvbang/confman-go/pkg/confman"
+	"github.com/micvbang/go-helpy/filepathy"
+	"github.com/micvbang/go-helpy/mapy"
+	"gopkg.in/yaml.v2"
+)
+
+// Types supported in schemas
+const (
+	TypeString   = "string"
+	TypeInt      = "int"
+	TypeBool     = "bool"
+	TypeURL      = "url"
+	TypeDuration = "duration"
+	TypeEnum     = "enum"
+	TypeRegex    = "regex"
+)
+
+var supportedSchemaExtensions = []string{".yml", ".yaml", ".json"}
+
+// KeySpec declares the requirements of a single key.
+type KeySpec struct {
+	Type     string   `yaml:"type" json:"type"`
+	Required bool     `yaml:"required" json:"required"`
+	Default  *string  `yaml:"default" json:"default,omitempty"`
+	Secret   bool     `yaml:"secret" json:"secret"`
+	Values   []string `yaml:"values" json:"values,omitempty"`
+	Pattern  string   `yaml:"pattern" json:"pattern,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// Schema holds key specifications for service path prefixes. A prefix
+// applies to the service path with the same name as well as all service
+// paths below it.
+type Schema struct {
+	prefixes map[string]map[string]KeySpec
+}
+
+// Violation describes a key that does not satisfy its specification.
+type Violation struct {
+	ServicePath string `json:"service_path" yaml:"service_path"`
+	Key         string `json:"key" yaml:"key"`
+	Msg         string `json:"msg" yaml:"msg"`
+}
+
+func (v Violation) Error() string {
+	return fmt.Sprintf("%s: %s", path.Join(v.ServicePath, v.Key), v.Msg)
+}
+
+// Read reads schemas from the given file, or from all files with a
+// supported extension if path is a directory.
+func Read(schemaPath string) (*Schema, error) {
+	s := &Schema{prefixes: make(map[string]map[string]KeySpec)}
+
+	filePaths, err := getSchemaPaths(schemaPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, filePath := range filePaths {
+		err := s.readFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (s *Schema) readFile(filePath string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	prefixes := map[string]map[string]KeySpec{}
+	err = yaml.NewDecoder(f).Decode(&prefixes)
+	if err != nil {
+		return SchemaError{msg: fmt.Sprintf("failed to parse \"%s\": %s", filePath, err)}
+	}
+
+	for prefix, keySpecs := range prefixes {
+		prefix = confman.FormatServicePath(prefix)
+		if _, exists := s.prefixes[prefix]; !exists {
+			s.prefixes[prefix] = make(map[string]KeySpec, len(keySpecs))
+		}
+
+		for key, spec := range keySpecs {
+			spec, err := compileKeySpec(spec)
+			if err != nil {
+				return SchemaError{msg: fmt.Sprintf("\"%s\": %s: %s", filePath, path.Join(prefix, key), err)}
+			}
+			s.prefixes[prefix][key] = spec
+		}
+	}
+
+	return nil
+}
+
+func compileKeySpec(spec KeySpec) (KeySpec, error) {
+	if len(spec.Type) == 0 {
+		spec.Type = TypeString
+	}
+
+	switch spec.Type {
+	case TypeString, TypeInt, TypeBool, TypeURL, TypeDuration:
+	case TypeEnum:
+		if len(spec.Values) == 0 {
+			return spec, fmt.Errorf("type %s requires 'values'", spec.Type)
+		}
+	case TypeRegex:
+		if len(spec.Pattern) == 0 {
+			return spec, fmt.Errorf("type %s requires 'pattern'", spec.Type)
+		}
+
+		pattern, err := regexp.Compile(fmt.Sprintf("^(?:%s)$", spec.Pattern))
+		if err != nil {
+			return spec, fmt.Errorf("invalid pattern: %w", err)
+		}
+		spec.pattern = pattern
+	default:
+		return spec, fmt.Errorf("unsupported type '%s'", spec.Type)
+	}
+
+	if spec.Default != nil {
+		if msg := spec.check(*spec.Default); len(msg) > 0 {
+			return spec, fmt.Errorf("invalid default: %s", msg)
+		}
+	}
+
+	return spec, nil
+}
+
+// KeySpecs returns the key specifications that apply to the given service
+// path. When several prefixes declare the same key, the most specific prefix
+// takes precedence.
+func (s *Schema) KeySpecs(servicePath string) map[string]KeySpec {
+	servicePath = confman.FormatServicePath(servicePath)
+
+	prefixes := make([]string, 0, len(s.prefixes))
+	for prefix := range s.prefixes {
+		if prefix == servicePath || prefix == "/" || strings.HasPrefix(servicePath, prefix+"/") {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		return len(prefixes[i]) < len(prefixes[j])
+	})
+
+	keySpecs := make(map[string]KeySpec)
+	for _, prefix := range prefixes {
+		for key, spec := range s.prefixes[prefix] {
+			keySpecs[key] = spec
+		}
+	}
+
+	return keySpecs
+}
+
+// ApplyDefaults returns a copy of config in which keys that are missing from
+// config, but have a default value in the schema, are set to their default.
+func (s *Schema) ApplyDefaults(servicePath string, config map[string]string) map[string]string {
+	newConfig := make(map[string]string, len(config))
+	for key, value := range config {
+		newConfig[key] = value
+	}
+
+	for key, spec := range s.KeySpecs(servicePath) {
+		if _, exists := newConfig[key]; !exists && spec.Default != nil {
+			newConfig[key] = *spec.Default
+		}
+	}
+
+	return newConfig
+}
+
+// Validate returns all violations of the schema in config. Keys that are not
+// declared in the schema are not validated.
+func (s *Schema) Validate(servicePath string, config map[string]string) []Violation {
+	servicePath = confman.FormatServicePath(servicePath)
+	keySpecs := s.KeySpecs(servicePath)
+
+	violations := []Violation{}
+	for _, key := range sortedKeys(keySpecs) {
+		spec := keySpecs[key]
+
+		value, exists := config[key]
+		if !exists {
+			if spec.Required && spec.Default == nil {
+				violations = append(violations, Violation{ServicePath: servicePath, Key: key, Msg: "required key is missing"})
+			}
+			continue
+		}
+
+		if msg := spec.check(value); len(msg) > 0 {
+			if !spec.Secret {
+				msg = fmt.Sprintf("value '%s' %s", value, msg)
+			} else {
+				msg = fmt.Sprintf("value %s", msg)
+			}
+			violations = append(violations, Violation{ServicePath: servicePath, Key: key, Msg: msg})
+		}
+	}
+
+	return violations
+}
+
+// check returns a description of why value does not satisfy the spec, or
+// the empty string if it does.
+func (spec KeySpec) check(value string) string {
+	switch spec.Type {
+	case TypeInt:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return "is not a valid int"
+		}
+	case TypeBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return "is not a valid bool"
+		}
+	case TypeURL:
+		u, err := url.Parse(value)
+		if err != nil || len(u.Scheme) == 0 || len(u.Host) == 0 {
+			return "is not a valid url"
+		}
+	case TypeDuration:
+		if _, err := time.ParseDuration(value); err != nil {
+			return "is not a valid duration"
+		}
+	case TypeEnum:
+		for _, v := range spec.Values {
+			if v == value {
+				return ""
+			}
+		}
+		return fmt.Sprintf("is not one of %v", spec.Values)
+	case TypeRegex:
+		if !spec.pattern.MatchString(value) {
+			return fmt.Sprintf("does not match pattern '%s'", spec.Pattern)
+		}
+	}
+
+	return ""
+}
+
+func getSchemaPaths(schemaPath string) ([]string, error) {
+	walkConfig := filepathy.WalkConfig{
+		Dirs:       false,
+		Files:      true,
+		Recursive:  true,
+		Root:       true,
+		Extensions: supportedSchemaExtensions,
+	}
+
+	filePaths := []string{}
+	err := filepathy.Walk(schemaPath, walkConfig, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		filePaths = append(filePaths, filePath)
+		return nil
+	})
+
+	return filePaths, err
+}
+
+func sortedKeys(keySpecs map[string]KeySpec) []string {
+	keys := mapy.Keys(keySpecs)
+	sort.Strings(keys)
+	return keys
+}
+
+type SchemaError struct {
+	msg string
+}
+
+func (s SchemaError) Error() string {
+	return fmt.Sprintf("SchemaError: %s", s.msg)
+}
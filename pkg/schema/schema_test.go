@@ -0,0 +1,155 @@
+package schema_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/micvbang/confman-go/pkg/schema"
+	"github.com/stretchr/testify/require"
+)
+
+const testSchema = `
+/email-dispatch/runtime:
+  DB_HOST:
+    required: true
+  DB_PORT:
+    type: int
+    required: true
+    default: "5432"
+  DB_PASSWORD:
+    type: regex
+    pattern: "[a-z]+"
+    secret: true
+  LOG_LEVEL:
+    type: enum
+    values: [debug, info]
+  API_URL:
+    type: url
+  TIMEOUT:
+    type: duration
+  DEBUG:
+    type: bool
+
+/email-dispatch/runtime/production:
+  LOG_LEVEL:
+    type: enum
+    values: [info]
+`
+
+func readTestSchema(t *testing.T, contents string) *schema.Schema {
+	schemaPath := filepath.Join(t.TempDir(), "schema.yml")
+	err := os.WriteFile(schemaPath, []byte(contents), 0600)
+	require.NoError(t, err)
+
+	s, err := schema.Read(schemaPath)
+	require.NoError(t, err)
+
+	return s
+}
+
+// TestSchemaValidate verifies that Validate reports every key that violates
+// the schema, that values of secret keys are not included in violations, and
+// that the most specific prefix takes precedence.
+func TestSchemaValidate(t *testing.T) {
+	s := readTestSchema(t, testSchema)
+
+	tests := map[string]struct {
+		servicePath string
+		config      map[string]string
+		violations  []schema.Violation
+	}{
+		"valid": {
+			servicePath: "/email-dispatch/runtime/development",
+			config: map[string]string{
+				"DB_HOST":     "localhost",
+				"DB_PASSWORD": "abc",
+				"LOG_LEVEL":   "debug",
+				"API_URL":     "https://example.com/api",
+				"TIMEOUT":     "10s",
+				"DEBUG":       "true",
+				"UNDECLARED":  "anything",
+			},
+			violations: []schema.Violation{},
+		},
+		"not matching prefix": {
+			servicePath: "/email-dispatcher/runtime",
+			config:      map[string]string{},
+			violations:  []schema.Violation{},
+		},
+		"invalid values": {
+			servicePath: "/email-dispatch/runtime/development",
+			config: map[string]string{
+				"DB_PORT":     "not a port",
+				"DB_PASSWORD": "ABC",
+				"LOG_LEVEL":   "trace",
+				"API_URL":     "example.com",
+				"TIMEOUT":     "10",
+				"DEBUG":       "yes please",
+			},
+			violations: []schema.Violation{
+				{ServicePath: "/email-dispatch/runtime/development", Key: "API_URL", Msg: "value 'example.com' is not a valid url"},
+				{ServicePath: "/email-dispatch/runtime/development", Key: "DB_HOST", Msg: "required key is missing"},
+				{ServicePath: "/email-dispatch/runtime/development", Key: "DB_PASSWORD", Msg: "value does not match pattern '[a-z]+'"},
+				{ServicePath: "/email-dispatch/runtime/development", Key: "DB_PORT", Msg: "value 'not a port' is not a valid int"},
+				{ServicePath: "/email-dispatch/runtime/development", Key: "DEBUG", Msg: "value 'yes please' is not a valid bool"},
+				{ServicePath: "/email-dispatch/runtime/development", Key: "LOG_LEVEL", Msg: "value 'trace' is not one of [debug info]"},
+				{ServicePath: "/email-dispatch/runtime/development", Key: "TIMEOUT", Msg: "value '10' is not a valid duration"},
+			},
+		},
+		"more specific prefix": {
+			servicePath: "email-dispatch/runtime/production/",
+			config: map[string]string{
+				"DB_HOST":   "localhost",
+				"LOG_LEVEL": "debug",
+			},
+			violations: []schema.Violation{
+				{ServicePath: "/email-dispatch/runtime/production", Key: "LOG_LEVEL", Msg: "value 'debug' is not one of [info]"},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			violations := s.Validate(test.servicePath, test.config)
+			require.Equal(t, test.violations, violations)
+		})
+	}
+}
+
+// TestSchemaApplyDefaults verifies that ApplyDefaults only adds default
+// values for keys that are missing.
+func TestSchemaApplyDefaults(t *testing.T) {
+	s := readTestSchema(t, testSchema)
+
+	const servicePath = "/email-dispatch/runtime/development"
+
+	got := s.ApplyDefaults(servicePath, map[string]string{"DB_HOST": "localhost"})
+	require.Equal(t, map[string]string{"DB_HOST": "localhost", "DB_PORT": "5432"}, got)
+
+	got = s.ApplyDefaults(servicePath, map[string]string{"DB_PORT": "1234"})
+	require.Equal(t, map[string]string{"DB_PORT": "1234"}, got)
+}
+
+// TestSchemaReadInvalid verifies that Read returns an error for schemas with
+// invalid key specifications.
+func TestSchemaReadInvalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown type":          "/service:\n  KEY:\n    type: float\n",
+		"enum without values":   "/service:\n  KEY:\n    type: enum\n",
+		"regex without pattern": "/service:\n  KEY:\n    type: regex\n",
+		"invalid pattern":       "/service:\n  KEY:\n    type: regex\n    pattern: \"[\"\n",
+		"invalid default":       "/service:\n  KEY:\n    type: int\n    default: abc\n",
+	}
+
+	for name, contents := range tests {
+		t.Run(name, func(t *testing.T) {
+			schemaPath := filepath.Join(t.TempDir(), "schema.yml")
+			err := os.WriteFile(schemaPath, []byte(contents), 0600)
+			require.NoError(t, err)
+
+			_, err = schema.Read(schemaPath)
+			require.Error(t, err)
+		})
+	}
+}
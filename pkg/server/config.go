@@ -0,0 +1,142 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/micvbang/confman-go/pkg/confman"
+	"gopkg.in/yaml.v2"
+)
+
+// Permissions that can be granted on service path prefixes.
+const (
+	// PermissionList allows reading key names and metadata, but not values.
+	PermissionList = "list"
+
+	// PermissionRead allows reading values. It implies PermissionList.
+	PermissionRead = "read"
+
+	// PermissionWrite allows writing and deleting keys.
+	PermissionWrite = "write"
+)
+
+var ErrInvalidConfig = errors.New("invalid server config")
+
+// Config is the configuration of the server, read from a YAML file.
+type Config struct {
+	Tokens []Token `yaml:"tokens"`
+}
+
+// Token is a bearer token and the permissions granted to it.
+type Token struct {
+	// Name identifies the token in logs.
+	Name string `yaml:"name"`
+
+	// Token is the bearer token. Alternatively, TokenEnv is the name of an
+	// environment variable holding it.
+	Token    string `yaml:"token"`
+	TokenEnv string `yaml:"token_env"`
+
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule grants permissions on all service paths below Prefix. Prefixes match
+// whole path segments, i.e. "/email-dispatch" matches
+// "/email-dispatch/runtime/production" but not "/email-dispatch-v2".
+type Rule struct {
+	Prefix      string   `yaml:"prefix"`
+	Permissions []string `yaml:"permissions"`
+}
+
+// ReadConfig reads and validates the server config at configPath. Tokens
+// given by TokenEnv are read from the environment.
+func ReadConfig(configPath string) (Config, error) {
+	config := Config{}
+
+	bs, err := os.ReadFile(configPath)
+	if err != nil {
+		return config, err
+	}
+
+	err = yaml.UnmarshalStrict(bs, &config)
+	if err != nil {
+		return config, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+	}
+
+	for i := range config.Tokens {
+		token := &config.Tokens[i]
+		if len(token.TokenEnv) > 0 {
+			if len(token.Token) > 0 {
+				return config, fmt.Errorf("%w: token %s has both token and token_env", ErrInvalidConfig, token.Name)
+			}
+			token.Token = os.Getenv(token.TokenEnv)
+		}
+	}
+
+	return config, config.validate()
+}
+
+func (c Config) validate() error {
+	if len(c.Tokens) == 0 {
+		return fmt.Errorf("%w: no tokens given", ErrInvalidConfig)
+	}
+
+	names := make(map[string]struct{}, len(c.Tokens))
+	for i, token := range c.Tokens {
+		if len(token.Name) == 0 {
+			return fmt.Errorf("%w: token %d has no name", ErrInvalidConfig, i+1)
+		}
+		if _, exists := names[token.Name]; exists {
+			return fmt.Errorf("%w: token name %s used more than once", ErrInvalidConfig, token.Name)
+		}
+		names[token.Name] = struct{}{}
+
+		if len(token.Token) == 0 {
+			return fmt.Errorf("%w: token %s is empty", ErrInvalidConfig, token.Name)
+		}
+
+		for _, rule := range token.Rules {
+			if !strings.HasPrefix(rule.Prefix, "/") {
+				return fmt.Errorf("%w: prefix '%s' of token %s must start with /", ErrInvalidConfig, rule.Prefix, token.Name)
+			}
+
+			for _, permission := range rule.Permissions {
+				switch permission {
+				case PermissionList, PermissionRead, PermissionWrite:
+				default:
+					return fmt.Errorf("%w: unknown permission '%s' of token %s", ErrInvalidConfig, permission, token.Name)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// allows returns whether the token has permission on servicePath.
+func (t Token) allows(servicePath string, permission string) bool {
+	for _, rule := range t.Rules {
+		if !matchesPrefix(rule.Prefix, servicePath) {
+			continue
+		}
+
+		for _, granted := range rule.Permissions {
+			if granted == permission || (permission == PermissionList && granted == PermissionRead) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func matchesPrefix(prefix string, servicePath string) bool {
+	prefix = confman.FormatServicePath(prefix)
+	if len(prefix) == 0 {
+		return true
+	}
+
+	return servicePath == prefix || strings.HasPrefix(servicePath, prefix+"/")
+}
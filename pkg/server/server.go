@@ -0,0 +1,466 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/micvbang/confman-go/pkg/confman"
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/storage"
+	"github.com/micvbang/go-helpy/mapy"
+)
+
+// Endpoints of the API. Service paths are given as the remainder of the URL
+// path, e.g. /v1/config/email-dispatch/runtime/production.
+const (
+	PathConfig       = "/v1/config"
+	PathMetadata     = "/v1/metadata"
+	PathMetadataKeys = "/v1/metadata-keys"
+	PathDiff         = "/v1/diff"
+	PathHealth       = "/healthz"
+)
+
+// maxBodySize is the maximum size of request bodies.
+const maxBodySize = 1 << 20
+
+var (
+	errUnauthorized = errors.New("missing or invalid bearer token")
+	errForbidden    = errors.New("permission denied")
+)
+
+// ConfigResponse is returned when reading configuration.
+type ConfigResponse struct {
+	ServicePath string            `json:"service_path"`
+	Config      map[string]string `json:"config"`
+}
+
+// MetadataResponse is returned when reading metadata. Values are only
+// included when requested using reveal=true.
+type MetadataResponse struct {
+	ServicePath string                `json:"service_path"`
+	Keys        []storage.KeyMetadata `json:"keys"`
+}
+
+// MetadataKeysResponse is returned when reading the metadata keys supported
+// by the storage.
+type MetadataKeysResponse struct {
+	MetadataKeys []string `json:"metadata_keys"`
+}
+
+// DiffResponse describes the changes needed for the configuration of a
+// service path to become the requested configuration.
+type DiffResponse struct {
+	ServicePath string   `json:"service_path"`
+	Added       []string `json:"added"`
+	Updated     []string `json:"updated"`
+	Deleted     []string `json:"deleted"`
+	Unchanged   []string `json:"unchanged"`
+}
+
+// ErrorResponse is returned for all errors.
+type ErrorResponse struct {
+	Error string `json:"error"`
+
+	// Code identifies errors that clients handle, e.g.
+	// ErrorCodeConfigNotFound. It is empty for other errors.
+	Code string `json:"code,omitempty"`
+}
+
+// Codes of ErrorResponse
+const (
+	// ErrorCodeConfigNotFound is returned when the requested configuration
+	// doesn't exist, i.e. storage.ErrConfigNotFound.
+	ErrorCodeConfigNotFound = "config_not_found"
+)
+
+// Server exposes storage over an HTTP JSON API. Requests must be
+// authenticated by a bearer token, and are only allowed for service paths
+// that the token has been granted permissions on.
+//
+// Values are returned as stored, i.e. references are not resolved, since
+// resolving them could reveal values of service paths that the token has no
+// permissions on.
+type Server struct {
+	log     logger.Logger
+	storage storage.Storage
+	tokens  []Token
+}
+
+// New returns a Server for s, allowing the tokens in config.
+func New(log logger.Logger, s storage.Storage, config Config) (*Server, error) {
+	err := config.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		log:     log,
+		storage: s,
+		tokens:  config.Tokens,
+	}, nil
+}
+
+// ListenAndServe serves the API on addr until ctx is cancelled. If certFile
+// and keyFile are given, TLS is used.
+func (s *Server) ListenAndServe(ctx context.Context, addr string, certFile string, keyFile string) error {
+	httpServer := &http.Server{
+		Addr:              addr,
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	var err error
+	if len(certFile) > 0 {
+		err = httpServer.ListenAndServeTLS(certFile, keyFile)
+	} else {
+		err = httpServer.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return ctx.Err()
+	}
+
+	return err
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t0 := time.Now()
+	rw := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+	tokenName := "-"
+	defer func() {
+		s.log.Infof("%s %s %s %d %s", tokenName, r.Method, r.URL.Path, rw.status, time.Since(t0))
+	}()
+
+	if r.URL.Path == PathHealth {
+		writeJSON(rw, http.StatusOK, map[string]string{"status": "ok"})
+		return
+	}
+
+	token, ok := s.authenticate(r)
+	if !ok {
+		writeError(rw, http.StatusUnauthorized, errUnauthorized)
+		return
+	}
+	tokenName = token.Name
+
+	err := s.route(rw, r, token)
+	if err != nil {
+		writeError(rw, errorStatus(err), err)
+	}
+}
+
+func (s *Server) route(w http.ResponseWriter, r *http.Request, token Token) error {
+	ctx := r.Context()
+
+	if r.URL.Path == PathMetadataKeys {
+		if r.Method != http.MethodGet {
+			return errMethodNotAllowed
+		}
+		return s.metadataKeys(w)
+	}
+
+	routes := map[string]map[string]func(context.Context, http.ResponseWriter, *http.Request, confman.Confman) error{
+		PathConfig: {
+			http.MethodGet:    s.readConfig,
+			http.MethodPut:    s.writeConfig,
+			http.MethodDelete: s.deleteConfig,
+		},
+		PathMetadata: {
+			http.MethodGet: s.readMetadata,
+		},
+		PathDiff: {
+			http.MethodPost: s.diff,
+		},
+	}
+
+	for prefix, methods := range routes {
+		if !strings.HasPrefix(r.URL.Path, prefix+"/") {
+			continue
+		}
+
+		handler, exists := methods[r.Method]
+		if !exists {
+			return errMethodNotAllowed
+		}
+
+		servicePath := confman.FormatServicePath(strings.TrimPrefix(r.URL.Path, prefix))
+		if len(servicePath) == 0 {
+			return fmt.Errorf("%w: service path missing", errBadRequest)
+		}
+
+		// Service paths are checked against tokens as given, so segments
+		// that storage may resolve to other service paths are rejected.
+		if !isCleanServicePath(servicePath) {
+			return fmt.Errorf("%w: service path %q must not contain empty, \".\" or \"..\" segments", errBadRequest, servicePath)
+		}
+
+		// Storage may join keys with the service path, so keys are checked
+		// for the same reason.
+		_, err := queryKeys(r)
+		if err != nil {
+			return err
+		}
+
+		permission := requiredPermission(r)
+		if !token.allows(servicePath, permission) {
+			return fmt.Errorf("%w: %s on %s", errForbidden, permission, servicePath)
+		}
+
+		return handler(ctx, w, r, confman.New(s.log, s.storage, servicePath))
+	}
+
+	return errNotFound
+}
+
+// isCleanServicePath returns whether servicePath has no empty, "." or ".."
+// segments.
+func isCleanServicePath(servicePath string) bool {
+	for _, segment := range strings.Split(strings.TrimPrefix(servicePath, "/"), "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// validateKey returns an error if key could be resolved to a key of another
+// service path by storage, i.e. if it is empty, ".", ".." or contains "/".
+func validateKey(key string) error {
+	if key == "" || key == "." || key == ".." || strings.Contains(key, "/") {
+		return fmt.Errorf("%w: key %q must not be empty, \".\", \"..\" or contain \"/\"", errBadRequest, key)
+	}
+	return nil
+}
+
+// requiredPermission returns the permission needed for r.
+func requiredPermission(r *http.Request) string {
+	switch {
+	case r.Method == http.MethodPut || r.Method == http.MethodDelete:
+		return PermissionWrite
+	case strings.HasPrefix(r.URL.Path, PathMetadata+"/") && r.URL.Query().Get("reveal") != "true":
+		return PermissionList
+	default:
+		return PermissionRead
+	}
+}
+
+// authenticate returns the token given in the Authorization header of r.
+func (s *Server) authenticate(r *http.Request) (Token, bool) {
+	const bearerPrefix = "Bearer "
+
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, bearerPrefix) {
+		return Token{}, false
+	}
+	requestToken := []byte(strings.TrimPrefix(authorization, bearerPrefix))
+
+	for _, token := range s.tokens {
+		if subtle.ConstantTimeCompare(requestToken, []byte(token.Token)) == 1 {
+			return token, true
+		}
+	}
+
+	return Token{}, false
+}
+
+// readConfig returns the configuration of the service path, or the keys
+// given in the keys query parameter (comma separated).
+func (s *Server) readConfig(ctx context.Context, w http.ResponseWriter, r *http.Request, cm confman.Confman) error {
+	keys, err := queryKeys(r)
+	if err != nil {
+		return err
+	}
+
+	var config map[string]string
+	if len(keys) > 0 {
+		config, err = cm.ReadKeys(ctx, keys)
+	} else {
+		config, err = cm.ReadAll(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, http.StatusOK, ConfigResponse{
+		ServicePath: cm.ServicePath(),
+		Config:      config,
+	})
+}
+
+// writeConfig writes the keys in the request body, a JSON object of keys and
+// values. With define=true, keys not in the request body are deleted.
+func (s *Server) writeConfig(ctx context.Context, w http.ResponseWriter, r *http.Request, cm confman.Confman) error {
+	config, err := readConfigBody(r)
+	if err != nil {
+		return err
+	}
+
+	if r.URL.Query().Get("define") == "true" {
+		err = cm.Define(ctx, config)
+	} else {
+		err = cm.WriteKeys(ctx, config)
+	}
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// deleteConfig deletes the keys given in the keys query parameter, or all
+// keys with all=true.
+func (s *Server) deleteConfig(ctx context.Context, w http.ResponseWriter, r *http.Request, cm confman.Confman) error {
+	keys, err := queryKeys(r)
+	if err != nil {
+		return err
+	}
+
+	if len(keys) > 0 {
+		err = cm.DeleteKeys(ctx, keys)
+	} else if r.URL.Query().Get("all") == "true" {
+		err = cm.DeleteAll(ctx)
+	} else {
+		return fmt.Errorf("%w: keys or all=true must be given", errBadRequest)
+	}
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// readMetadata returns the metadata of all keys of the service path. Values
+// are omitted unless reveal=true is given.
+func (s *Server) readMetadata(ctx context.Context, w http.ResponseWriter, r *http.Request, cm confman.Confman) error {
+	keyMetadata, err := cm.ReadAllMetadata(ctx)
+	if err != nil {
+		return err
+	}
+
+	if r.URL.Query().Get("reveal") != "true" {
+		for i := range keyMetadata {
+			keyMetadata[i].Value = ""
+		}
+	}
+
+	sort.Slice(keyMetadata, func(i, j int) bool {
+		return keyMetadata[i].Key < keyMetadata[j].Key
+	})
+
+	return writeJSON(w, http.StatusOK, MetadataResponse{
+		ServicePath: cm.ServicePath(),
+		Keys:        keyMetadata,
+	})
+}
+
+func (s *Server) metadataKeys(w http.ResponseWriter) error {
+	return writeJSON(w, http.StatusOK, MetadataKeysResponse{
+		MetadataKeys: s.storage.MetadataKeys(),
+	})
+}
+
+// diff returns the keys that would be added, updated and deleted if the
+// configuration in the request body was defined for the service path.
+func (s *Server) diff(ctx context.Context, w http.ResponseWriter, r *http.Request, cm confman.Confman) error {
+	config, err := readConfigBody(r)
+	if err != nil {
+		return err
+	}
+
+	current, err := cm.ReadAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	response := DiffResponse{
+		ServicePath: cm.ServicePath(),
+		Added:       []string{},
+		Updated:     []string{},
+		Deleted:     []string{},
+		Unchanged:   []string{},
+	}
+	for key, value := range config {
+		currentValue, exists := current[key]
+		switch {
+		case !exists:
+			response.Added = append(response.Added, key)
+		case currentValue != value:
+			response.Updated = append(response.Updated, key)
+		default:
+			response.Unchanged = append(response.Unchanged, key)
+		}
+	}
+	for _, key := range mapy.Keys(current) {
+		if _, exists := config[key]; !exists {
+			response.Deleted = append(response.Deleted, key)
+		}
+	}
+
+	for _, keys := range [][]string{response.Added, response.Updated, response.Deleted, response.Unchanged} {
+		sort.Strings(keys)
+	}
+
+	return writeJSON(w, http.StatusOK, response)
+}
+
+// queryKeys returns the keys given in the keys query parameter of r.
+func queryKeys(r *http.Request) ([]string, error) {
+	keys := []string{}
+	for _, value := range r.URL.Query()["keys"] {
+		for _, key := range strings.Split(value, ",") {
+			if len(key) == 0 {
+				continue
+			}
+			err := validateKey(key)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+func readConfigBody(r *http.Request) (map[string]string, error) {
+	bs, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(bs) > maxBodySize {
+		return nil, fmt.Errorf("%w: request body too large", errBadRequest)
+	}
+
+	config := map[string]string{}
+	err = json.Unmarshal(bs, &config)
+	if err != nil {
+		return nil, fmt.Errorf("%w: expected JSON object of keys and values: %s", errBadRequest, err)
+	}
+
+	for key := range config {
+		err := validateKey(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return config, nil
+}
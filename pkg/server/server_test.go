@@ -0,0 +1,259 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/micvbang/confman-go/pkg/confman"
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/server"
+	"github.com/micvbang/confman-go/pkg/storage/memory"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+var log = logger.LogrusWrapper{Logger: logrus.New()}
+
+const (
+	adminToken     = "admin-token"
+	dashboardToken = "dashboard-token"
+	emailToken     = "email-token"
+)
+
+func newTestServer(t *testing.T) (*httptest.Server, *memory.Memory) {
+	confman.ChamberCompatible = false
+
+	m := memory.New(log)
+	err := m.WriteKeys(context.Background(), "/email-dispatch/production", map[string]string{
+		"DB_HOST":     "db",
+		"DB_PASSWORD": "secret",
+	})
+	require.NoError(t, err)
+
+	s, err := server.New(log, m, server.Config{
+		Tokens: []server.Token{
+			{
+				Name:  "admin",
+				Token: adminToken,
+				Rules: []server.Rule{{Prefix: "/", Permissions: []string{server.PermissionRead, server.PermissionWrite}}},
+			},
+			{
+				Name:  "dashboard",
+				Token: dashboardToken,
+				Rules: []server.Rule{
+					{Prefix: "/", Permissions: []string{server.PermissionList}},
+					{Prefix: "/email-dispatch", Permissions: []string{server.PermissionRead}},
+				},
+			},
+			{
+				Name:  "email",
+				Token: emailToken,
+				Rules: []server.Rule{{Prefix: "/email-dispatch", Permissions: []string{server.PermissionRead, server.PermissionWrite}}},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+
+	return ts, m
+}
+
+func doRequest(t *testing.T, ts *httptest.Server, token string, method string, path string, body interface{}, response interface{}) int {
+	var bodyReader *bytes.Reader
+	if body != nil {
+		bs, err := json.Marshal(body)
+		require.NoError(t, err)
+		bodyReader = bytes.NewReader(bs)
+	} else {
+		bodyReader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, ts.URL+path, bodyReader)
+	require.NoError(t, err)
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := ts.Client().Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	if response != nil && res.StatusCode < 300 {
+		require.NoError(t, json.NewDecoder(res.Body).Decode(response))
+	}
+
+	return res.StatusCode
+}
+
+// TestServerReadWriteDelete verifies that configuration can be read, written
+// and deleted through the API.
+func TestServerReadWriteDelete(t *testing.T) {
+	ts, _ := newTestServer(t)
+
+	config := server.ConfigResponse{}
+	status := doRequest(t, ts, adminToken, http.MethodGet, "/v1/config/email-dispatch/production", nil, &config)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, server.ConfigResponse{
+		ServicePath: "/email-dispatch/production",
+		Config:      map[string]string{"DB_HOST": "db", "DB_PASSWORD": "secret"},
+	}, config)
+
+	status = doRequest(t, ts, adminToken, http.MethodPut, "/v1/config/email-dispatch/production", map[string]string{"DB_HOST": "new-db", "DB_PORT": "5432"}, nil)
+	require.Equal(t, http.StatusNoContent, status)
+
+	config = server.ConfigResponse{}
+	status = doRequest(t, ts, adminToken, http.MethodGet, "/v1/config/email-dispatch/production?keys=DB_HOST,DB_PORT", nil, &config)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, map[string]string{"DB_HOST": "new-db", "DB_PORT": "5432"}, config.Config)
+
+	status = doRequest(t, ts, adminToken, http.MethodDelete, "/v1/config/email-dispatch/production?keys=DB_PORT", nil, nil)
+	require.Equal(t, http.StatusNoContent, status)
+
+	status = doRequest(t, ts, adminToken, http.MethodGet, "/v1/config/email-dispatch/production?keys=DB_PORT", nil, nil)
+	require.Equal(t, http.StatusNotFound, status)
+
+	status = doRequest(t, ts, adminToken, http.MethodDelete, "/v1/config/email-dispatch/production", nil, nil)
+	require.Equal(t, http.StatusBadRequest, status)
+
+	status = doRequest(t, ts, adminToken, http.MethodPut, "/v1/config/email-dispatch/production?define=true", map[string]string{"DB_HOST": "db"}, nil)
+	require.Equal(t, http.StatusNoContent, status)
+
+	config = server.ConfigResponse{}
+	doRequest(t, ts, adminToken, http.MethodGet, "/v1/config/email-dispatch/production", nil, &config)
+	require.Equal(t, map[string]string{"DB_HOST": "db"}, config.Config)
+
+	status = doRequest(t, ts, adminToken, http.MethodDelete, "/v1/config/email-dispatch/production?all=true", nil, nil)
+	require.Equal(t, http.StatusNoContent, status)
+
+	config = server.ConfigResponse{}
+	doRequest(t, ts, adminToken, http.MethodGet, "/v1/config/email-dispatch/production", nil, &config)
+	require.Empty(t, config.Config)
+}
+
+// TestServerMetadataDiff verifies that metadata is returned without values
+// unless reveal=true is given, and that diff reports the keys that would
+// change.
+func TestServerMetadataDiff(t *testing.T) {
+	ts, m := newTestServer(t)
+
+	metadata := server.MetadataResponse{}
+	status := doRequest(t, ts, adminToken, http.MethodGet, "/v1/metadata/email-dispatch/production", nil, &metadata)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, 2, len(metadata.Keys))
+	require.Equal(t, "DB_HOST", metadata.Keys[0].Key)
+	require.Empty(t, metadata.Keys[0].Value)
+	require.NotEmpty(t, metadata.Keys[0].Metadata)
+
+	metadata = server.MetadataResponse{}
+	doRequest(t, ts, adminToken, http.MethodGet, "/v1/metadata/email-dispatch/production?reveal=true", nil, &metadata)
+	require.Equal(t, "db", metadata.Keys[0].Value)
+
+	metadataKeys := server.MetadataKeysResponse{}
+	status = doRequest(t, ts, adminToken, http.MethodGet, "/v1/metadata-keys", nil, &metadataKeys)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, m.MetadataKeys(), metadataKeys.MetadataKeys)
+
+	diff := server.DiffResponse{}
+	status = doRequest(t, ts, adminToken, http.MethodPost, "/v1/diff/email-dispatch/production", map[string]string{"DB_HOST": "new-db", "DB_PORT": "5432"}, &diff)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, server.DiffResponse{
+		ServicePath: "/email-dispatch/production",
+		Added:       []string{"DB_PORT"},
+		Updated:     []string{"DB_HOST"},
+		Deleted:     []string{"DB_PASSWORD"},
+		Unchanged:   []string{},
+	}, diff)
+}
+
+// TestServerAuthorization verifies that requests without a valid token are
+// rejected, that tokens are only allowed what their rules grant, and that
+// service paths and keys that could escape the granted prefixes are rejected.
+func TestServerAuthorization(t *testing.T) {
+	ts, _ := newTestServer(t)
+
+	tests := map[string]struct {
+		token    string
+		method   string
+		path     string
+		body     interface{}
+		expected int
+	}{
+		"no token":             {token: "", method: http.MethodGet, path: "/v1/config/email-dispatch/production", expected: http.StatusUnauthorized},
+		"invalid token":        {token: "invalid", method: http.MethodGet, path: "/v1/config/email-dispatch/production", expected: http.StatusUnauthorized},
+		"health without token": {token: "", method: http.MethodGet, path: "/healthz", expected: http.StatusOK},
+		"read granted":         {token: dashboardToken, method: http.MethodGet, path: "/v1/config/email-dispatch/production", expected: http.StatusOK},
+		"read other prefix":    {token: dashboardToken, method: http.MethodGet, path: "/v1/config/billing/production", expected: http.StatusForbidden},
+		"read segment prefix":  {token: dashboardToken, method: http.MethodGet, path: "/v1/config/email-dispatch-v2/production", expected: http.StatusForbidden},
+		"list other prefix":    {token: dashboardToken, method: http.MethodGet, path: "/v1/metadata/billing/production", expected: http.StatusOK},
+		"reveal other prefix":  {token: dashboardToken, method: http.MethodGet, path: "/v1/metadata/billing/production?reveal=true", expected: http.StatusForbidden},
+		"diff other prefix":    {token: dashboardToken, method: http.MethodPost, path: "/v1/diff/billing/production", body: map[string]string{}, expected: http.StatusForbidden},
+		"write not granted":    {token: dashboardToken, method: http.MethodPut, path: "/v1/config/email-dispatch/production", body: map[string]string{"KEY": "value"}, expected: http.StatusForbidden},
+		"delete not granted":   {token: dashboardToken, method: http.MethodDelete, path: "/v1/config/email-dispatch/production?all=true", expected: http.StatusForbidden},
+		"unknown endpoint":     {token: adminToken, method: http.MethodGet, path: "/v1/unknown/email-dispatch", expected: http.StatusNotFound},
+		"method not allowed":   {token: adminToken, method: http.MethodPost, path: "/v1/config/email-dispatch/production", expected: http.StatusMethodNotAllowed},
+		"missing service path": {token: adminToken, method: http.MethodGet, path: "/v1/config/", expected: http.StatusBadRequest},
+		"dot dot segment":      {token: dashboardToken, method: http.MethodGet, path: "/v1/config/email-dispatch/../billing/production", expected: http.StatusBadRequest},
+		"encoded dot segment":  {token: dashboardToken, method: http.MethodGet, path: "/v1/config/email-dispatch/%2e%2e/billing/production", expected: http.StatusBadRequest},
+		"dot segment":          {token: dashboardToken, method: http.MethodGet, path: "/v1/config/email-dispatch/./production", expected: http.StatusBadRequest},
+		"empty segment":        {token: adminToken, method: http.MethodGet, path: "/v1/config/email-dispatch//production", expected: http.StatusBadRequest},
+		"dot dot key read":     {token: dashboardToken, method: http.MethodGet, path: "/v1/config/email-dispatch/production?keys=../../billing/production/SECRET", expected: http.StatusBadRequest},
+		"dot dot key delete":   {token: emailToken, method: http.MethodDelete, path: "/v1/config/email-dispatch/production?keys=DB_HOST,../../billing/production/SECRET", expected: http.StatusBadRequest},
+		"slash key write":      {token: emailToken, method: http.MethodPut, path: "/v1/config/email-dispatch/production", body: map[string]string{"../../billing/production/SECRET": "value"}, expected: http.StatusBadRequest},
+		"dot dot key diff":     {token: dashboardToken, method: http.MethodPost, path: "/v1/diff/email-dispatch/production", body: map[string]string{"..": "value"}, expected: http.StatusBadRequest},
+		"invalid body":         {token: adminToken, method: http.MethodPut, path: "/v1/config/email-dispatch/production", body: []string{"KEY"}, expected: http.StatusBadRequest},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			status := doRequest(t, ts, test.token, test.method, test.path, test.body, nil)
+			require.Equal(t, test.expected, status)
+		})
+	}
+}
+
+// TestReadConfig verifies that server configs are read, that tokens can be
+// given by environment variables, and that invalid configs are rejected.
+func TestReadConfig(t *testing.T) {
+	t.Setenv("TEST_CONFMAN_TOKEN", "token-from-env")
+
+	configPath := filepath.Join(t.TempDir(), "server.yml")
+	err := os.WriteFile(configPath, []byte(`
+tokens:
+  - name: dashboard
+    token_env: TEST_CONFMAN_TOKEN
+    rules:
+      - prefix: /email-dispatch
+        permissions: [read]
+`), 0600)
+	require.NoError(t, err)
+
+	config, err := server.ReadConfig(configPath)
+	require.NoError(t, err)
+	require.Equal(t, "token-from-env", config.Tokens[0].Token)
+
+	invalidConfigs := map[string]string{
+		"no tokens":          "tokens: []\n",
+		"unknown field":      "tokens:\n  - name: a\n    token: t\n    unknown: true\n",
+		"no name":            "tokens:\n  - token: t\n",
+		"empty token":        "tokens:\n  - name: a\n    token_env: TEST_CONFMAN_UNSET_TOKEN\n",
+		"duplicate name":     "tokens:\n  - name: a\n    token: t1\n  - name: a\n    token: t2\n",
+		"relative prefix":    "tokens:\n  - name: a\n    token: t\n    rules:\n      - prefix: service\n        permissions: [read]\n",
+		"unknown permission": "tokens:\n  - name: a\n    token: t\n    rules:\n      - prefix: /\n        permissions: [admin]\n",
+	}
+
+	for name, invalidConfig := range invalidConfigs {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, os.WriteFile(configPath, []byte(invalidConfig), 0600))
+			_, err := server.ReadConfig(configPath)
+			require.ErrorIs(t, err, server.ErrInvalidConfig)
+		})
+	}
+}
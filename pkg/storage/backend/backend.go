@@ -0,0 +1,347 @@
+// Package backend selects and configures storage backends the same way the
+// CLI does, such that services using the client read configuration from the
+// storage that the CLI writes it to.
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	awssecretsmanager "github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/micvbang/confman-go/pkg/encryption"
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/storage"
+	"github.com/micvbang/confman-go/pkg/storage/git"
+	"github.com/micvbang/confman-go/pkg/storage/parameterstore"
+	"github.com/micvbang/confman-go/pkg/storage/remote"
+	"github.com/micvbang/confman-go/pkg/storage/secretsmanager"
+	"github.com/micvbang/confman-go/pkg/storage/sqlite"
+	"github.com/micvbang/confman-go/pkg/storage/vault"
+)
+
+// Supported storage backends
+const (
+	ParameterStore = "parameterstore"
+	Remote         = "remote"
+	Vault          = "vault"
+	SecretsManager = "secretsmanager"
+	Git            = "git"
+	SQLite         = "sqlite"
+)
+
+// Types holds the supported storage backends.
+var Types = []string{ParameterStore, Remote, Vault, SecretsManager, Git, SQLite}
+
+// Supported key providers of client-side encryption
+const (
+	KeyProviderNone       = "none"
+	KeyProviderKeyFile    = "key-file"
+	KeyProviderPassphrase = "passphrase"
+	KeyProviderKMS        = "kms"
+)
+
+// KeyProviderTypes holds the supported key providers.
+var KeyProviderTypes = []string{KeyProviderNone, KeyProviderKeyFile, KeyProviderPassphrase, KeyProviderKMS}
+
+// Defaults of Config
+const (
+	DefaultKMSKeyAlias       = "parameter_store_key"
+	DefaultVaultMount        = "secret"
+	DefaultVaultAppRoleMount = "approle"
+)
+
+var ErrInvalidConfig = errors.New("invalid storage config")
+
+// KeyProviderConfig selects and configures a key provider.
+type KeyProviderConfig struct {
+	// Type is one of KeyProviderTypes; no key provider is used if empty.
+	Type string
+
+	KeyFile string
+
+	// CreateKeyFile makes the key file be generated if it doesn't exist.
+	CreateKeyFile bool
+
+	Passphrase string
+	KMSKeyID   string
+}
+
+// Config selects and configures a storage backend.
+type Config struct {
+	// Type is one of Types, defaulting to ParameterStore.
+	Type string
+
+	KMSKeyAlias string
+	KMSKeyRules []parameterstore.KMSKeyRule
+
+	RemoteURL   string
+	RemoteToken string
+
+	Vault vault.Config
+
+	SecretsManagerKMSKeyID string
+
+	Git    git.Config
+	SQLite sqlite.Config
+
+	// Encryption selects the key provider used for encrypting values
+	// client-side.
+	Encryption KeyProviderConfig
+
+	// AWSConfig returns the AWS config used by AWS storage backends and key
+	// providers, defaulting to the default AWS config.
+	AWSConfig func(ctx context.Context) (aws.Config, error)
+}
+
+// Environment variables read by ConfigFromEnvironment, which are the same as
+// those of the CLI flags.
+const (
+	EnvStorage                = "CONFMAN_STORAGE"
+	EnvKMSKeyAlias            = "CONFMAN_KMS_KEY_ALIAS"
+	EnvKMSKeyRules            = "CONFMAN_KMS_KEY_RULES"
+	EnvKMSKeyRulesFile        = "CONFMAN_KMS_KEY_RULES_FILE"
+	EnvRemoteURL              = "CONFMAN_REMOTE_URL"
+	EnvRemoteToken            = "CONFMAN_REMOTE_TOKEN"
+	EnvVaultAddr              = "VAULT_ADDR"
+	EnvVaultToken             = "VAULT_TOKEN"
+	EnvVaultNamespace         = "VAULT_NAMESPACE"
+	EnvVaultMount             = "CONFMAN_VAULT_MOUNT"
+	EnvVaultRoleID            = "CONFMAN_VAULT_ROLE_ID"
+	EnvVaultSecretID          = "CONFMAN_VAULT_SECRET_ID"
+	EnvVaultAppRoleMount      = "CONFMAN_VAULT_APPROLE_MOUNT"
+	EnvSecretsManagerKMSKeyID = "CONFMAN_SECRETSMANAGER_KMS_KEY_ID"
+	EnvGitRepo                = "CONFMAN_GIT_REPO"
+	EnvGitKeyFile             = "CONFMAN_GIT_KEY_FILE"
+	EnvSQLitePath             = "CONFMAN_SQLITE_PATH"
+	EnvSQLiteKeyFile          = "CONFMAN_SQLITE_KEY_FILE"
+	EnvEncryption             = "CONFMAN_ENCRYPTION"
+)
+
+// newlines separates the values of environment variables holding lists, the
+// same way as the CLI does.
+var newlines = regexp.MustCompile(`\r?\n`)
+
+// ConfigFromEnvironment returns the Config given by the environment variables
+// that configure storage in the CLI, e.g. CONFMAN_STORAGE and
+// CONFMAN_SQLITE_PATH. Key providers are configured by CONFMAN_ENCRYPTION
+// and the variables starting with it.
+func ConfigFromEnvironment() (Config, error) {
+	var kmsKeyRules []string
+	if s := os.Getenv(EnvKMSKeyRules); len(s) > 0 {
+		kmsKeyRules = newlines.Split(s, -1)
+	}
+
+	rules, err := KMSKeyRules(kmsKeyRules, os.Getenv(EnvKMSKeyRulesFile))
+	if err != nil {
+		return Config{}, err
+	}
+
+	createKeyFile := false
+	if s := os.Getenv(EnvEncryption + "_CREATE_KEY_FILE"); len(s) > 0 {
+		createKeyFile, err = strconv.ParseBool(s)
+		if err != nil {
+			return Config{}, fmt.Errorf("parsing %s_CREATE_KEY_FILE: %w", EnvEncryption, err)
+		}
+	}
+
+	return Config{
+		Type:        getenv(EnvStorage, ParameterStore),
+		KMSKeyAlias: getenv(EnvKMSKeyAlias, DefaultKMSKeyAlias),
+		KMSKeyRules: rules,
+		RemoteURL:   os.Getenv(EnvRemoteURL),
+		RemoteToken: os.Getenv(EnvRemoteToken),
+		Vault: vault.Config{
+			Address:      os.Getenv(EnvVaultAddr),
+			Token:        os.Getenv(EnvVaultToken),
+			Namespace:    os.Getenv(EnvVaultNamespace),
+			Mount:        getenv(EnvVaultMount, DefaultVaultMount),
+			RoleID:       os.Getenv(EnvVaultRoleID),
+			SecretID:     os.Getenv(EnvVaultSecretID),
+			AppRoleMount: getenv(EnvVaultAppRoleMount, DefaultVaultAppRoleMount),
+		},
+		SecretsManagerKMSKeyID: os.Getenv(EnvSecretsManagerKMSKeyID),
+		Git: git.Config{
+			Repository: os.Getenv(EnvGitRepo),
+			KeyFile:    os.Getenv(EnvGitKeyFile),
+		},
+		SQLite: sqlite.Config{
+			Path:    os.Getenv(EnvSQLitePath),
+			KeyFile: os.Getenv(EnvSQLiteKeyFile),
+		},
+		Encryption: KeyProviderConfig{
+			Type:          getenv(EnvEncryption, KeyProviderNone),
+			KeyFile:       os.Getenv(EnvEncryption + "_KEY_FILE"),
+			CreateKeyFile: createKeyFile,
+			Passphrase:    os.Getenv(EnvEncryption + "_PASSPHRASE"),
+			KMSKeyID:      os.Getenv(EnvEncryption + "_KMS_KEY_ID"),
+		},
+	}, nil
+}
+
+func getenv(key string, defaultValue string) string {
+	value := os.Getenv(key)
+	if len(value) == 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// New returns the storage backend selected by config, encrypting values
+// client-side if a key provider is selected.
+func New(ctx context.Context, log logger.Logger, config Config) (storage.Storage, error) {
+	s, err := newBackend(ctx, log, config)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := NewKeyProvider(ctx, config.Encryption, config.AWSConfig)
+	if err != nil {
+		return nil, err
+	}
+	if provider == nil {
+		return s, nil
+	}
+
+	return storage.NewEncrypting(log, s, provider), nil
+}
+
+// newBackend returns the storage backend selected by config.
+func newBackend(ctx context.Context, log logger.Logger, config Config) (storage.Storage, error) {
+	switch config.Type {
+	case Remote:
+		if len(config.RemoteURL) == 0 {
+			return nil, fmt.Errorf("%w: remote URL must be given when using remote storage", ErrInvalidConfig)
+		}
+		return remote.New(log, nil, config.RemoteURL, config.RemoteToken), nil
+
+	case Vault:
+		return vault.New(log, nil, config.Vault)
+
+	case Git:
+		if len(config.Git.Repository) == 0 {
+			return nil, fmt.Errorf("%w: git repository must be given when using git storage", ErrInvalidConfig)
+		}
+		return git.New(log, config.Git)
+
+	case SQLite:
+		if len(config.SQLite.Path) == 0 {
+			return nil, fmt.Errorf("%w: sqlite path must be given when using sqlite storage", ErrInvalidConfig)
+		}
+		if len(config.SQLite.KeyFile) == 0 {
+			return nil, fmt.Errorf("%w: sqlite key file must be given when using sqlite storage", ErrInvalidConfig)
+		}
+		return sqlite.New(log, config.SQLite)
+
+	case SecretsManager:
+		awsCfg, err := loadAWSConfig(ctx, config.AWSConfig)
+		if err != nil {
+			return nil, err
+		}
+		return secretsmanager.New(log, awssecretsmanager.NewFromConfig(awsCfg), config.SecretsManagerKMSKeyID), nil
+
+	case ParameterStore, "":
+		awsCfg, err := loadAWSConfig(ctx, config.AWSConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		kmsKeyAlias := config.KMSKeyAlias
+		if len(kmsKeyAlias) == 0 {
+			kmsKeyAlias = DefaultKMSKeyAlias
+		}
+
+		ps := parameterstore.New(log, ssm.NewFromConfig(awsCfg), kmsKeyAlias)
+		ps.SetKMSKeyRules(config.KMSKeyRules)
+		return ps, nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown storage '%s'", ErrInvalidConfig, config.Type)
+}
+
+// NewKeyProvider returns the key provider selected by kp, or nil if none is.
+// awsConfig returns the AWS config used by the kms key provider, defaulting
+// to the default AWS config if nil.
+func NewKeyProvider(ctx context.Context, kp KeyProviderConfig, awsConfig func(context.Context) (aws.Config, error)) (encryption.KeyProvider, error) {
+	switch kp.Type {
+	case KeyProviderNone, "":
+		return nil, nil
+
+	case KeyProviderKeyFile:
+		if len(kp.KeyFile) == 0 {
+			return nil, fmt.Errorf("%w: key file must be given when using the key-file key provider", ErrInvalidConfig)
+		}
+
+		// Keys are only generated when asked to, since a mistyped path would
+		// otherwise encrypt values using a key that nobody else has.
+		load := encryption.LoadKeyFile
+		if kp.CreateKeyFile {
+			load = encryption.LoadOrCreateKeyFile
+		}
+
+		key, err := load(kp.KeyFile)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("key file %s doesn't exist, use the create-key-file option to generate it: %w", kp.KeyFile, err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return encryption.NewKeyProvider(key)
+
+	case KeyProviderPassphrase:
+		return encryption.NewPassphraseProvider(kp.Passphrase)
+
+	case KeyProviderKMS:
+		awsCfg, err := loadAWSConfig(ctx, awsConfig)
+		if err != nil {
+			return nil, err
+		}
+		return encryption.NewKMSProvider(encryption.NewAWSKMS(kms.NewFromConfig(awsCfg)), kp.KMSKeyID)
+	}
+
+	return nil, fmt.Errorf("%w: unknown key provider '%s'", ErrInvalidConfig, kp.Type)
+}
+
+// loadAWSConfig returns the AWS config given by awsConfig, or the default
+// AWS config if awsConfig is nil.
+func loadAWSConfig(ctx context.Context, awsConfig func(context.Context) (aws.Config, error)) (aws.Config, error) {
+	if awsConfig != nil {
+		return awsConfig(ctx)
+	}
+
+	awsCfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return awsCfg, fmt.Errorf("failed to init aws config: %w", err)
+	}
+	return awsCfg, nil
+}
+
+// KMSKeyRules returns the parsed rules, followed by the rules of rulesFile if
+// it is given.
+func KMSKeyRules(rules []string, rulesFile string) ([]parameterstore.KMSKeyRule, error) {
+	parsed := make([]parameterstore.KMSKeyRule, 0, len(rules))
+	for _, s := range rules {
+		rule, err := parameterstore.ParseKMSKeyRule(s)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, rule)
+	}
+
+	if len(rulesFile) > 0 {
+		fileRules, err := parameterstore.LoadKMSKeyRules(rulesFile)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, fileRules...)
+	}
+
+	return parsed, nil
+}
@@ -0,0 +1,115 @@
+package backend_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/storage"
+	"github.com/micvbang/confman-go/pkg/storage/backend"
+	"github.com/micvbang/confman-go/pkg/storage/parameterstore"
+	"github.com/micvbang/confman-go/pkg/storage/sqlite"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+var log = logger.LogrusWrapper{Logger: logrus.New()}
+
+// TestConfigFromEnvironment verifies that the config is read from the
+// environment variables of the CLI, using the defaults of the CLI.
+func TestConfigFromEnvironment(t *testing.T) {
+	t.Setenv(backend.EnvStorage, backend.SQLite)
+	t.Setenv(backend.EnvKMSKeyAlias, "")
+	t.Setenv(backend.EnvKMSKeyRules, "/payments/*=alias/payments\n/billing/*=alias/billing")
+	t.Setenv(backend.EnvKMSKeyRulesFile, "")
+	t.Setenv(backend.EnvVaultMount, "")
+	t.Setenv(backend.EnvSQLitePath, "/var/lib/confman.db")
+	t.Setenv(backend.EnvSQLiteKeyFile, "/etc/confman.key")
+	t.Setenv(backend.EnvEncryption, backend.KeyProviderKeyFile)
+	t.Setenv(backend.EnvEncryption+"_KEY_FILE", "/etc/confman-encryption.key")
+	t.Setenv(backend.EnvEncryption+"_CREATE_KEY_FILE", "true")
+
+	config, err := backend.ConfigFromEnvironment()
+	require.NoError(t, err)
+	require.Equal(t, backend.SQLite, config.Type)
+	require.Equal(t, backend.DefaultKMSKeyAlias, config.KMSKeyAlias)
+	require.Equal(t, []parameterstore.KMSKeyRule{
+		{Pattern: "/payments/*", KeyID: "alias/payments"},
+		{Pattern: "/billing/*", KeyID: "alias/billing"},
+	}, config.KMSKeyRules)
+	require.Equal(t, backend.DefaultVaultMount, config.Vault.Mount)
+	require.Equal(t, sqlite.Config{Path: "/var/lib/confman.db", KeyFile: "/etc/confman.key"}, config.SQLite)
+	require.Equal(t, backend.KeyProviderConfig{
+		Type:          backend.KeyProviderKeyFile,
+		KeyFile:       "/etc/confman-encryption.key",
+		CreateKeyFile: true,
+	}, config.Encryption)
+
+	t.Setenv(backend.EnvEncryption+"_CREATE_KEY_FILE", "maybe")
+	_, err = backend.ConfigFromEnvironment()
+	require.Error(t, err)
+}
+
+// TestNew verifies that the selected storage backend is returned, wrapped in
+// encryption if a key provider is selected, and that incomplete configs are
+// rejected.
+func TestNew(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := backend.New(ctx, log, backend.Config{
+		Type: backend.SQLite,
+		SQLite: sqlite.Config{
+			Path:    filepath.Join(dir, "confman.db"),
+			KeyFile: filepath.Join(dir, "confman.key"),
+		},
+		Encryption: backend.KeyProviderConfig{
+			Type:          backend.KeyProviderKeyFile,
+			KeyFile:       filepath.Join(dir, "encryption.key"),
+			CreateKeyFile: true,
+		},
+	})
+	require.NoError(t, err)
+
+	sq, ok := storage.Find[*sqlite.SQLite](s)
+	require.True(t, ok)
+	t.Cleanup(func() { sq.Close() })
+
+	_, ok = storage.Find[*storage.Encrypting](s)
+	require.True(t, ok)
+
+	invalidConfigs := map[string]backend.Config{
+		"remote without url":  {Type: backend.Remote},
+		"git without repo":    {Type: backend.Git},
+		"sqlite without path": {Type: backend.SQLite},
+		"unknown storage":     {Type: "unknown"},
+	}
+
+	for name, config := range invalidConfigs {
+		t.Run(name, func(t *testing.T) {
+			_, err := backend.New(ctx, log, config)
+			require.ErrorIs(t, err, backend.ErrInvalidConfig)
+		})
+	}
+}
+
+// TestNewKeyProviderKeyFile verifies that missing key files are only
+// generated when asked to, and that generated key files are used afterwards.
+func TestNewKeyProviderKeyFile(t *testing.T) {
+	ctx := context.Background()
+	keyFile := filepath.Join(t.TempDir(), "key")
+
+	_, err := backend.NewKeyProvider(ctx, backend.KeyProviderConfig{Type: backend.KeyProviderKeyFile, KeyFile: keyFile}, nil)
+	require.ErrorIs(t, err, os.ErrNotExist)
+	require.NoFileExists(t, keyFile)
+
+	created, err := backend.NewKeyProvider(ctx, backend.KeyProviderConfig{Type: backend.KeyProviderKeyFile, KeyFile: keyFile, CreateKeyFile: true}, nil)
+	require.NoError(t, err)
+	require.FileExists(t, keyFile)
+
+	loaded, err := backend.NewKeyProvider(ctx, backend.KeyProviderConfig{Type: backend.KeyProviderKeyFile, KeyFile: keyFile}, nil)
+	require.NoError(t, err)
+	require.Equal(t, created.KeyID(), loaded.KeyID())
+}
@@ -14,6 +14,10 @@ type ChamberCompatibility struct {
 }
 
 var _ Storage = &ChamberCompatibility{}
+var _ Wrapper = &ChamberCompatibility{}
+var _ OptionsWriter = &ChamberCompatibility{}
+var _ TagReader = &ChamberCompatibility{}
+var _ KeyValidator = &ChamberCompatibility{}
 
 func NewChamberCompatibility(log logger.Logger, storage Storage) *ChamberCompatibility {
 	log = log.WithField("storage_type", "ChamberCompatibility")
@@ -38,6 +42,40 @@ func (c *ChamberCompatibility) WriteKeys(ctx context.Context, servicePath string
 	return c.storage.WriteKeys(ctx, servicePath, newConfig)
 }
 
+func (c *ChamberCompatibility) WriteKeysWithOptions(ctx context.Context, servicePath string, config map[string]string, options map[string]WriteOptions) error {
+	c.log.Debugf("WriteKeysWithOptions(ctx, \"%s\", %+v, %+v)", servicePath, config, options)
+
+	newOptions := make(map[string]WriteOptions, len(options))
+	for key, keyOptions := range options {
+		newOptions[c.chamberKeyToLower(key)] = keyOptions
+	}
+
+	return WriteKeysWithOptions(ctx, c.storage, servicePath, c.chamberConfigToLower(config), newOptions)
+}
+
+// ValidateKeys validates the keys of config as they are written, returning
+// violations of the keys as given.
+func (c *ChamberCompatibility) ValidateKeys(ctx context.Context, servicePath string, config map[string]string, options map[string]WriteOptions) ([]Violation, error) {
+	keys := make(map[string]string, len(config))
+	for key := range config {
+		keys[c.chamberKeyToLower(key)] = key
+	}
+
+	newOptions := make(map[string]WriteOptions, len(options))
+	for key, keyOptions := range options {
+		newOptions[c.chamberKeyToLower(key)] = keyOptions
+	}
+
+	violations, err := ValidateKeys(ctx, c.storage, servicePath, c.chamberConfigToLower(config), newOptions)
+	for i, violation := range violations {
+		if key, ok := keys[violation.Key]; ok {
+			violations[i].Key = key
+		}
+	}
+
+	return violations, err
+}
+
 func (c *ChamberCompatibility) Read(ctx context.Context, servicePath string, key string) (value string, _ error) {
 	c.log.Debugf("Read(ctx, \"%s\", \"%s\")", servicePath, key)
 
@@ -66,6 +104,22 @@ func (c *ChamberCompatibility) ReadAllMetadata(ctx context.Context, servicePath
 	return c.chamberKeyMetaToUpper(keyMetadata), err
 }
 
+func (c *ChamberCompatibility) ReadTags(ctx context.Context, servicePath string) (map[string]map[string]string, error) {
+	c.log.Debugf("ReadTags(ctx, \"%s\")", servicePath)
+
+	tags, err := ReadTags(ctx, c.storage, servicePath)
+	if err != nil {
+		return nil, err
+	}
+
+	newTags := make(map[string]map[string]string, len(tags))
+	for key, keyTags := range tags {
+		newTags[c.chamberKeyToUpper(key)] = keyTags
+	}
+
+	return newTags, nil
+}
+
 func (c *ChamberCompatibility) Delete(ctx context.Context, servicePath string, key string) error {
 	c.log.Debugf("Delete(ctx, \"%s\", \"%s\")", servicePath, key)
 
@@ -84,6 +138,10 @@ func (c *ChamberCompatibility) MetadataKeys() []string {
 	return c.storage.MetadataKeys()
 }
 
+func (c *ChamberCompatibility) Unwrap() Storage {
+	return c.storage
+}
+
 func (c *ChamberCompatibility) String() string {
 	return fmt.Sprintf("ChamberCompatibility(%s)", c.storage)
 }
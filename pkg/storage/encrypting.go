@@ -0,0 +1,386 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/micvbang/confman-go/pkg/encryption"
+	"github.com/micvbang/confman-go/pkg/logger"
+)
+
+var (
+	ErrNotEncrypted = errors.New("value is not encrypted")
+	ErrUnknownKeyID = errors.New("no key provider for key ID")
+)
+
+// envelopePrefix starts every value written by Encrypting. The version
+// allows changing the format later.
+const envelopePrefix = "confman:enc:v1:"
+
+// Encrypting is a storage decorator encrypting values before they reach the
+// decorated storage, such that storage which doesn't encrypt values can
+// store secrets.
+//
+// Values are encrypted using envelope encryption: each call to WriteKeys
+// generates a data key, which encrypts the values using AES-GCM and is
+// itself wrapped by a KeyProvider. Values are stored as
+//
+//	confman:enc:v1:<key ID>:<wrapped data key>:<encrypted value>
+//
+// with the parts base64 encoded. Values are bound to their service path and
+// key, such that they can't be moved without detection.
+type Encrypting struct {
+	log       logger.Logger
+	storage   Storage
+	provider  encryption.KeyProvider
+	providers map[string]encryption.KeyProvider
+
+	// dataKeys caches unwrapped data keys, since unwrapping may require a
+	// request to a KMS or an expensive key derivation.
+	mu       sync.Mutex
+	dataKeys map[string][]byte
+}
+
+var _ Storage = &Encrypting{}
+var _ Wrapper = &Encrypting{}
+var _ OptionsWriter = &Encrypting{}
+var _ TagReader = &Encrypting{}
+var _ KeyValidator = &Encrypting{}
+
+// NewEncrypting returns an Encrypting decorating storage. Values are
+// encrypted using provider, and decrypted using the provider with the key ID
+// of the value, i.e. provider or one of decryptionProviders.
+func NewEncrypting(log logger.Logger, storage Storage, provider encryption.KeyProvider, decryptionProviders ...encryption.KeyProvider) *Encrypting {
+	providers := make(map[string]encryption.KeyProvider, len(decryptionProviders)+1)
+	for _, p := range append(decryptionProviders, provider) {
+		providers[p.KeyID()] = p
+	}
+
+	return &Encrypting{
+		log:       log.WithField("storage_type", "Encrypting"),
+		storage:   storage,
+		provider:  provider,
+		providers: providers,
+		dataKeys:  map[string][]byte{},
+	}
+}
+
+// WithProvider returns an Encrypting decorating the same storage, encrypting
+// values using provider. Values can still be decrypted using the providers
+// of e.
+func (e *Encrypting) WithProvider(provider encryption.KeyProvider) *Encrypting {
+	decryptionProviders := make([]encryption.KeyProvider, 0, len(e.providers))
+	for _, p := range e.providers {
+		decryptionProviders = append(decryptionProviders, p)
+	}
+
+	return NewEncrypting(e.log, e.storage, provider, decryptionProviders...)
+}
+
+func (e *Encrypting) Write(ctx context.Context, servicePath string, key string, value string) error {
+	return e.WriteKeys(ctx, servicePath, map[string]string{key: value})
+}
+
+// WriteKeys encrypts and writes the values of config that differ from the
+// current values. Since encrypting a value never gives the same result
+// twice, unchanged values would otherwise be written as new versions.
+func (e *Encrypting) WriteKeys(ctx context.Context, servicePath string, config map[string]string) error {
+	return e.WriteKeysWithOptions(ctx, servicePath, config, nil)
+}
+
+// WriteKeysWithOptions is like WriteKeys, forwarding options to the decorated
+// storage. Unchanged values of keys with options are forwarded as currently
+// stored, such that their options can be changed without re-encrypting them.
+func (e *Encrypting) WriteKeysWithOptions(ctx context.Context, servicePath string, config map[string]string, options map[string]WriteOptions) error {
+	if len(config) == 0 {
+		e.log.Warnf("WriteKeys called with 0 keys")
+		return nil
+	}
+
+	raw, err := e.storage.ReadAll(ctx, servicePath)
+	if err != nil {
+		return err
+	}
+
+	// Current values that can't be decrypted, e.g. values written before
+	// encryption was enabled, are overwritten.
+	changed := make(map[string]string, len(config))
+	unchanged := map[string]string{}
+	for key, value := range config {
+		rawValue, exists := raw[key]
+		if exists {
+			_, curValue, err := e.decrypt(ctx, servicePath, key, rawValue)
+			if err == nil && curValue == value {
+				if _, hasOptions := options[key]; hasOptions {
+					unchanged[key] = rawValue
+				}
+				continue
+			}
+		}
+		changed[key] = value
+	}
+	if len(changed) == 0 && len(unchanged) == 0 {
+		return nil
+	}
+
+	encrypted := make(map[string]string, len(changed)+len(unchanged))
+	if len(changed) > 0 {
+		encrypted, err = e.encrypt(ctx, servicePath, changed)
+		if err != nil {
+			return err
+		}
+	}
+	for key, rawValue := range unchanged {
+		encrypted[key] = rawValue
+	}
+
+	return WriteKeysWithOptions(ctx, e.storage, servicePath, encrypted, options)
+}
+
+// ValidateKeys validates the values of config as they are written, i.e.
+// encrypted, since encrypting values makes them larger. This requires
+// wrapping a data key.
+func (e *Encrypting) ValidateKeys(ctx context.Context, servicePath string, config map[string]string, options map[string]WriteOptions) ([]Violation, error) {
+	if _, ok := e.storage.(KeyValidator); !ok || len(config) == 0 {
+		return nil, nil
+	}
+
+	encrypted, err := e.encrypt(ctx, servicePath, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return ValidateKeys(ctx, e.storage, servicePath, encrypted, options)
+}
+
+func (e *Encrypting) Read(ctx context.Context, servicePath string, key string) (value string, _ error) {
+	config, err := e.ReadKeys(ctx, servicePath, []string{key})
+	if err != nil {
+		return "", err
+	}
+
+	return config[key], nil
+}
+
+func (e *Encrypting) ReadKeys(ctx context.Context, servicePath string, keys []string) (map[string]string, error) {
+	config, err := e.storage.ReadKeys(ctx, servicePath, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.decryptConfig(ctx, servicePath, config)
+}
+
+func (e *Encrypting) ReadAll(ctx context.Context, servicePath string) (map[string]string, error) {
+	config, err := e.storage.ReadAll(ctx, servicePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.decryptConfig(ctx, servicePath, config)
+}
+
+// ReadAllMetadata returns the decrypted values of servicePath, with the key
+// ID of each value added to its metadata as "key_id".
+func (e *Encrypting) ReadAllMetadata(ctx context.Context, servicePath string) ([]KeyMetadata, error) {
+	keyMetadata, err := e.storage.ReadAllMetadata(ctx, servicePath)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, km := range keyMetadata {
+		keyID, value, err := e.decrypt(ctx, servicePath, km.Key, km.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		// Storage may share metadata maps between keys.
+		metadata := make(map[string]string, len(km.Metadata)+1)
+		for k, v := range km.Metadata {
+			metadata[k] = v
+		}
+		metadata["key_id"] = keyID
+
+		keyMetadata[i].Value = value
+		keyMetadata[i].Metadata = metadata
+	}
+
+	return keyMetadata, nil
+}
+
+func (e *Encrypting) ReadTags(ctx context.Context, servicePath string) (map[string]map[string]string, error) {
+	return ReadTags(ctx, e.storage, servicePath)
+}
+
+func (e *Encrypting) Delete(ctx context.Context, servicePath string, key string) error {
+	return e.storage.Delete(ctx, servicePath, key)
+}
+
+func (e *Encrypting) DeleteKeys(ctx context.Context, servicePath string, keys []string) error {
+	return e.storage.DeleteKeys(ctx, servicePath, keys)
+}
+
+func (e *Encrypting) MetadataKeys() []string {
+	return append(append([]string{}, e.storage.MetadataKeys()...), "key_id")
+}
+
+func (e *Encrypting) Unwrap() Storage {
+	return e.storage
+}
+
+func (e *Encrypting) String() string {
+	return fmt.Sprintf("Encrypting(%s)", e.storage)
+}
+
+// Rekey re-encrypts the values of servicePath that are not encrypted using
+// the key provider of e, including values that are not encrypted at all. It
+// returns the number of values re-encrypted.
+func (e *Encrypting) Rekey(ctx context.Context, servicePath string) (int, error) {
+	raw, err := e.storage.ReadAll(ctx, servicePath)
+	if err != nil {
+		return 0, err
+	}
+
+	config := make(map[string]string, len(raw))
+	for key, rawValue := range raw {
+		keyID, value, err := e.decrypt(ctx, servicePath, key, rawValue)
+		if errors.Is(err, ErrNotEncrypted) {
+			e.log.Infof("Encrypting unencrypted value of %s/%s", servicePath, key)
+			config[key] = rawValue
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if keyID != e.provider.KeyID() {
+			config[key] = value
+		}
+	}
+	if len(config) == 0 {
+		return 0, nil
+	}
+
+	encrypted, err := e.encrypt(ctx, servicePath, config)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(config), e.storage.WriteKeys(ctx, servicePath, encrypted)
+}
+
+// encrypt returns the values of config encrypted using a new data key.
+func (e *Encrypting) encrypt(ctx context.Context, servicePath string, config map[string]string) (map[string]string, error) {
+	dataKey, err := encryption.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	wrappedKey, err := e.provider.WrapKey(ctx, dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	keyID := encodeEnvelopePart([]byte(e.provider.KeyID()))
+	wrapped := encodeEnvelopePart(wrappedKey)
+
+	encrypted := make(map[string]string, len(config))
+	for key, value := range config {
+		ciphertext, err := encryption.EncryptWithAdditionalData(dataKey, []byte(value), additionalData(servicePath, key))
+		if err != nil {
+			return nil, err
+		}
+
+		encrypted[key] = envelopePrefix + strings.Join([]string{keyID, wrapped, encodeEnvelopePart(ciphertext)}, ":")
+	}
+
+	return encrypted, nil
+}
+
+func (e *Encrypting) decryptConfig(ctx context.Context, servicePath string, config map[string]string) (map[string]string, error) {
+	decrypted := make(map[string]string, len(config))
+	for key, rawValue := range config {
+		_, value, err := e.decrypt(ctx, servicePath, key, rawValue)
+		if err != nil {
+			return nil, err
+		}
+		decrypted[key] = value
+	}
+
+	return decrypted, nil
+}
+
+// decrypt returns the key ID and decrypted value of the value rawValue of
+// key.
+func (e *Encrypting) decrypt(ctx context.Context, servicePath string, key string, rawValue string) (string, string, error) {
+	if !strings.HasPrefix(rawValue, envelopePrefix) {
+		return "", "", fmt.Errorf("%w: %s/%s", ErrNotEncrypted, servicePath, key)
+	}
+
+	parts := strings.Split(strings.TrimPrefix(rawValue, envelopePrefix), ":")
+	if len(parts) != 3 {
+		return "", "", fmt.Errorf("%w: %s/%s: malformed value", encryption.ErrDecrypt, servicePath, key)
+	}
+
+	decoded := make([][]byte, len(parts))
+	for i, part := range parts {
+		var err error
+		decoded[i], err = base64.RawURLEncoding.DecodeString(part)
+		if err != nil {
+			return "", "", fmt.Errorf("%w: %s/%s: malformed value: %s", encryption.ErrDecrypt, servicePath, key, err)
+		}
+	}
+	keyID, wrappedKey, ciphertext := string(decoded[0]), decoded[1], decoded[2]
+
+	dataKey, err := e.unwrapKey(ctx, keyID, wrappedKey)
+	if err != nil {
+		return "", "", fmt.Errorf("%s/%s: %w", servicePath, key, err)
+	}
+
+	plaintext, err := encryption.DecryptWithAdditionalData(dataKey, ciphertext, additionalData(servicePath, key))
+	if err != nil {
+		return "", "", fmt.Errorf("%s/%s: %w", servicePath, key, err)
+	}
+
+	return keyID, string(plaintext), nil
+}
+
+func (e *Encrypting) unwrapKey(ctx context.Context, keyID string, wrappedKey []byte) ([]byte, error) {
+	cacheKey := keyID + "\x00" + string(wrappedKey)
+
+	e.mu.Lock()
+	dataKey, exists := e.dataKeys[cacheKey]
+	e.mu.Unlock()
+	if exists {
+		return dataKey, nil
+	}
+
+	provider, exists := e.providers[keyID]
+	if !exists {
+		return nil, fmt.Errorf("%w %s", ErrUnknownKeyID, keyID)
+	}
+
+	dataKey, err := provider.UnwrapKey(ctx, wrappedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	e.dataKeys[cacheKey] = dataKey
+	e.mu.Unlock()
+
+	return dataKey, nil
+}
+
+// additionalData binds encrypted values to servicePath and key.
+func additionalData(servicePath string, key string) []byte {
+	return []byte(servicePath + "\x00" + key)
+}
+
+func encodeEnvelopePart(bs []byte) string {
+	return base64.RawURLEncoding.EncodeToString(bs)
+}
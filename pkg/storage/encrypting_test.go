@@ -0,0 +1,139 @@
+package storage_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/micvbang/confman-go/pkg/encryption"
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/storage"
+	"github.com/micvbang/confman-go/pkg/storage/memory"
+	"github.com/micvbang/confman-go/pkg/storage/storagetest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEncrypting verifies that Encrypting passes the storage conformance
+// suite.
+func TestEncrypting(t *testing.T) {
+	log := newLogger()
+	provider := newKeyProvider(t)
+
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return storage.NewEncrypting(log, memory.New(log), provider)
+	})
+}
+
+// TestEncryptingAtRest verifies that the decorated storage only sees
+// encrypted values, that the key ID of values is added to their metadata,
+// and that values moved to another key can't be decrypted.
+func TestEncryptingAtRest(t *testing.T) {
+	ctx := context.Background()
+	log := newLogger()
+	servicePath := "/service/production"
+	provider := newKeyProvider(t)
+	base := memory.New(log)
+	s := storage.NewEncrypting(log, base, provider)
+
+	require.NoError(t, s.WriteKeys(ctx, servicePath, map[string]string{"PASSWORD": "hunter2", "USER": "user"}))
+
+	raw, err := base.ReadAll(ctx, servicePath)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(raw))
+	for _, value := range raw {
+		require.True(t, strings.HasPrefix(value, "confman:enc:v1:"))
+		require.NotContains(t, value, "hunter2")
+	}
+
+	keyMetadata, err := s.ReadAllMetadata(ctx, servicePath)
+	require.NoError(t, err)
+	for _, km := range keyMetadata {
+		require.Equal(t, provider.KeyID(), km.Metadata["key_id"])
+	}
+	require.Contains(t, s.MetadataKeys(), "key_id")
+
+	// Writing unchanged values doesn't write new versions.
+	require.NoError(t, s.Write(ctx, servicePath, "USER", "user"))
+	rawAfter, err := base.ReadAll(ctx, servicePath)
+	require.NoError(t, err)
+	require.Equal(t, raw, rawAfter)
+
+	require.NoError(t, base.Write(ctx, servicePath, "USER", raw["PASSWORD"]))
+	_, err = s.Read(ctx, servicePath, "USER")
+	require.ErrorIs(t, err, encryption.ErrDecrypt)
+}
+
+// TestEncryptingErrors verifies that values that are not encrypted, or are
+// encrypted using unknown keys, can't be read.
+func TestEncryptingErrors(t *testing.T) {
+	ctx := context.Background()
+	log := newLogger()
+	servicePath := "/service/production"
+	base := memory.New(log)
+
+	require.NoError(t, base.Write(ctx, servicePath, "PLAINTEXT", "value"))
+	_, err := storage.NewEncrypting(log, base, newKeyProvider(t)).ReadAll(ctx, servicePath)
+	require.ErrorIs(t, err, storage.ErrNotEncrypted)
+
+	require.NoError(t, base.Delete(ctx, servicePath, "PLAINTEXT"))
+	require.NoError(t, storage.NewEncrypting(log, base, newKeyProvider(t)).Write(ctx, servicePath, "KEY", "value"))
+	_, err = storage.NewEncrypting(log, base, newKeyProvider(t)).ReadAll(ctx, servicePath)
+	require.ErrorIs(t, err, storage.ErrUnknownKeyID)
+}
+
+// TestEncryptingRekey verifies that Rekey re-encrypts values that are not
+// encrypted using the new key provider, including unencrypted values, such
+// that the old key provider is no longer needed.
+func TestEncryptingRekey(t *testing.T) {
+	ctx := context.Background()
+	log := newLogger()
+	servicePath := "/service/production"
+	oldProvider := newKeyProvider(t)
+	newProvider := newKeyProvider(t)
+	base := memory.New(log)
+
+	require.NoError(t, base.Write(ctx, servicePath, "PLAINTEXT", "plain"))
+	require.NoError(t, storage.NewEncrypting(log, base, oldProvider).Write(ctx, servicePath, "OLD", "old"))
+	require.NoError(t, storage.NewEncrypting(log, base, newProvider).Write(ctx, servicePath, "NEW", "new"))
+
+	s := storage.NewEncrypting(log, base, oldProvider).WithProvider(newProvider)
+	numRekeyed, err := s.Rekey(ctx, servicePath)
+	require.NoError(t, err)
+	require.Equal(t, 2, numRekeyed)
+
+	numRekeyed, err = s.Rekey(ctx, servicePath)
+	require.NoError(t, err)
+	require.Equal(t, 0, numRekeyed)
+
+	config, err := storage.NewEncrypting(log, base, newProvider).ReadAll(ctx, servicePath)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"PLAINTEXT": "plain", "OLD": "old", "NEW": "new"}, config)
+}
+
+// TestFind verifies that Find finds optional interfaces through decorators.
+func TestFind(t *testing.T) {
+	log := newLogger()
+	base := memory.New(log)
+	s := storage.NewChamberCompatibility(log, storage.NewEncrypting(log, base, newKeyProvider(t)))
+
+	lister, ok := storage.Find[storage.Lister](s)
+	require.True(t, ok)
+	require.Equal(t, base, lister)
+
+	_, ok = storage.Find[storage.Historian](s)
+	require.False(t, ok)
+}
+
+func newKeyProvider(t *testing.T) encryption.KeyProvider {
+	key, err := encryption.GenerateKey()
+	require.NoError(t, err)
+
+	provider, err := encryption.NewKeyProvider(key)
+	require.NoError(t, err)
+	return provider
+}
+
+func newLogger() logger.Logger {
+	return logger.LogrusWrapper{Logger: logrus.New()}
+}
@@ -3,6 +3,7 @@ package storage
 import "errors"
 
 var (
-	ErrConfigNotFound = errors.New("config not found")
-	ErrTooManyKeys    = errors.New("too many keys")
+	ErrConfigNotFound   = errors.New("config not found")
+	ErrTooManyKeys      = errors.New("too many keys")
+	ErrRevisionNotFound = errors.New("revision not found")
 )
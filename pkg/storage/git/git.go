@@ -0,0 +1,621 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/micvbang/confman-go/pkg/encryption"
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/storage"
+	"github.com/micvbang/go-helpy/mapy"
+	"github.com/micvbang/go-helpy/slicey"
+)
+
+var (
+	ErrInvalidConfig = errors.New("invalid git config")
+	ErrGitFailed     = errors.New("git failed")
+)
+
+// fileExtension is the extension of the files holding the configuration of
+// service paths. Using an extension prevents the file of e.g. /service/dev
+// from clashing with the directory of /service/dev/nested.
+const fileExtension = ".enc"
+
+// Git implements storage.Storage using a local git repository. Each service
+// path is a file holding its configuration as an encrypted JSON object, and
+// every change is committed, such that the history of a service path is the
+// git history of its file.
+//
+// Pushing and pulling changes is left to git.
+type Git struct {
+	log        logger.Logger
+	repository string
+	key        []byte
+	command    string
+
+	// identityEnv sets the author and committer of commits, if the
+	// repository doesn't configure one.
+	identityEnv []string
+
+	mu sync.Mutex
+}
+
+var _ storage.Storage = &Git{}
+var _ storage.Historian = &Git{}
+var _ storage.Lister = &Git{}
+
+// Config configures Git.
+type Config struct {
+	// Repository is the path of the repository. It is initialized if it
+	// isn't a repository already.
+	Repository string
+
+	// KeyFile is the path of the key used for encrypting configuration,
+	// defaulting to confman.key in the .git directory of the repository.
+	// The key is generated if the repository holds no configuration yet.
+	KeyFile string
+
+	// Command is the confman command recorded in commit messages.
+	Command string
+}
+
+// New returns a configured instance of Git.
+func New(log logger.Logger, config Config) (*Git, error) {
+	ctx := context.Background()
+
+	if len(config.Repository) == 0 {
+		return nil, fmt.Errorf("%w: repository must be given", ErrInvalidConfig)
+	}
+
+	g := &Git{
+		log:        log.WithField("storage_type", "Git"),
+		repository: config.Repository,
+		command:    config.Command,
+	}
+
+	err := g.init(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keyFile := config.KeyFile
+	if len(keyFile) == 0 {
+		keyFile = filepath.Join(g.repository, ".git", "confman.key")
+	}
+
+	files, err := g.git(ctx, "ls-files", "--", "*"+fileExtension)
+	if err != nil {
+		return nil, err
+	}
+
+	// Generating a key for a repository that already holds configuration
+	// would make its configuration unreadable.
+	if len(files) == 0 {
+		g.key, err = encryption.LoadOrCreateKeyFile(keyFile)
+	} else {
+		g.key, err = encryption.LoadKeyFile(keyFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load key: %w", err)
+	}
+
+	return g, nil
+}
+
+func (g *Git) Write(ctx context.Context, servicePath string, key string, value string) error {
+	return g.WriteKeys(ctx, servicePath, map[string]string{key: value})
+}
+
+func (g *Git) WriteKeys(ctx context.Context, servicePath string, config map[string]string) error {
+	if len(config) == 0 {
+		g.log.Warnf("WriteKeys called with 0 keys")
+		return nil
+	}
+
+	message := commitMessage("Write", servicePath, mapy.Keys(config))
+	return g.modify(ctx, servicePath, message, func(cur map[string]string) bool {
+		changed := false
+		for key, value := range config {
+			if curValue, exists := cur[key]; !exists || curValue != value {
+				cur[key] = value
+				changed = true
+			}
+		}
+		return changed
+	})
+}
+
+func (g *Git) Read(ctx context.Context, servicePath string, key string) (value string, _ error) {
+	config, err := g.ReadKeys(ctx, servicePath, []string{key})
+	if err != nil {
+		return "", err
+	}
+
+	return config[key], nil
+}
+
+func (g *Git) ReadKeys(ctx context.Context, servicePath string, keys []string) (map[string]string, error) {
+	if len(keys) == 0 {
+		g.log.Warnf("ReadKeys called with 0 keys")
+		return nil, nil
+	}
+
+	cur, err := g.ReadAll(ctx, servicePath)
+	if err != nil {
+		return nil, err
+	}
+
+	config := make(map[string]string, len(keys))
+	for _, key := range keys {
+		value, exists := cur[key]
+		if !exists {
+			return nil, fmt.Errorf("%w: %s/%s", storage.ErrConfigNotFound, servicePath, key)
+		}
+		config[key] = value
+	}
+
+	return config, nil
+}
+
+func (g *Git) ReadAll(ctx context.Context, servicePath string) (map[string]string, error) {
+	filePath, err := servicePathFile(servicePath)
+	if err != nil {
+		return nil, err
+	}
+
+	g.log.Debugf("Attempting to read %s", servicePath)
+
+	bs, err := os.ReadFile(filepath.Join(g.repository, filepath.FromSlash(filePath)))
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return g.decode(servicePath, bs)
+}
+
+// ReadAllMetadata returns the configuration of servicePath. Since files are
+// versioned rather than keys, the version of each key is the hash of the
+// latest commit of servicePath.
+func (g *Git) ReadAllMetadata(ctx context.Context, servicePath string) ([]storage.KeyMetadata, error) {
+	config, err := g.ReadAll(ctx, servicePath)
+	if err != nil {
+		return nil, err
+	}
+	if len(config) == 0 {
+		return []storage.KeyMetadata{}, nil
+	}
+
+	revisions, err := g.gitLog(ctx, servicePath, "-1")
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := map[string]string{}
+	if len(revisions) > 0 {
+		metadata["version"] = revisions[0].ID
+		metadata["last_modified_date"] = revisions[0].Date.Format(time.RFC3339)
+	}
+
+	keyMetadata := make([]storage.KeyMetadata, 0, len(config))
+	for key, value := range config {
+		keyMetadata = append(keyMetadata, storage.KeyMetadata{
+			Key:      key,
+			Value:    value,
+			Metadata: metadata,
+		})
+	}
+
+	return keyMetadata, nil
+}
+
+func (g *Git) Delete(ctx context.Context, servicePath string, key string) error {
+	return g.DeleteKeys(ctx, servicePath, []string{key})
+}
+
+// DeleteKeys deletes keys of servicePath. Deleting all keys of servicePath
+// removes its file.
+func (g *Git) DeleteKeys(ctx context.Context, servicePath string, keys []string) error {
+	if len(keys) == 0 {
+		g.log.Warnf("DeleteKeys called with 0 keys")
+		return nil
+	}
+
+	message := commitMessage("Delete", servicePath, keys)
+	return g.modify(ctx, servicePath, message, func(cur map[string]string) bool {
+		changed := false
+		for _, key := range keys {
+			if _, exists := cur[key]; !exists {
+				g.log.Warnf("Failed to delete %s/%s: key does not exist", servicePath, key)
+				continue
+			}
+			delete(cur, key)
+			changed = true
+		}
+		return changed
+	})
+}
+
+func (g *Git) ListServicePaths(ctx context.Context, prefix string) ([]string, error) {
+	files, err := g.git(ctx, "ls-files", "--", "*"+fileExtension)
+	if err != nil {
+		return nil, err
+	}
+
+	servicePaths := []string{}
+	for _, file := range strings.Split(files, "\n") {
+		if len(file) == 0 {
+			continue
+		}
+
+		servicePath := "/" + strings.TrimSuffix(file, fileExtension)
+		if storage.IsBelow(servicePath, prefix) {
+			servicePaths = append(servicePaths, servicePath)
+		}
+	}
+	sort.Strings(servicePaths)
+
+	return servicePaths, nil
+}
+
+func (g *Git) MetadataKeys() []string {
+	return []string{
+		"version",
+		"last_modified_date",
+	}
+}
+
+func (g *Git) String() string {
+	return "Git"
+}
+
+// History returns the commits changing servicePath, newest first.
+func (g *Git) History(ctx context.Context, servicePath string) ([]storage.Revision, error) {
+	return g.gitLog(ctx, servicePath)
+}
+
+// Rollback restores the configuration of servicePath to what it was at the
+// commit revision, which must be in the history of servicePath. The rollback
+// is committed as a new change.
+func (g *Git) Rollback(ctx context.Context, servicePath string, revision string) error {
+	filePath, err := servicePathFile(servicePath)
+	if err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	commit, err := g.git(ctx, "rev-parse", "--verify", "--quiet", revision+"^{commit}")
+	if err != nil {
+		return fmt.Errorf("%w: %s", storage.ErrRevisionNotFound, revision)
+	}
+
+	commits, err := g.git(ctx, "log", "--format=%H", "--", filePath)
+	if err != nil {
+		return err
+	}
+	if !slicey.Contains(strings.Split(commits, "\n"), commit) {
+		return fmt.Errorf("%w: %s is not a revision of %s", storage.ErrRevisionNotFound, revision, servicePath)
+	}
+
+	// The file doesn't exist in the revision if all keys were deleted.
+	config := map[string]string{}
+	contents, err := g.git(ctx, "show", commit+":"+filePath)
+	if err == nil {
+		config, err = g.decode(servicePath, []byte(contents))
+		if err != nil {
+			return err
+		}
+	}
+
+	cur, err := g.ReadAll(ctx, servicePath)
+	if err != nil {
+		return err
+	}
+	if mapsEqual(cur, config) {
+		g.log.Infof("%s is already at %s", servicePath, shortHash(commit))
+		return nil
+	}
+
+	message := fmt.Sprintf("Roll back %s to %s", servicePath, shortHash(commit))
+	return g.writeConfig(ctx, servicePath, config, message)
+}
+
+// modify reads the configuration of servicePath, applies update to it and
+// commits the result if update reports a change.
+func (g *Git) modify(ctx context.Context, servicePath string, message string, update func(map[string]string) bool) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	config, err := g.ReadAll(ctx, servicePath)
+	if err != nil {
+		return err
+	}
+
+	if !update(config) {
+		return nil
+	}
+
+	return g.writeConfig(ctx, servicePath, config, message)
+}
+
+// writeConfig writes config as the configuration of servicePath and commits
+// it with the given message. The file of servicePath is removed if config is
+// empty. It must be called with g.mu held.
+func (g *Git) writeConfig(ctx context.Context, servicePath string, config map[string]string, message string) error {
+	filePath, err := servicePathFile(servicePath)
+	if err != nil {
+		return err
+	}
+	fullPath := filepath.Join(g.repository, filepath.FromSlash(filePath))
+
+	g.log.Debugf("Attempting to write %s", servicePath)
+
+	if len(config) == 0 {
+		err = os.Remove(fullPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	} else {
+		bs, err := g.encode(config)
+		if err != nil {
+			return err
+		}
+
+		err = writeFileAtomic(fullPath, bs)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = g.git(ctx, "add", "--all", "--", filePath)
+	if err != nil {
+		return err
+	}
+
+	if len(g.command) > 0 {
+		message = fmt.Sprintf("%s\n\nCommand: confman %s", message, g.command)
+	}
+
+	_, err = g.git(ctx, "commit", "--quiet", "--message", message, "--", filePath)
+	return err
+}
+
+// gitLog returns the commits changing servicePath, newest first, using the
+// given additional arguments to git log.
+func (g *Git) gitLog(ctx context.Context, servicePath string, args ...string) ([]storage.Revision, error) {
+	filePath, err := servicePathFile(servicePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fields are separated by NUL and commits by the record separator, since
+	// neither can be part of commit messages.
+	args = append([]string{"log", "--format=%H%x00%an <%ae>%x00%aI%x00%B%x1e"}, args...)
+	output, err := g.git(ctx, append(args, "--", filePath)...)
+	if err != nil {
+		// A repository without commits has no history.
+		if hasCommits, _ := g.git(ctx, "rev-parse", "--verify", "--quiet", "HEAD"); len(hasCommits) == 0 {
+			return []storage.Revision{}, nil
+		}
+		return nil, err
+	}
+
+	revisions := []storage.Revision{}
+	for _, record := range strings.Split(output, "\x1e") {
+		record = strings.TrimSpace(record)
+		if len(record) == 0 {
+			continue
+		}
+
+		fields := strings.SplitN(record, "\x00", 4)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("%w: unexpected log output %q", ErrGitFailed, record)
+		}
+
+		date, err := time.Parse(time.RFC3339, fields[2])
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, storage.Revision{
+			ID:      fields[0],
+			Author:  fields[1],
+			Date:    date,
+			Message: strings.TrimSpace(fields[3]),
+		})
+	}
+
+	return revisions, nil
+}
+
+// init initializes the repository if it isn't one already, and determines
+// the identity used for commits.
+func (g *Git) init(ctx context.Context) error {
+	err := os.MkdirAll(g.repository, 0700)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stat(filepath.Join(g.repository, ".git"))
+	if errors.Is(err, os.ErrNotExist) {
+		g.log.Infof("Initializing git repository in %s", g.repository)
+		_, err = g.git(ctx, "init", "--quiet")
+	}
+	if err != nil {
+		return err
+	}
+
+	// git refuses to commit without an identity, so fall back to the
+	// current user if none is configured.
+	name, _ := g.git(ctx, "config", "user.name")
+	email, _ := g.git(ctx, "config", "user.email")
+	if len(name) > 0 && len(email) > 0 {
+		return nil
+	}
+
+	if len(name) == 0 {
+		name = "confman"
+		if u, err := user.Current(); err == nil {
+			name = u.Username
+		}
+	}
+	if len(email) == 0 {
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "localhost"
+		}
+		email = fmt.Sprintf("%s@%s", name, hostname)
+	}
+
+	g.identityEnv = []string{
+		"GIT_AUTHOR_NAME=" + name,
+		"GIT_AUTHOR_EMAIL=" + email,
+		"GIT_COMMITTER_NAME=" + name,
+		"GIT_COMMITTER_EMAIL=" + email,
+	}
+	return nil
+}
+
+// git runs git in the repository and returns its trimmed output.
+func (g *Git) git(ctx context.Context, args ...string) (string, error) {
+	stdout := bytes.NewBuffer(nil)
+	stderr := bytes.NewBuffer(nil)
+
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", g.repository}, args...)...)
+	cmd.Env = append(os.Environ(), g.identityEnv...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	g.log.Debugf("Running git %s", strings.Join(args, " "))
+
+	err := cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("%w: git %s: %s", ErrGitFailed, args[0], strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// encode returns config as an encrypted, base64 encoded JSON object. Base64
+// keeps the files readable by git tooling.
+func (g *Git) encode(config map[string]string) ([]byte, error) {
+	bs, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := encryption.Encrypt(g.key, bs)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(base64.StdEncoding.EncodeToString(ciphertext) + "\n"), nil
+}
+
+// decode returns the configuration of servicePath held by the file contents
+// bs.
+func (g *Git) decode(servicePath string, bs []byte) (map[string]string, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(bs)))
+	if err != nil {
+		return nil, fmt.Errorf("file of %s is not base64 encoded: %w", servicePath, err)
+	}
+
+	plaintext, err := encryption.Decrypt(g.key, ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("file of %s: %w", servicePath, err)
+	}
+
+	config := map[string]string{}
+	err = json.Unmarshal(plaintext, &config)
+	if err != nil {
+		return nil, fmt.Errorf("file of %s is not a JSON object of strings: %w", servicePath, err)
+	}
+
+	return config, nil
+}
+
+// servicePathFile returns the path of the file of servicePath, relative to
+// the repository and using forward slashes, e.g.
+// "email-dispatch/runtime/production.enc" for
+// "/email-dispatch/runtime/production".
+func servicePathFile(servicePath string) (string, error) {
+	trimmed := strings.Trim(servicePath, "/")
+	for _, segment := range strings.Split(trimmed, "/") {
+		if segment == "" || segment == "." || segment == ".." || segment == ".git" {
+			return "", fmt.Errorf("invalid service path %q", servicePath)
+		}
+	}
+
+	return trimmed + fileExtension, nil
+}
+
+// commitMessage returns the message of a commit changing keys of
+// servicePath. Values are never part of messages.
+func commitMessage(action string, servicePath string, keys []string) string {
+	keys = append([]string{}, keys...)
+	sort.Strings(keys)
+	return fmt.Sprintf("%s %s: %s", action, servicePath, strings.Join(keys, ", "))
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+// writeFileAtomic writes bs to path via a temporary file, such that readers
+// never see partially written files.
+func writeFileAtomic(path string, bs []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), ".confman-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(bs)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+func mapsEqual(m1 map[string]string, m2 map[string]string) bool {
+	if len(m1) != len(m2) {
+		return false
+	}
+	for key, value := range m1 {
+		if value2, exists := m2[key]; !exists || value != value2 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,152 @@
+package git_test
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/storage"
+	"github.com/micvbang/confman-go/pkg/storage/git"
+	"github.com/micvbang/confman-go/pkg/storage/storagetest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGit verifies that Git passes the storage conformance suite.
+func TestGit(t *testing.T) {
+	requireGit(t)
+
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return newGit(t, git.Config{Repository: t.TempDir()})
+	})
+}
+
+// TestGitHistoryRollback verifies that every change is committed with the
+// command and changed keys in the commit message, and that Rollback restores
+// the configuration of a revision as a new commit.
+func TestGitHistoryRollback(t *testing.T) {
+	requireGit(t)
+
+	ctx := context.Background()
+	servicePath := "/email-dispatch/runtime/production"
+	g := newGit(t, git.Config{Repository: t.TempDir(), Command: "write"})
+
+	require.NoError(t, g.WriteKeys(ctx, servicePath, map[string]string{"DB_HOST": "localhost", "DB_USER": "user"}))
+	require.NoError(t, g.Write(ctx, servicePath, "DB_HOST", "db.internal"))
+	require.NoError(t, g.Delete(ctx, servicePath, "DB_USER"))
+
+	revisions, err := g.History(ctx, servicePath)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(revisions))
+
+	expectedMessages := []string{
+		"Delete /email-dispatch/runtime/production: DB_USER",
+		"Write /email-dispatch/runtime/production: DB_HOST",
+		"Write /email-dispatch/runtime/production: DB_HOST, DB_USER",
+	}
+	for i, revision := range revisions {
+		require.Equal(t, expectedMessages[i]+"\n\nCommand: confman write", revision.Message)
+		require.NotEmpty(t, revision.Author)
+		require.False(t, revision.Date.IsZero())
+	}
+
+	err = g.Rollback(ctx, servicePath, revisions[2].ID)
+	require.NoError(t, err)
+
+	config, err := g.ReadAll(ctx, servicePath)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"DB_HOST": "localhost", "DB_USER": "user"}, config)
+
+	revisions, err = g.History(ctx, servicePath)
+	require.NoError(t, err)
+	require.Equal(t, 4, len(revisions))
+	require.True(t, strings.HasPrefix(revisions[0].Message, "Roll back /email-dispatch/runtime/production to "))
+
+	// Abbreviated hashes are accepted.
+	require.NoError(t, g.Rollback(ctx, servicePath, revisions[1].ID[:8]))
+	revisions, err = g.History(ctx, servicePath)
+	require.NoError(t, err)
+	require.Equal(t, 5, len(revisions))
+
+	// Rolling back to the current configuration is a no-op.
+	require.NoError(t, g.Rollback(ctx, servicePath, revisions[0].ID))
+	revisions, err = g.History(ctx, servicePath)
+	require.NoError(t, err)
+	require.Equal(t, 5, len(revisions))
+}
+
+// TestGitRollbackErrors verifies that Rollback returns
+// storage.ErrRevisionNotFound for revisions that don't exist or don't change
+// the given service path.
+func TestGitRollbackErrors(t *testing.T) {
+	requireGit(t)
+
+	ctx := context.Background()
+	g := newGit(t, git.Config{Repository: t.TempDir()})
+
+	require.NoError(t, g.Write(ctx, "/service/development", "KEY", "value"))
+	require.NoError(t, g.Write(ctx, "/service/production", "KEY", "value"))
+
+	revisions, err := g.History(ctx, "/service/production")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(revisions))
+
+	err = g.Rollback(ctx, "/service/development", revisions[0].ID)
+	require.ErrorIs(t, err, storage.ErrRevisionNotFound)
+
+	err = g.Rollback(ctx, "/service/development", "does-not-exist")
+	require.ErrorIs(t, err, storage.ErrRevisionNotFound)
+}
+
+// TestGitEncrypted verifies that neither files nor commit messages contain
+// values, and that a repository holding configuration requires its key
+// rather than generating a new one.
+func TestGitEncrypted(t *testing.T) {
+	requireGit(t)
+
+	ctx := context.Background()
+	repository := t.TempDir()
+	g := newGit(t, git.Config{Repository: repository})
+
+	require.NoError(t, g.Write(ctx, "/service/production", "PASSWORD", "hunter2"))
+
+	bs, err := os.ReadFile(filepath.Join(repository, "service", "production.enc"))
+	require.NoError(t, err)
+	require.NotContains(t, string(bs), "hunter2")
+	require.NotContains(t, string(bs), "PASSWORD")
+
+	output, err := exec.Command("git", "-C", repository, "log", "-p").CombinedOutput()
+	require.NoError(t, err)
+	require.NotContains(t, string(output), "hunter2")
+
+	// Using the same repository with the default key file works.
+	g = newGit(t, git.Config{Repository: repository})
+	value, err := g.Read(ctx, "/service/production", "PASSWORD")
+	require.NoError(t, err)
+	require.Equal(t, "hunter2", value)
+
+	// A missing key file is not generated.
+	_, err = git.New(newLogger(), git.Config{Repository: repository, KeyFile: filepath.Join(t.TempDir(), "key")})
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func newGit(t *testing.T, config git.Config) *git.Git {
+	g, err := git.New(newLogger(), config)
+	require.NoError(t, err)
+	return g
+}
+
+func newLogger() logger.Logger {
+	return logger.LogrusWrapper{Logger: logrus.New()}
+}
+
+func requireGit(t *testing.T) {
+	_, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git is not installed")
+	}
+}
@@ -0,0 +1,177 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/storage"
+)
+
+// Memory implements storage.Storage by keeping configuration in memory. It
+// is meant for tests and local experimentation.
+type Memory struct {
+	log logger.Logger
+
+	mu           sync.Mutex
+	servicePaths map[string]map[string]entry
+}
+
+var _ storage.Storage = &Memory{}
+var _ storage.Lister = &Memory{}
+
+type entry struct {
+	value            string
+	version          int64
+	lastModifiedDate time.Time
+}
+
+// New returns an empty Memory storage.
+func New(log logger.Logger) *Memory {
+	return &Memory{
+		log:          log.WithField("storage_type", "Memory"),
+		servicePaths: make(map[string]map[string]entry),
+	}
+}
+
+func (m *Memory) Write(ctx context.Context, servicePath string, key string, value string) error {
+	return m.WriteKeys(ctx, servicePath, map[string]string{key: value})
+}
+
+func (m *Memory) WriteKeys(ctx context.Context, servicePath string, config map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries, exists := m.servicePaths[servicePath]
+	if !exists {
+		entries = make(map[string]entry, len(config))
+		m.servicePaths[servicePath] = entries
+	}
+
+	now := time.Now().UTC()
+	for key, value := range config {
+		cur, exists := entries[key]
+		if exists && cur.value == value {
+			continue
+		}
+
+		entries[key] = entry{
+			value:            value,
+			version:          cur.version + 1,
+			lastModifiedDate: now,
+		}
+	}
+
+	return nil
+}
+
+func (m *Memory) Read(ctx context.Context, servicePath string, key string) (value string, _ error) {
+	config, err := m.ReadKeys(ctx, servicePath, []string{key})
+	if err != nil {
+		return "", err
+	}
+
+	return config[key], nil
+}
+
+func (m *Memory) ReadKeys(ctx context.Context, servicePath string, keys []string) (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	config := make(map[string]string, len(keys))
+	for _, key := range keys {
+		entry, exists := m.servicePaths[servicePath][key]
+		if !exists {
+			return nil, storage.ErrConfigNotFound
+		}
+		config[key] = entry.value
+	}
+
+	return config, nil
+}
+
+func (m *Memory) ReadAll(ctx context.Context, servicePath string) (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := m.servicePaths[servicePath]
+	config := make(map[string]string, len(entries))
+	for key, entry := range entries {
+		config[key] = entry.value
+	}
+
+	return config, nil
+}
+
+func (m *Memory) ReadAllMetadata(ctx context.Context, servicePath string) ([]storage.KeyMetadata, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := m.servicePaths[servicePath]
+	keyMetadata := make([]storage.KeyMetadata, 0, len(entries))
+	for key, entry := range entries {
+		keyMetadata = append(keyMetadata, storage.KeyMetadata{
+			Key:   key,
+			Value: entry.value,
+			Metadata: map[string]string{
+				"version":            strconv.FormatInt(entry.version, 10),
+				"last_modified_date": entry.lastModifiedDate.Format(time.RFC3339),
+			},
+		})
+	}
+
+	return keyMetadata, nil
+}
+
+func (m *Memory) Delete(ctx context.Context, servicePath string, key string) error {
+	return m.DeleteKeys(ctx, servicePath, []string{key})
+}
+
+func (m *Memory) DeleteKeys(ctx context.Context, servicePath string, keys []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := m.servicePaths[servicePath]
+	for _, key := range keys {
+		if _, exists := entries[key]; !exists {
+			m.log.Warnf("Failed to delete %s/%s: key does not exist", servicePath, key)
+			continue
+		}
+		delete(entries, key)
+	}
+
+	if len(entries) == 0 {
+		delete(m.servicePaths, servicePath)
+	}
+
+	return nil
+}
+
+func (m *Memory) ListServicePaths(ctx context.Context, prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	servicePaths := []string{}
+	for servicePath := range m.servicePaths {
+		if storage.IsBelow(servicePath, prefix) {
+			servicePaths = append(servicePaths, servicePath)
+		}
+	}
+	sort.Strings(servicePaths)
+
+	return servicePaths, nil
+}
+
+func (m *Memory) MetadataKeys() []string {
+	return []string{
+		"version",
+		"last_modified_date",
+	}
+}
+
+func (m *Memory) String() string {
+	return "Memory"
+}
@@ -0,0 +1,20 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/storage"
+	"github.com/micvbang/confman-go/pkg/storage/memory"
+	"github.com/micvbang/confman-go/pkg/storage/storagetest"
+	"github.com/sirupsen/logrus"
+)
+
+// TestMemory verifies that Memory passes the storage conformance suite.
+func TestMemory(t *testing.T) {
+	log := logger.LogrusWrapper{Logger: logrus.New()}
+
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return memory.New(log)
+	})
+}
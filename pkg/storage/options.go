@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/micvbang/go-helpy/slicey"
+)
+
+var (
+	ErrInvalidWriteOptions = errors.New("invalid write options")
+	ErrTagsUnsupported     = errors.New("storage doesn't support tags")
+)
+
+// Parameter types of WriteOptions, as in AWS Parameter Store.
+const (
+	ParameterTypeString       = "String"
+	ParameterTypeStringList   = "StringList"
+	ParameterTypeSecureString = "SecureString"
+)
+
+// ParameterTypes are the supported values of WriteOptions.Type.
+var ParameterTypes = []string{ParameterTypeString, ParameterTypeStringList, ParameterTypeSecureString}
+
+// Parameter tiers of WriteOptions, as in AWS Parameter Store.
+const (
+	ParameterTierStandard = "Standard"
+	ParameterTierAdvanced = "Advanced"
+)
+
+// ParameterTiers are the supported values of WriteOptions.Tier.
+var ParameterTiers = []string{ParameterTierStandard, ParameterTierAdvanced}
+
+// WriteOptions are options of a written key that are not supported by every
+// storage. Zero values leave the current options of existing keys unchanged.
+type WriteOptions struct {
+	// Type is the parameter type of the key, one of ParameterTypes. New keys
+	// default to ParameterTypeSecureString.
+	Type string `json:"type,omitempty" yaml:"type,omitempty"`
+
+	// Description documents the key, e.g. its purpose.
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+
+	// Tags are added to the tags of the key, replacing tags of the same
+	// names. Tags of the key that are not given are kept.
+	Tags map[string]string `json:"tags,omitempty" yaml:"tags,omitempty"`
+
+	// Tier is the parameter tier of the key, one of ParameterTiers. Keys are
+	// written using the advanced tier if required by their value or
+	// policies.
+	Tier string `json:"tier,omitempty" yaml:"tier,omitempty"`
+
+	// ExpiresIn is the duration after writing the key at which it is deleted.
+	ExpiresIn Duration `json:"expires_in,omitempty" yaml:"expires_in,omitempty"`
+
+	// NotifyBefore is the duration before the key expires at which a
+	// notification is sent. It requires ExpiresIn.
+	NotifyBefore Duration `json:"notify_before,omitempty" yaml:"notify_before,omitempty"`
+
+	// NoChangeNotification is the duration after the key was last changed
+	// at which a notification is sent if it is still unchanged.
+	NoChangeNotification Duration `json:"no_change_notification,omitempty" yaml:"no_change_notification,omitempty"`
+}
+
+// IsZero returns whether o has no options set.
+func (o WriteOptions) IsZero() bool {
+	return len(o.Type) == 0 && len(o.Description) == 0 && len(o.Tags) == 0 && len(o.Tier) == 0 && !o.HasPolicies()
+}
+
+// HasPolicies returns whether o has any of the options that are parameter
+// policies in Parameter Store.
+func (o WriteOptions) HasPolicies() bool {
+	return o.ExpiresIn != 0 || o.NotifyBefore != 0 || o.NoChangeNotification != 0
+}
+
+// Validate returns ErrInvalidWriteOptions if o has invalid values.
+func (o WriteOptions) Validate() error {
+	if len(o.Type) > 0 && !slicey.Contains(ParameterTypes, o.Type) {
+		return fmt.Errorf("%w: type %q must be one of %v", ErrInvalidWriteOptions, o.Type, ParameterTypes)
+	}
+
+	for name := range o.Tags {
+		if len(name) == 0 {
+			return fmt.Errorf("%w: tag names must not be empty", ErrInvalidWriteOptions)
+		}
+	}
+
+	if len(o.Tier) > 0 && !slicey.Contains(ParameterTiers, o.Tier) {
+		return fmt.Errorf("%w: tier %q must be one of %v", ErrInvalidWriteOptions, o.Tier, ParameterTiers)
+	}
+	if o.Tier == ParameterTierStandard && o.HasPolicies() {
+		return fmt.Errorf("%w: policies require the %s tier", ErrInvalidWriteOptions, ParameterTierAdvanced)
+	}
+
+	durations := map[string]Duration{
+		"expiration":              o.ExpiresIn,
+		"expiration notification": o.NotifyBefore,
+		"no change notification":  o.NoChangeNotification,
+	}
+	for name, d := range durations {
+		if d < 0 || time.Duration(d)%time.Hour != 0 {
+			return fmt.Errorf("%w: %s must be a positive number of hours or days, got %s", ErrInvalidWriteOptions, name, d)
+		}
+	}
+
+	if o.NotifyBefore != 0 && o.ExpiresIn == 0 {
+		return fmt.Errorf("%w: expiration notification requires an expiration", ErrInvalidWriteOptions)
+	}
+	if o.NotifyBefore >= o.ExpiresIn && o.ExpiresIn != 0 {
+		return fmt.Errorf("%w: expiration notification must be before the expiration", ErrInvalidWriteOptions)
+	}
+
+	return nil
+}
+
+// Duration is a time.Duration that can also be given in days, e.g. "90d",
+// as flags and in YAML.
+type Duration time.Duration
+
+const day = 24 * time.Hour
+
+// ParseDuration parses durations as time.ParseDuration, and days given by a
+// "d" suffix.
+func ParseDuration(s string) (Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		n, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return Duration(time.Duration(n) * day), nil
+	}
+
+	d, err := time.ParseDuration(s)
+	return Duration(d), err
+}
+
+// Set implements kingpin.Value.
+func (d *Duration) Set(s string) error {
+	parsed, err := ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = parsed
+	return nil
+}
+
+func (d Duration) String() string {
+	if d != 0 && time.Duration(d)%day == 0 {
+		return fmt.Sprintf("%dd", time.Duration(d)/day)
+	}
+	return time.Duration(d).String()
+}
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	err := unmarshal(&s)
+	if err != nil {
+		return err
+	}
+
+	return d.Set(s)
+}
+
+// OptionsWriter is implemented by storage supporting WriteOptions, and by
+// decorators forwarding them to the storage they decorate.
+type OptionsWriter interface {
+	// WriteKeysWithOptions writes config like WriteKeys, with the options of
+	// each key given by options. Keys whose value is unchanged are written
+	// if their options are changed.
+	WriteKeysWithOptions(ctx context.Context, servicePath string, config map[string]string, options map[string]WriteOptions) error
+}
+
+// WriteKeysWithOptions writes config to s using the options of each key, if
+// s supports options. Otherwise options are ignored.
+func WriteKeysWithOptions(ctx context.Context, s Storage, servicePath string, config map[string]string, options map[string]WriteOptions) error {
+	if ow, ok := s.(OptionsWriter); ok && len(options) > 0 {
+		return ow.WriteKeysWithOptions(ctx, servicePath, config, options)
+	}
+
+	return s.WriteKeys(ctx, servicePath, config)
+}
+
+// TagReader is implemented by storage supporting tags of keys, and by
+// decorators forwarding them from the storage they decorate.
+type TagReader interface {
+	// ReadTags returns the tags of the keys of servicePath that have any.
+	ReadTags(ctx context.Context, servicePath string) (map[string]map[string]string, error)
+}
+
+// ReadTags returns the tags of the keys of servicePath, or ErrTagsUnsupported
+// if s doesn't support tags.
+func ReadTags(ctx context.Context, s Storage, servicePath string) (map[string]map[string]string, error) {
+	tr, ok := s.(TagReader)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTagsUnsupported, s)
+	}
+
+	return tr.ReadTags(ctx, servicePath)
+}
@@ -0,0 +1,152 @@
+package storage_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micvbang/confman-go/pkg/storage"
+	"github.com/micvbang/confman-go/pkg/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWriteKeysWithOptions verifies that decorators forward options to the
+// storage they decorate, that Encrypting forwards unchanged values of keys
+// with options as they are stored, and that storage not supporting options
+// is written without them.
+func TestWriteKeysWithOptions(t *testing.T) {
+	ctx := context.Background()
+	log := newLogger()
+	servicePath := "/service/production"
+
+	base := &optionsRecorder{Storage: memory.New(log)}
+	s := storage.NewChamberCompatibility(log, storage.NewEncrypting(log, base, newKeyProvider(t)))
+
+	err := storage.WriteKeysWithOptions(ctx, s, servicePath, map[string]string{"SIZE": "large"}, map[string]storage.WriteOptions{
+		"SIZE": {Type: storage.ParameterTypeString},
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]storage.WriteOptions{"size": {Type: storage.ParameterTypeString}}, base.options)
+	written := base.config["size"]
+
+	// Unchanged values with options are forwarded as stored, without
+	// re-encrypting them.
+	err = storage.WriteKeysWithOptions(ctx, s, servicePath, map[string]string{"SIZE": "large", "OTHER": "value"}, map[string]storage.WriteOptions{
+		"SIZE": {Type: storage.ParameterTypeStringList},
+	})
+	require.NoError(t, err)
+	require.Equal(t, written, base.config["size"])
+	require.Contains(t, base.config, "other")
+
+	// Unchanged values without options are not forwarded.
+	err = storage.WriteKeysWithOptions(ctx, s, servicePath, map[string]string{"SIZE": "large", "OTHER": "new value"}, map[string]storage.WriteOptions{
+		"OTHER": {Type: storage.ParameterTypeString},
+	})
+	require.NoError(t, err)
+	require.NotContains(t, base.config, "size")
+
+	m := memory.New(log)
+	err = storage.WriteKeysWithOptions(ctx, m, servicePath, map[string]string{"SIZE": "large"}, map[string]storage.WriteOptions{
+		"SIZE": {Type: storage.ParameterTypeString},
+	})
+	require.NoError(t, err)
+
+	value, err := m.Read(ctx, servicePath, "SIZE")
+	require.NoError(t, err)
+	require.Equal(t, "large", value)
+}
+
+// TestWriteOptionsValidate verifies that only supported parameter types and
+// tiers are valid, and that policies are validated.
+func TestWriteOptionsValidate(t *testing.T) {
+	for _, parameterType := range append(storage.ParameterTypes, "") {
+		require.NoError(t, storage.WriteOptions{Type: parameterType}.Validate())
+	}
+	for _, tier := range append(storage.ParameterTiers, "") {
+		require.NoError(t, storage.WriteOptions{Tier: tier}.Validate())
+	}
+
+	require.NoError(t, storage.WriteOptions{
+		ExpiresIn:            storage.Duration(90 * 24 * time.Hour),
+		NotifyBefore:         storage.Duration(7 * 24 * time.Hour),
+		NoChangeNotification: storage.Duration(12 * time.Hour),
+	}.Validate())
+
+	tests := map[string]storage.WriteOptions{
+		"type":                        {Type: "Secure"},
+		"tier":                        {Tier: "Premium"},
+		"standard tier with policies": {Tier: storage.ParameterTierStandard, ExpiresIn: storage.Duration(time.Hour)},
+		"negative duration":           {NoChangeNotification: storage.Duration(-time.Hour)},
+		"partial hours":               {ExpiresIn: storage.Duration(90 * time.Minute)},
+		"notification without expiry": {NotifyBefore: storage.Duration(time.Hour)},
+		"notification after expiry":   {ExpiresIn: storage.Duration(time.Hour), NotifyBefore: storage.Duration(2 * time.Hour)},
+	}
+
+	for name, options := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := options.Validate()
+			require.ErrorIs(t, err, storage.ErrInvalidWriteOptions)
+		})
+	}
+}
+
+// TestParseDuration verifies that durations can be given in days as well as
+// the units of time.ParseDuration, and are formatted in days when possible.
+func TestParseDuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		"90d": 90 * 24 * time.Hour,
+		"36h": 36 * time.Hour,
+		"0":   0,
+	}
+
+	for s, expected := range tests {
+		d, err := storage.ParseDuration(s)
+		require.NoError(t, err)
+		require.Equal(t, storage.Duration(expected), d)
+	}
+
+	require.Equal(t, "90d", storage.Duration(90*24*time.Hour).String())
+	require.Equal(t, "36h0m0s", storage.Duration(36*time.Hour).String())
+
+	for _, s := range []string{"d", "1.5d", "ninety days"} {
+		_, err := storage.ParseDuration(s)
+		require.Error(t, err, s)
+	}
+}
+
+// optionsRecorder records the arguments of the last call to
+// WriteKeysWithOptions, and returns fixed tags.
+type optionsRecorder struct {
+	storage.Storage
+	config  map[string]string
+	options map[string]storage.WriteOptions
+	tags    map[string]map[string]string
+}
+
+func (r *optionsRecorder) ReadTags(ctx context.Context, servicePath string) (map[string]map[string]string, error) {
+	return r.tags, nil
+}
+
+func (r *optionsRecorder) WriteKeysWithOptions(ctx context.Context, servicePath string, config map[string]string, options map[string]storage.WriteOptions) error {
+	r.config = config
+	r.options = options
+	return r.Storage.WriteKeys(ctx, servicePath, config)
+}
+
+// TestReadTags verifies that decorators forward tags from the storage they
+// decorate, and that ErrTagsUnsupported is returned for storage without
+// tags.
+func TestReadTags(t *testing.T) {
+	ctx := context.Background()
+	log := newLogger()
+
+	base := &optionsRecorder{Storage: memory.New(log), tags: map[string]map[string]string{"db_host": {"owner": "team-x"}}}
+	s := storage.NewChamberCompatibility(log, storage.NewEncrypting(log, base, newKeyProvider(t)))
+
+	tags, err := storage.ReadTags(ctx, s, "/service")
+	require.NoError(t, err)
+	require.Equal(t, map[string]map[string]string{"DB_HOST": {"owner": "team-x"}}, tags)
+
+	_, err = storage.ReadTags(ctx, storage.NewEncrypting(log, memory.New(log), newKeyProvider(t)), "/service")
+	require.ErrorIs(t, err, storage.ErrTagsUnsupported)
+}
@@ -0,0 +1,124 @@
+package parameterstore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+var ErrInvalidKMSKeyRule = errors.New("invalid KMS key rule")
+
+// KMSKeyRule selects the KMS key used to encrypt parameters of the service
+// paths matching Pattern.
+//
+// Pattern is a service path whose segments may contain shell patterns as
+// accepted by path.Match, e.g. /*/production. A trailing /* also matches the
+// service paths at any depth below, i.e. /payments/* matches /payments,
+// /payments/production and /payments/production/eu.
+type KMSKeyRule struct {
+	Pattern string `yaml:"path"`
+	KeyID   string `yaml:"key"`
+}
+
+// ParseKMSKeyRule parses a rule given as <pattern>=<KMS key>, e.g.
+// /payments/*=alias/payments.
+func ParseKMSKeyRule(s string) (KMSKeyRule, error) {
+	pattern, keyID, found := strings.Cut(s, "=")
+	if !found {
+		return KMSKeyRule{}, fmt.Errorf("%w: %q, expected <path>=<KMS key>", ErrInvalidKMSKeyRule, s)
+	}
+
+	rule := KMSKeyRule{
+		Pattern: strings.TrimSpace(pattern),
+		KeyID:   strings.TrimSpace(keyID),
+	}
+	return rule, rule.validate()
+}
+
+// LoadKMSKeyRules reads rules from the YAML file at filePath, given as a list
+// of objects with the fields "path" and "key".
+func LoadKMSKeyRules(filePath string) ([]KMSKeyRule, error) {
+	bs, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := []KMSKeyRule{}
+	err = yaml.UnmarshalStrict(bs, &rules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse KMS key rules %s: %w", filePath, err)
+	}
+
+	for _, rule := range rules {
+		err := rule.validate()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filePath, err)
+		}
+	}
+
+	return rules, nil
+}
+
+// Matches returns whether servicePath matches the pattern of r.
+func (r KMSKeyRule) Matches(servicePath string) bool {
+	patternSegments := strings.Split(strings.Trim(r.Pattern, "/"), "/")
+	segments := strings.Split(strings.Trim(servicePath, "/"), "/")
+
+	last := len(patternSegments) - 1
+	if patternSegments[last] == "*" {
+		patternSegments = patternSegments[:last]
+		if len(segments) < len(patternSegments) {
+			return false
+		}
+		segments = segments[:len(patternSegments)]
+	}
+
+	if len(segments) != len(patternSegments) {
+		return false
+	}
+
+	for i, patternSegment := range patternSegments {
+		matched, err := path.Match(patternSegment, segments[i])
+		if err != nil || !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r KMSKeyRule) validate() error {
+	if !strings.HasPrefix(r.Pattern, "/") {
+		return fmt.Errorf("%w: path %q must start with /", ErrInvalidKMSKeyRule, r.Pattern)
+	}
+	if len(r.KeyID) == 0 {
+		return fmt.Errorf("%w: path %q has no KMS key", ErrInvalidKMSKeyRule, r.Pattern)
+	}
+
+	for _, segment := range strings.Split(r.Pattern, "/") {
+		_, err := path.Match(segment, "")
+		if err != nil {
+			return fmt.Errorf("%w: path %q: %s", ErrInvalidKMSKeyRule, r.Pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// kmsKeyIDPattern matches KMS key IDs, including multi-region key IDs.
+var kmsKeyIDPattern = regexp.MustCompile(`^(mrk-)?[0-9a-f]{8}-?[0-9a-f]{4}-?[0-9a-f]{4}-?[0-9a-f]{4}-?[0-9a-f]{12}$|^mrk-[0-9a-f]{32}$`)
+
+// kmsKeyID returns keyID as accepted by Parameter Store. Key IDs and ARNs are
+// returned as-is, while anything else is assumed to be an alias.
+func kmsKeyID(keyID string) string {
+	if strings.HasPrefix(keyID, kmsKeyAliasPrefix) || strings.HasPrefix(keyID, "arn:") || kmsKeyIDPattern.MatchString(keyID) {
+		return keyID
+	}
+
+	return kmsKeyAliasPrefix + keyID
+}
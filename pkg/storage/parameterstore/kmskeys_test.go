@@ -0,0 +1,76 @@
+package parameterstore_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/micvbang/confman-go/pkg/storage/parameterstore"
+	"github.com/stretchr/testify/require"
+)
+
+// TestKMSKeyRuleMatches verifies that rules match service paths segment by
+// segment, with a trailing /* matching the service paths at any depth below.
+func TestKMSKeyRuleMatches(t *testing.T) {
+	tests := map[string]struct {
+		pattern     string
+		servicePath string
+		expected    bool
+	}{
+		"exact":                {pattern: "/payments", servicePath: "/payments", expected: true},
+		"exact not below":      {pattern: "/payments", servicePath: "/payments/production", expected: false},
+		"trailing star self":   {pattern: "/payments/*", servicePath: "/payments", expected: true},
+		"trailing star below":  {pattern: "/payments/*", servicePath: "/payments/production/eu", expected: true},
+		"trailing star prefix": {pattern: "/payments/*", servicePath: "/payments-other", expected: false},
+		"star segment":         {pattern: "/*/production", servicePath: "/service/production", expected: true},
+		"star segment deeper":  {pattern: "/*/production", servicePath: "/service/production/eu", expected: false},
+		"partial segment":      {pattern: "/pay*/production", servicePath: "/payments/production", expected: true},
+		"no match":             {pattern: "/payments/*", servicePath: "/service", expected: false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			rule := parameterstore.KMSKeyRule{Pattern: test.pattern, KeyID: "alias/key"}
+			require.Equal(t, test.expected, rule.Matches(test.servicePath))
+		})
+	}
+}
+
+// TestParseKMSKeyRule verifies that rules are parsed from <path>=<KMS key>,
+// and that invalid rules are rejected.
+func TestParseKMSKeyRule(t *testing.T) {
+	rule, err := parameterstore.ParseKMSKeyRule("/payments/* = alias/payments")
+	require.NoError(t, err)
+	require.Equal(t, parameterstore.KMSKeyRule{Pattern: "/payments/*", KeyID: "alias/payments"}, rule)
+
+	for _, s := range []string{"/payments/*", "payments=alias/payments", "/payments=", "/[payments=alias/payments"} {
+		_, err := parameterstore.ParseKMSKeyRule(s)
+		require.ErrorIs(t, err, parameterstore.ErrInvalidKMSKeyRule, s)
+	}
+}
+
+// TestLoadKMSKeyRules verifies that rules are read from a YAML file in the
+// order they are given.
+func TestLoadKMSKeyRules(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "kms-keys.yaml")
+	err := os.WriteFile(filePath, []byte(`
+- path: /payments/*
+  key: alias/payments
+- path: /*/production
+  key: alias/production
+`), 0600)
+	require.NoError(t, err)
+
+	rules, err := parameterstore.LoadKMSKeyRules(filePath)
+	require.NoError(t, err)
+	require.Equal(t, []parameterstore.KMSKeyRule{
+		{Pattern: "/payments/*", KeyID: "alias/payments"},
+		{Pattern: "/*/production", KeyID: "alias/production"},
+	}, rules)
+
+	err = os.WriteFile(filePath, []byte("- path: payments\n  key: alias/payments\n"), 0600)
+	require.NoError(t, err)
+
+	_, err = parameterstore.LoadKMSKeyRules(filePath)
+	require.ErrorIs(t, err, parameterstore.ErrInvalidKMSKeyRule)
+}
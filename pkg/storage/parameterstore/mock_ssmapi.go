@@ -21,6 +21,12 @@ type MockSSMClient struct {
 
 	DeleteParametersCalled bool
 	MockDeleteParameters   func(ctx context.Context, params *ssm.DeleteParametersInput, optFns ...func(*ssm.Options)) (*ssm.DeleteParametersOutput, error)
+
+	AddTagsToResourceCalled bool
+	MockAddTagsToResource   func(ctx context.Context, params *ssm.AddTagsToResourceInput, optFns ...func(*ssm.Options)) (*ssm.AddTagsToResourceOutput, error)
+
+	ListTagsForResourceCalled bool
+	MockListTagsForResource   func(ctx context.Context, params *ssm.ListTagsForResourceInput, optFns ...func(*ssm.Options)) (*ssm.ListTagsForResourceOutput, error)
 }
 
 func (m *MockSSMClient) PutParameter(ctx context.Context, params *ssm.PutParameterInput, optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error) {
@@ -43,3 +49,11 @@ func (m *MockSSMClient) DeleteParameters(ctx context.Context, params *ssm.Delete
 	m.DeleteParametersCalled = true
 	return m.MockDeleteParameters(ctx, params, optFns...)
 }
+func (m *MockSSMClient) AddTagsToResource(ctx context.Context, params *ssm.AddTagsToResourceInput, optFns ...func(*ssm.Options)) (*ssm.AddTagsToResourceOutput, error) {
+	m.AddTagsToResourceCalled = true
+	return m.MockAddTagsToResource(ctx, params, optFns...)
+}
+func (m *MockSSMClient) ListTagsForResource(ctx context.Context, params *ssm.ListTagsForResourceInput, optFns ...func(*ssm.Options)) (*ssm.ListTagsForResourceOutput, error) {
+	m.ListTagsForResourceCalled = true
+	return m.MockListTagsForResource(ctx, params, optFns...)
+}
@@ -5,8 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"path"
+	"sort"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -26,9 +26,18 @@ type ParameterStore struct {
 	log       logger.Logger
 	ssmClient SSMClient
 	kmsKeyID  string
+
+	// kmsKeyRules select the KMS key of service paths, falling back to
+	// kmsKeyID if no rule matches.
+	kmsKeyRules []KMSKeyRule
 }
 
 var _ storage.Storage = &ParameterStore{}
+var _ storage.Lister = &ParameterStore{}
+var _ storage.Rekeyer = &ParameterStore{}
+var _ storage.OptionsWriter = &ParameterStore{}
+var _ storage.TagReader = &ParameterStore{}
+var _ storage.KeyValidator = &ParameterStore{}
 
 const kmsKeyAliasPrefix = "alias/"
 
@@ -38,13 +47,15 @@ type SSMClient interface {
 	GetParametersByPath(ctx context.Context, params *ssm.GetParametersByPathInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersByPathOutput, error)
 	DescribeParameters(ctx context.Context, params *ssm.DescribeParametersInput, optFns ...func(*ssm.Options)) (*ssm.DescribeParametersOutput, error)
 	DeleteParameters(ctx context.Context, params *ssm.DeleteParametersInput, optFns ...func(*ssm.Options)) (*ssm.DeleteParametersOutput, error)
+	AddTagsToResource(ctx context.Context, params *ssm.AddTagsToResourceInput, optFns ...func(*ssm.Options)) (*ssm.AddTagsToResourceOutput, error)
+	ListTagsForResource(ctx context.Context, params *ssm.ListTagsForResourceInput, optFns ...func(*ssm.Options)) (*ssm.ListTagsForResourceOutput, error)
 }
 
 // New returns a configured instance of ParameterStore.
+// kmsKeyAlias is prefixed with "alias/" unless it is already, or is a KMS key
+// ID or ARN.
 func New(log logger.Logger, ssmClient SSMClient, kmsKeyAlias string) *ParameterStore {
-	if !strings.HasPrefix(kmsKeyAlias, kmsKeyAliasPrefix) {
-		kmsKeyAlias = fmt.Sprintf("%s%s", kmsKeyAliasPrefix, kmsKeyAlias)
-	}
+	kmsKeyAlias = kmsKeyID(kmsKeyAlias)
 
 	log = log.
 		WithField("storage_type", "ParameterStore").
@@ -57,60 +68,164 @@ func New(log logger.Logger, ssmClient SSMClient, kmsKeyAlias string) *ParameterS
 	}
 }
 
-func (ps *ParameterStore) Write(ctx context.Context, servicePath string, key string, value string) error {
-	curValue, err := ps.Read(ctx, servicePath, key)
-	if err != nil && !errors.Is(err, storage.ErrConfigNotFound) {
-		return err
+// SetKMSKeyRules sets the rules selecting the KMS key used to encrypt the
+// parameters of each service path. The first matching rule is used, and the
+// default KMS key if none match.
+func (ps *ParameterStore) SetKMSKeyRules(rules []KMSKeyRule) {
+	ps.kmsKeyRules = make([]KMSKeyRule, len(rules))
+	for i, rule := range rules {
+		ps.kmsKeyRules[i] = KMSKeyRule{Pattern: rule.Pattern, KeyID: kmsKeyID(rule.KeyID)}
 	}
+}
 
-	if curValue == value {
-		return nil
+// KMSKeyID returns the KMS key used to encrypt parameters of servicePath.
+func (ps *ParameterStore) KMSKeyID(servicePath string) string {
+	for _, rule := range ps.kmsKeyRules {
+		if rule.Matches(servicePath) {
+			return rule.KeyID
+		}
 	}
 
-	_, err = ps.ssmClient.PutParameter(ctx, &ssm.PutParameterInput{
-		Name:      aws.String(ps.parameterPath(servicePath, key)),
-		KeyId:     aws.String(ps.kmsKeyID),
-		Type:      types.ParameterTypeSecureString, // Encrypt all configuration
-		Overwrite: aws.Bool(true),
-		Value:     aws.String(value),
+	return ps.kmsKeyID
+}
 
-		// If compatible with segmentio/chamber, must write version number here.
-		Description: aws.String(""),
-	})
-	return err
+func (ps *ParameterStore) Write(ctx context.Context, servicePath string, key string, value string) error {
+	return ps.WriteKeysWithOptions(ctx, servicePath, map[string]string{key: value}, nil)
 }
 
 func (ps *ParameterStore) WriteKeys(ctx context.Context, servicePath string, config map[string]string) error {
+	return ps.WriteKeysWithOptions(ctx, servicePath, config, nil)
+}
+
+// WriteKeysWithOptions writes the keys of config whose value, parameter type,
+// description, tier or types of policies differ from the current ones.
+// Existing keys keep their parameter type, description and tier unless others
+// are given by options, and new keys default to SecureString. Keys are
+// written using the advanced tier if their value is too large for the
+// standard tier, or they have policies. Tags given by options are added to
+// keys whether or not they are written.
+func (ps *ParameterStore) WriteKeysWithOptions(ctx context.Context, servicePath string, config map[string]string, options map[string]storage.WriteOptions) error {
 	if len(config) == 0 {
 		log.Warnf("WriteKeys called with 0 keys")
 		return nil
 	}
 
+	for key, keyOptions := range options {
+		err := keyOptions.Validate()
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+
+	// Nothing is written unless all keys can be written, such that writes
+	// don't fail halfway.
+	err := storage.ViolationsError(ps.validateKeys(servicePath, config, options))
+	if err != nil {
+		return err
+	}
+
 	keys := mapy.Keys(config)
 	log.Debugf("Attempting to write keys %v %v", servicePath, keys)
 
-	curConfig, err := ps.ReadKeys(ctx, servicePath, keys)
+	curParameters, err := ps.readParameters(ctx, servicePath, keys)
 	if err != nil && !errors.Is(err, storage.ErrConfigNotFound) {
 		return err
 	}
 
-	newValues := make(map[string]string, len(config))
-	for key, newValue := range config {
-		if newValue != curConfig[key] {
-			newValues[key] = newValue
+	parameterTypes := make(map[string]string, len(config))
+	changed := make(map[string]bool, len(config))
+	describeKeys := []string{}
+	for key, value := range config {
+		keyOptions := options[key]
+		parameterType := keyOptions.Type
+		cur, exists := curParameters[key]
+		if !exists {
+			if len(parameterType) == 0 {
+				parameterType = storage.ParameterTypeSecureString
+			}
+			parameterTypes[key] = parameterType
+			changed[key] = true
+			continue
+		}
+
+		changed[key] = aws.ToString(cur.Value) != value || (len(parameterType) > 0 && parameterType != string(cur.Type))
+		if len(parameterType) == 0 {
+			parameterType = string(cur.Type)
+		}
+		parameterTypes[key] = parameterType
+
+		// Metadata of existing keys is needed for detecting changes, and for
+		// keeping descriptions and tiers when overwriting the keys.
+		if changed[key] || len(keyOptions.Description) > 0 || len(keyOptions.Tier) > 0 || keyOptions.HasPolicies() {
+			describeKeys = append(describeKeys, key)
 		}
 	}
 
-	for key, value := range newValues {
+	curMetadata := map[string]types.ParameterMetadata{}
+	if len(describeKeys) > 0 {
+		curMetadata, err = ps.readParameterMetadata(ctx, servicePath, describeKeys)
+		if err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	for key, value := range config {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
 		}
 
-		err := ps.Write(ctx, servicePath, key, value)
-		if err != nil {
-			return err
+		keyOptions := options[key]
+		cur, described := curMetadata[key]
+
+		description := aws.ToString(cur.Description)
+		if len(keyOptions.Description) > 0 && keyOptions.Description != description {
+			description = keyOptions.Description
+			changed[key] = true
+		}
+
+		tier := parameterTier(value, keyOptions, cur)
+		if described && len(tier) > 0 && tier != string(cur.Tier) {
+			changed[key] = true
+		}
+
+		if keyOptions.HasPolicies() && policiesChanged(keyOptions, cur.Policies) {
+			changed[key] = true
+		}
+
+		if changed[key] {
+			input := &ssm.PutParameterInput{
+				Name:      aws.String(ps.parameterPath(servicePath, key)),
+				Type:      types.ParameterType(parameterTypes[key]),
+				Overwrite: aws.Bool(true),
+				Value:     aws.String(value),
+				Tier:      types.ParameterTier(tier),
+
+				// If compatible with segmentio/chamber, must write version number here.
+				Description: aws.String(description),
+			}
+
+			if keyOptions.HasPolicies() {
+				policies, err := parameterPolicies(keyOptions, now)
+				if err != nil {
+					return err
+				}
+				input.Policies = aws.String(policies)
+			}
+
+			err := ps.putParameter(ctx, servicePath, input)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(keyOptions.Tags) > 0 {
+			err := ps.addTags(ctx, servicePath, key, keyOptions.Tags)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
@@ -119,6 +234,100 @@ func (ps *ParameterStore) WriteKeys(ctx context.Context, servicePath string, con
 	return nil
 }
 
+func (ps *ParameterStore) putParameter(ctx context.Context, servicePath string, input *ssm.PutParameterInput) error {
+	// Parameter Store rejects KMS keys for parameters that aren't encrypted.
+	if input.Type == types.ParameterTypeSecureString {
+		input.KeyId = aws.String(ps.KMSKeyID(servicePath))
+	}
+
+	_, err := ps.ssmClient.PutParameter(ctx, input)
+	return err
+}
+
+func (ps *ParameterStore) addTags(ctx context.Context, servicePath string, key string, tags map[string]string) error {
+	names := mapy.Keys(tags)
+	sort.Strings(names)
+
+	ssmTags := make([]types.Tag, 0, len(tags))
+	for _, name := range names {
+		ssmTags = append(ssmTags, types.Tag{Key: aws.String(name), Value: aws.String(tags[name])})
+	}
+
+	// Tags can't be given to PutParameter when overwriting parameters.
+	_, err := ps.ssmClient.AddTagsToResource(ctx, &ssm.AddTagsToResourceInput{
+		ResourceType: types.ResourceTypeForTaggingParameter,
+		ResourceId:   aws.String(ps.parameterPath(servicePath, key)),
+		Tags:         ssmTags,
+	})
+	return err
+}
+
+// readParameterMetadata returns the metadata of the existing keys of keys.
+func (ps *ParameterStore) readParameterMetadata(ctx context.Context, servicePath string, keys []string) (map[string]types.ParameterMetadata, error) {
+	metadata := make(map[string]types.ParameterMetadata, len(keys))
+
+	for _, batchKeys := range ps.batchKeys(keys, maxKeysPerRequest) {
+		paginator := ssm.NewDescribeParametersPaginator(ps.ssmClient, &ssm.DescribeParametersInput{
+			ParameterFilters: []types.ParameterStringFilter{
+				{
+					Key:    aws.String("Name"),
+					Option: aws.String("Equals"),
+					Values: ps.keysToParameterNames(servicePath, batchKeys),
+				},
+			},
+		})
+
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, p := range page.Parameters {
+				metadata[ps.parameterMetadataBaseName(p)] = p
+			}
+		}
+	}
+
+	return metadata, nil
+}
+
+// ReadTags returns the tags of the keys of servicePath, requiring a request
+// per key.
+func (ps *ParameterStore) ReadTags(ctx context.Context, servicePath string) (map[string]map[string]string, error) {
+	log := ps.populateLogger(servicePath)
+
+	log.Debugf("Attempting to read tags")
+
+	keysMetadata, err := ps.readAllKeyMetadata(ctx, servicePath)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make(map[string]map[string]string, len(keysMetadata))
+	for _, km := range keysMetadata {
+		output, err := ps.ssmClient.ListTagsForResource(ctx, &ssm.ListTagsForResourceInput{
+			ResourceType: types.ResourceTypeForTaggingParameter,
+			ResourceId:   aws.String(ps.parameterPath(servicePath, km.key)),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(output.TagList) == 0 {
+			continue
+		}
+
+		keyTags := make(map[string]string, len(output.TagList))
+		for _, tag := range output.TagList {
+			keyTags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+		}
+		tags[km.key] = keyTags
+	}
+
+	return tags, nil
+}
+
 func (ps *ParameterStore) Read(ctx context.Context, servicePath string, key string) (value string, _ error) {
 	config, err := ps.ReadKeys(ctx, servicePath, []string{key})
 	if err != nil {
@@ -137,20 +346,39 @@ func (ps *ParameterStore) ReadKeys(ctx context.Context, servicePath string, keys
 		return nil, nil
 	}
 
-	config := make(map[string]string, len(keys))
+	parameters, err := ps.readParameters(ctx, servicePath, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	config := make(map[string]string, len(parameters))
+	for key, parameter := range parameters {
+		config[key] = aws.ToString(parameter.Value)
+	}
+
+	return config, nil
+}
+
+// readParameters returns the parameters of keys. If some of the keys don't
+// exist, the existing parameters are returned along with ErrConfigNotFound.
+func (ps *ParameterStore) readParameters(ctx context.Context, servicePath string, keys []string) (map[string]types.Parameter, error) {
+	parameters := make(map[string]types.Parameter, len(keys))
 
+	var notFoundErr error
 	for _, batchKeys := range ps.batchKeys(keys, maxKeysPerRequest) {
-		batchConfig, err := ps.readKeys(ctx, servicePath, batchKeys)
-		if err != nil {
+		batchParameters, err := ps.readKeys(ctx, servicePath, batchKeys)
+		if errors.Is(err, storage.ErrConfigNotFound) {
+			notFoundErr = err
+		} else if err != nil {
 			return nil, err
 		}
 
-		for key, value := range batchConfig {
-			config[key] = value
+		for key, parameter := range batchParameters {
+			parameters[key] = parameter
 		}
 	}
 
-	return config, nil
+	return parameters, notFoundErr
 }
 
 func (ps *ParameterStore) keyMetadataToKeyMetadata(readKey keyMetadata) storage.KeyMetadata {
@@ -164,11 +392,13 @@ func (ps *ParameterStore) keyMetadataToKeyMetadata(readKey keyMetadata) storage.
 			"last_modified_date": readKey.lastModifiedDate.Format(time.RFC3339),
 			"last_modified_user": readKey.lastModifiedUser,
 			"tier":               readKey.tier,
+			"kms_key_id":         readKey.kmsKeyID,
+			"policies":           readKey.policies,
 		},
 	}
 }
 
-func (ps *ParameterStore) readKeys(ctx context.Context, servicePath string, keys []string) (map[string]string, error) {
+func (ps *ParameterStore) readKeys(ctx context.Context, servicePath string, keys []string) (map[string]types.Parameter, error) {
 	log := ps.populateLogger(servicePath)
 
 	if len(keys) > maxKeysPerRequest {
@@ -192,19 +422,18 @@ func (ps *ParameterStore) readKeys(ctx context.Context, servicePath string, keys
 		return nil, err
 	}
 
-	// Return no keys if just one did not exist.
-	if len(output.InvalidParameters) > 0 {
-		return nil, storage.ErrConfigNotFound
-	}
-
-	config := make(map[string]string, len(keys))
+	parameters := make(map[string]types.Parameter, len(keys))
 	for _, parameter := range output.Parameters {
-		config[ps.parameterBaseName(parameter)] = aws.ToString(parameter.Value)
+		parameters[ps.parameterBaseName(parameter)] = parameter
 	}
 
 	log.Debugf("Read keys %s %v", servicePath, keys)
 
-	return config, nil
+	if len(output.InvalidParameters) > 0 {
+		return parameters, storage.ErrConfigNotFound
+	}
+
+	return parameters, nil
 }
 
 func (ps *ParameterStore) ReadAll(ctx context.Context, servicePath string) (map[string]string, error) {
@@ -267,6 +496,8 @@ type keyMetadata struct {
 	lastModifiedDate time.Time
 	lastModifiedUser string
 	tier             string
+	kmsKeyID         string
+	policies         string
 }
 
 func (ps *ParameterStore) readAllKeyMetadata(ctx context.Context, servicePath string) ([]keyMetadata, error) {
@@ -279,7 +510,55 @@ func (ps *ParameterStore) readAllKeyMetadata(ctx context.Context, servicePath st
 		return nil, err
 	}
 
-	keysMetadata := make([]keyMetadata, 0, 50)
+	parameters, err := ps.describeParameters(ctx, servicePath)
+	if err != nil {
+		return nil, err
+	}
+
+	keysMetadata := make([]keyMetadata, 0, len(parameters))
+	for _, p := range parameters {
+		key := ps.parameterMetadataBaseName(p)
+
+		keysMetadata = append(keysMetadata, keyMetadata{
+			key:              key,
+			value:            config[key],
+			description:      aws.ToString(p.Description),
+			version:          p.Version,
+			lastModifiedDate: aws.ToTime(p.LastModifiedDate),
+			parameterType:    string(p.Type),
+			tier:             string(p.Tier),
+			lastModifiedUser: aws.ToString(p.LastModifiedUser),
+			kmsKeyID:         aws.ToString(p.KeyId),
+			policies:         formatPolicies(p.Policies),
+		})
+	}
+
+	return keysMetadata, nil
+}
+
+// ReadVersions returns the versions of the keys of servicePath, without
+// reading or decrypting their values.
+func (ps *ParameterStore) ReadVersions(ctx context.Context, servicePath string) (map[string]string, error) {
+	log := ps.populateLogger(servicePath)
+
+	log.Debugf("Attempting to read versions")
+
+	parameters, err := ps.describeParameters(ctx, servicePath)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make(map[string]string, len(parameters))
+	for _, p := range parameters {
+		versions[ps.parameterMetadataBaseName(p)] = strconv.FormatInt(p.Version, 10)
+	}
+
+	return versions, nil
+}
+
+// describeParameters returns the metadata of all parameters of servicePath.
+func (ps *ParameterStore) describeParameters(ctx context.Context, servicePath string) ([]types.ParameterMetadata, error) {
+	parameters := make([]types.ParameterMetadata, 0, 50)
 
 	paginator := ssm.NewDescribeParametersPaginator(ps.ssmClient, &ssm.DescribeParametersInput{
 		ParameterFilters: []types.ParameterStringFilter{
@@ -304,23 +583,93 @@ func (ps *ParameterStore) readAllKeyMetadata(ctx context.Context, servicePath st
 			return nil, err
 		}
 
+		parameters = append(parameters, page.Parameters...)
+	}
+
+	return parameters, nil
+}
+
+func (ps *ParameterStore) ListServicePaths(ctx context.Context, prefix string) ([]string, error) {
+	ps.log.Debugf("Attempting to list service paths below %s", prefix)
+
+	pathFilter := prefix
+	if len(pathFilter) == 0 {
+		pathFilter = "/"
+	}
+
+	paginator := ssm.NewDescribeParametersPaginator(ps.ssmClient, &ssm.DescribeParametersInput{
+		ParameterFilters: []types.ParameterStringFilter{
+			{
+				Key:    aws.String("Path"),
+				Option: aws.String("Recursive"),
+				Values: []string{pathFilter},
+			},
+		},
+	})
+
+	servicePaths := map[string]struct{}{}
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
 		for _, p := range page.Parameters {
-			key := ps.parameterMetadataBaseName(p)
-
-			keysMetadata = append(keysMetadata, keyMetadata{
-				key:              key,
-				value:            config[key],
-				description:      aws.ToString(p.Description),
-				version:          p.Version,
-				lastModifiedDate: aws.ToTime(p.LastModifiedDate),
-				parameterType:    string(p.Type),
-				tier:             string(p.Tier),
-				lastModifiedUser: aws.ToString(p.LastModifiedUser),
-			})
+			servicePath := path.Dir(aws.ToString(p.Name))
+			if storage.IsBelow(servicePath, prefix) {
+				servicePaths[servicePath] = struct{}{}
+			}
 		}
 	}
 
-	return keysMetadata, nil
+	sortedServicePaths := mapy.Keys(servicePaths)
+	sort.Strings(sortedServicePaths)
+	return sortedServicePaths, nil
+}
+
+// Rekey re-puts the SecureString parameters of servicePath that are not
+// encrypted using the KMS key selected for servicePath, such that they are
+// encrypted using it. Keys are compared as given, i.e. a parameter encrypted
+// using a key ID is re-put if the rule gives the alias of the same key.
+func (ps *ParameterStore) Rekey(ctx context.Context, servicePath string) (int, error) {
+	log := ps.populateLogger(servicePath)
+
+	keysMetadata, err := ps.readAllKeyMetadata(ctx, servicePath)
+	if err != nil {
+		return 0, err
+	}
+
+	kmsKeyID := ps.KMSKeyID(servicePath)
+	numRekeyed := 0
+	for _, km := range keysMetadata {
+		if km.parameterType != string(types.ParameterTypeSecureString) || km.kmsKeyID == kmsKeyID {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return numRekeyed, ctx.Err()
+		default:
+		}
+
+		log.Debugf("Re-encrypting %s using %s, was %s", km.key, kmsKeyID, km.kmsKeyID)
+
+		_, err := ps.ssmClient.PutParameter(ctx, &ssm.PutParameterInput{
+			Name:        aws.String(ps.parameterPath(servicePath, km.key)),
+			KeyId:       aws.String(kmsKeyID),
+			Type:        types.ParameterTypeSecureString,
+			Overwrite:   aws.Bool(true),
+			Value:       aws.String(km.value),
+			Description: aws.String(km.description),
+			Tier:        types.ParameterTier(km.tier),
+		})
+		if err != nil {
+			return numRekeyed, err
+		}
+		numRekeyed++
+	}
+
+	return numRekeyed, nil
 }
 
 func (ps *ParameterStore) Delete(ctx context.Context, servicePath string, key string) error {
@@ -395,18 +744,11 @@ func (ps *ParameterStore) parameterBaseName(parameter types.Parameter) string {
 }
 
 func (ps *ParameterStore) batchKeys(keys []string, batchSize int) [][]string {
-	numBatches := (len(keys) / batchSize) + 1
-	batches := make([][]string, 0, numBatches)
+	batches := make([][]string, 0, len(keys)/batchSize+1)
 
-	for batchI := 0; batchI < numBatches; batchI++ {
-		batch := make([]string, 0, batchSize)
-
-		maxIters := inty.Min(len(keys), batchSize)
-		for i := 0; i < maxIters; i++ {
-			keyI := batchI*batchSize + i
-			batch = append(batch, keys[keyI])
-		}
-		batches = append(batches, batch)
+	for start := 0; start < len(keys); start += batchSize {
+		end := inty.Min(len(keys), start+batchSize)
+		batches = append(batches, keys[start:end])
 	}
 
 	return batches
@@ -435,6 +777,11 @@ func (ps *ParameterStore) MetadataKeys() []string {
 		"version",
 		"last_modified_date",
 		"last_modified_user",
+		"parameter_type",
+		"kms_key_id",
+		"description",
+		"tier",
+		"policies",
 	}
 }
 
@@ -2,9 +2,15 @@ package parameterstore_test
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
@@ -13,6 +19,7 @@ import (
 	"github.com/micvbang/confman-go/pkg/logger"
 	"github.com/micvbang/confman-go/pkg/storage"
 	"github.com/micvbang/confman-go/pkg/storage/parameterstore"
+	"github.com/micvbang/confman-go/pkg/storage/storagetest"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
 )
@@ -80,6 +87,9 @@ func TestParameterStoreWriteExistsNotEqual(t *testing.T) {
 		parameters := makeParameters(servicePath, map[string]string{key: "not value"})
 		return &ssm.GetParametersOutput{Parameters: parameters}, nil
 	}
+	ssmMock.MockDescribeParameters = func(ctx context.Context, params *ssm.DescribeParametersInput, optFns ...func(*ssm.Options)) (*ssm.DescribeParametersOutput, error) {
+		return &ssm.DescribeParametersOutput{}, nil
+	}
 	ssmMock.MockPutParameter = func(ctx context.Context, params *ssm.PutParameterInput, optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error) {
 		return &ssm.PutParameterOutput{}, nil
 	}
@@ -384,3 +394,674 @@ func makeParameters(servicePath string, config map[string]string) []types.Parame
 
 	return parameters
 }
+
+// TestParameterStoreListServicePaths verifies that ListServicePaths returns
+// the sorted, unique service paths of parameters below the prefix, across
+// pages.
+func TestParameterStoreListServicePaths(t *testing.T) {
+	pages := [][]string{
+		{"/service/production/KEY1", "/service/production/nested/KEY"},
+		{"/service/development/KEY", "/service/production/KEY2"},
+	}
+
+	ssmMock := &parameterstore.MockSSMClient{}
+	ssmMock.MockDescribeParameters = func(ctx context.Context, params *ssm.DescribeParametersInput, optFns ...func(*ssm.Options)) (*ssm.DescribeParametersOutput, error) {
+		require.Equal(t, []string{"/service"}, params.ParameterFilters[0].Values)
+		require.Equal(t, "Recursive", aws.ToString(params.ParameterFilters[0].Option))
+
+		page := 0
+		if params.NextToken != nil {
+			page = 1
+		}
+
+		output := &ssm.DescribeParametersOutput{}
+		for _, name := range pages[page] {
+			output.Parameters = append(output.Parameters, types.ParameterMetadata{Name: aws.String(name)})
+		}
+		if page == 0 {
+			output.NextToken = aws.String("next")
+		}
+		return output, nil
+	}
+
+	ps := parameterstore.New(log, ssmMock, "kms key id")
+
+	servicePaths, err := ps.ListServicePaths(context.Background(), "/service")
+	require.NoError(t, err)
+	require.Equal(t, []string{"/service/development", "/service/production", "/service/production/nested"}, servicePaths)
+}
+
+// TestParameterStoreWriteKMSKeyRules verifies that parameters are encrypted
+// using the KMS key of the first rule matching their service path, and the
+// default KMS key if none match.
+func TestParameterStoreWriteKMSKeyRules(t *testing.T) {
+	tests := map[string]struct {
+		servicePath string
+		expected    string
+	}{
+		"first match":    {servicePath: "/payments/production", expected: "alias/payments"},
+		"later match":    {servicePath: "/service/production", expected: "alias/production"},
+		"no match":       {servicePath: "/service/development", expected: "alias/default"},
+		"key id as-is":   {servicePath: "/audit", expected: "1234abcd-12ab-34cd-56ef-1234567890ab"},
+		"prefix matches": {servicePath: "/payments", expected: "alias/payments"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var gotKeyID string
+
+			ssmMock := &parameterstore.MockSSMClient{}
+			ssmMock.MockGetParameters = func(ctx context.Context, params *ssm.GetParametersInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersOutput, error) {
+				return nil, ErrParameterNotFound
+			}
+			ssmMock.MockPutParameter = func(ctx context.Context, params *ssm.PutParameterInput, optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error) {
+				gotKeyID = aws.ToString(params.KeyId)
+				return &ssm.PutParameterOutput{}, nil
+			}
+
+			ps := parameterstore.New(log, ssmMock, "default")
+			ps.SetKMSKeyRules([]parameterstore.KMSKeyRule{
+				{Pattern: "/payments/*", KeyID: "payments"},
+				{Pattern: "/*/production", KeyID: "alias/production"},
+				{Pattern: "/audit", KeyID: "1234abcd-12ab-34cd-56ef-1234567890ab"},
+			})
+
+			err := ps.Write(context.Background(), test.servicePath, "key", "value")
+			require.NoError(t, err)
+			require.Equal(t, test.expected, gotKeyID)
+		})
+	}
+}
+
+// TestParameterStoreRekey verifies that Rekey re-puts the SecureString
+// parameters that are not encrypted using the KMS key selected for the
+// service path, keeping their value and description, and that the KMS key of
+// parameters is returned as metadata.
+func TestParameterStoreRekey(t *testing.T) {
+	const servicePath = "/payments/production"
+
+	config := map[string]string{
+		"OLD_KEY":   "old",
+		"NEW_KEY":   "new",
+		"PLAINTEXT": "plain",
+	}
+
+	ssmMock := &parameterstore.MockSSMClient{}
+	ssmMock.MockGetParametersByPath = func(ctx context.Context, params *ssm.GetParametersByPathInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersByPathOutput, error) {
+		return &ssm.GetParametersByPathOutput{Parameters: makeParameters(servicePath, config)}, nil
+	}
+	ssmMock.MockDescribeParameters = func(ctx context.Context, params *ssm.DescribeParametersInput, optFns ...func(*ssm.Options)) (*ssm.DescribeParametersOutput, error) {
+		return &ssm.DescribeParametersOutput{
+			Parameters: []types.ParameterMetadata{
+				{Name: aws.String(servicePath + "/OLD_KEY"), Type: types.ParameterTypeSecureString, KeyId: aws.String("alias/parameter_store_key"), Description: aws.String("description")},
+				{Name: aws.String(servicePath + "/NEW_KEY"), Type: types.ParameterTypeSecureString, KeyId: aws.String("alias/payments")},
+				{Name: aws.String(servicePath + "/PLAINTEXT"), Type: types.ParameterTypeString},
+			},
+		}, nil
+	}
+
+	puts := []*ssm.PutParameterInput{}
+	ssmMock.MockPutParameter = func(ctx context.Context, params *ssm.PutParameterInput, optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error) {
+		puts = append(puts, params)
+		return &ssm.PutParameterOutput{}, nil
+	}
+
+	ps := parameterstore.New(log, ssmMock, "parameter_store_key")
+	ps.SetKMSKeyRules([]parameterstore.KMSKeyRule{{Pattern: "/payments/*", KeyID: "alias/payments"}})
+
+	ctx := context.Background()
+	keyMetadata, err := ps.ReadAllMetadata(ctx, servicePath)
+	require.NoError(t, err)
+	for _, km := range keyMetadata {
+		if km.Key == "OLD_KEY" {
+			require.Equal(t, "alias/parameter_store_key", km.Metadata["kms_key_id"])
+		}
+	}
+
+	numRekeyed, err := ps.Rekey(ctx, servicePath)
+	require.NoError(t, err)
+	require.Equal(t, 1, numRekeyed)
+	require.Len(t, puts, 1)
+	require.Equal(t, servicePath+"/OLD_KEY", aws.ToString(puts[0].Name))
+	require.Equal(t, "old", aws.ToString(puts[0].Value))
+	require.Equal(t, "description", aws.ToString(puts[0].Description))
+	require.Equal(t, "alias/payments", aws.ToString(puts[0].KeyId))
+	require.True(t, aws.ToBool(puts[0].Overwrite))
+}
+
+// TestParameterStoreWriteKeysWithOptions verifies that keys are written with
+// the parameter type given by options, that existing keys keep their type
+// unless another is given, that new keys default to SecureString, and that
+// KMS keys are only given for SecureString parameters.
+func TestParameterStoreWriteKeysWithOptions(t *testing.T) {
+	const servicePath = "/service/production"
+
+	tests := map[string]struct {
+		existing     *types.Parameter
+		value        string
+		options      map[string]storage.WriteOptions
+		expectedPut  bool
+		expectedType types.ParameterType
+	}{
+		"new key defaults to SecureString": {
+			value:        "value",
+			expectedPut:  true,
+			expectedType: types.ParameterTypeSecureString,
+		},
+		"new key with type": {
+			value:        "value",
+			options:      map[string]storage.WriteOptions{"KEY": {Type: storage.ParameterTypeString}},
+			expectedPut:  true,
+			expectedType: types.ParameterTypeString,
+		},
+		"changed value keeps type": {
+			existing:     &types.Parameter{Value: aws.String("old"), Type: types.ParameterTypeStringList},
+			value:        "a,b",
+			expectedPut:  true,
+			expectedType: types.ParameterTypeStringList,
+		},
+		"unchanged value with changed type": {
+			existing:     &types.Parameter{Value: aws.String("value"), Type: types.ParameterTypeSecureString},
+			value:        "value",
+			options:      map[string]storage.WriteOptions{"KEY": {Type: storage.ParameterTypeString}},
+			expectedPut:  true,
+			expectedType: types.ParameterTypeString,
+		},
+		"unchanged value and type": {
+			existing: &types.Parameter{Value: aws.String("value"), Type: types.ParameterTypeString},
+			value:    "value",
+			options:  map[string]storage.WriteOptions{"KEY": {Type: storage.ParameterTypeString}},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ssmMock := &parameterstore.MockSSMClient{}
+			ssmMock.MockGetParameters = func(ctx context.Context, params *ssm.GetParametersInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersOutput, error) {
+				if test.existing == nil {
+					return &ssm.GetParametersOutput{InvalidParameters: params.Names}, nil
+				}
+
+				parameter := *test.existing
+				parameter.Name = aws.String(servicePath + "/KEY")
+				return &ssm.GetParametersOutput{Parameters: []types.Parameter{parameter}}, nil
+			}
+
+			ssmMock.MockDescribeParameters = func(ctx context.Context, params *ssm.DescribeParametersInput, optFns ...func(*ssm.Options)) (*ssm.DescribeParametersOutput, error) {
+				return &ssm.DescribeParametersOutput{}, nil
+			}
+
+			var put *ssm.PutParameterInput
+			ssmMock.MockPutParameter = func(ctx context.Context, params *ssm.PutParameterInput, optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error) {
+				put = params
+				return &ssm.PutParameterOutput{}, nil
+			}
+
+			ps := parameterstore.New(log, ssmMock, "kms key id")
+
+			err := ps.WriteKeysWithOptions(context.Background(), servicePath, map[string]string{"KEY": test.value}, test.options)
+			require.NoError(t, err)
+			require.Equal(t, test.expectedPut, ssmMock.PutParameterCalled)
+			if !test.expectedPut {
+				return
+			}
+
+			require.Equal(t, test.value, aws.ToString(put.Value))
+			require.Equal(t, test.expectedType, put.Type)
+			if test.expectedType == types.ParameterTypeSecureString {
+				require.Equal(t, "alias/kms key id", aws.ToString(put.KeyId))
+			} else {
+				require.Nil(t, put.KeyId)
+			}
+		})
+	}
+}
+
+// TestParameterStoreWriteKeysWithOptionsInvalid verifies that nothing is
+// written when options are invalid.
+func TestParameterStoreWriteKeysWithOptionsInvalid(t *testing.T) {
+	ps := parameterstore.New(log, &parameterstore.MockSSMClient{}, "kms key id")
+
+	err := ps.WriteKeysWithOptions(context.Background(), "/service", map[string]string{"KEY": "value"}, map[string]storage.WriteOptions{
+		"KEY": {Type: "Secure"},
+	})
+	require.ErrorIs(t, err, storage.ErrInvalidWriteOptions)
+}
+
+// TestParameterStoreWriteKeysDescriptionsAndTags verifies that changed
+// descriptions are written even if values are unchanged, that overwritten
+// keys keep their description unless another is given, and that tags are
+// added to keys.
+func TestParameterStoreWriteKeysDescriptionsAndTags(t *testing.T) {
+	const servicePath = "/service/production"
+
+	ssmMock := &parameterstore.MockSSMClient{}
+	ssmMock.MockGetParameters = func(ctx context.Context, params *ssm.GetParametersInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersOutput, error) {
+		parameters := makeParameters(servicePath, map[string]string{"DESCRIBED": "value", "CHANGED": "old", "UNCHANGED": "value"})
+		for i := range parameters {
+			parameters[i].Type = types.ParameterTypeSecureString
+		}
+		return &ssm.GetParametersOutput{Parameters: parameters}, nil
+	}
+	ssmMock.MockDescribeParameters = func(ctx context.Context, params *ssm.DescribeParametersInput, optFns ...func(*ssm.Options)) (*ssm.DescribeParametersOutput, error) {
+		require.ElementsMatch(t, []string{servicePath + "/DESCRIBED", servicePath + "/CHANGED"}, params.ParameterFilters[0].Values)
+		return &ssm.DescribeParametersOutput{
+			Parameters: []types.ParameterMetadata{
+				{Name: aws.String(servicePath + "/DESCRIBED"), Description: aws.String("old description")},
+				{Name: aws.String(servicePath + "/CHANGED"), Description: aws.String("kept description")},
+			},
+		}, nil
+	}
+
+	puts := map[string]*ssm.PutParameterInput{}
+	ssmMock.MockPutParameter = func(ctx context.Context, params *ssm.PutParameterInput, optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error) {
+		puts[path.Base(aws.ToString(params.Name))] = params
+		return &ssm.PutParameterOutput{}, nil
+	}
+
+	var addedTags *ssm.AddTagsToResourceInput
+	ssmMock.MockAddTagsToResource = func(ctx context.Context, params *ssm.AddTagsToResourceInput, optFns ...func(*ssm.Options)) (*ssm.AddTagsToResourceOutput, error) {
+		addedTags = params
+		return &ssm.AddTagsToResourceOutput{}, nil
+	}
+
+	ps := parameterstore.New(log, ssmMock, "kms key id")
+
+	err := ps.WriteKeysWithOptions(context.Background(), servicePath, map[string]string{
+		"DESCRIBED": "value",
+		"CHANGED":   "new",
+		"UNCHANGED": "value",
+	}, map[string]storage.WriteOptions{
+		"DESCRIBED": {Description: "new description"},
+		"UNCHANGED": {Tags: map[string]string{"owner": "team-x", "data": "pii"}},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, puts, 2)
+	require.Equal(t, "new description", aws.ToString(puts["DESCRIBED"].Description))
+	require.Equal(t, "kept description", aws.ToString(puts["CHANGED"].Description))
+
+	require.Equal(t, servicePath+"/UNCHANGED", aws.ToString(addedTags.ResourceId))
+	require.Equal(t, types.ResourceTypeForTaggingParameter, addedTags.ResourceType)
+	require.Equal(t, []types.Tag{
+		{Key: aws.String("data"), Value: aws.String("pii")},
+		{Key: aws.String("owner"), Value: aws.String("team-x")},
+	}, addedTags.Tags)
+}
+
+// TestParameterStoreWriteKeysTiersAndPolicies verifies that keys are written
+// using the advanced tier if their value is too large for the standard tier,
+// they have policies or they already use it, and that policies are only
+// written when values are changed or the types of policies differ, such that
+// writing unchanged keys doesn't move their expiration.
+func TestParameterStoreWriteKeysTiersAndPolicies(t *testing.T) {
+	const servicePath = "/service/production"
+
+	ssmMock := &parameterstore.MockSSMClient{}
+	ssmMock.MockGetParameters = func(ctx context.Context, params *ssm.GetParametersInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersOutput, error) {
+		parameters := makeParameters(servicePath, map[string]string{"TOKEN": "token", "ROTATED": "old", "ADVANCED": "old"})
+		for i := range parameters {
+			parameters[i].Type = types.ParameterTypeSecureString
+		}
+		return &ssm.GetParametersOutput{
+			Parameters:        parameters,
+			InvalidParameters: []string{servicePath + "/LARGE"},
+		}, nil
+	}
+	ssmMock.MockDescribeParameters = func(ctx context.Context, params *ssm.DescribeParametersInput, optFns ...func(*ssm.Options)) (*ssm.DescribeParametersOutput, error) {
+		return &ssm.DescribeParametersOutput{
+			Parameters: []types.ParameterMetadata{
+				{
+					Name: aws.String(servicePath + "/TOKEN"),
+					Tier: types.ParameterTierAdvanced,
+					Policies: []types.ParameterInlinePolicy{
+						{PolicyType: aws.String("Expiration")},
+						{PolicyType: aws.String("ExpirationNotification")},
+					},
+				},
+				{Name: aws.String(servicePath + "/ROTATED"), Tier: types.ParameterTierStandard},
+				{Name: aws.String(servicePath + "/ADVANCED"), Tier: types.ParameterTierAdvanced},
+			},
+		}, nil
+	}
+
+	puts := map[string]*ssm.PutParameterInput{}
+	ssmMock.MockPutParameter = func(ctx context.Context, params *ssm.PutParameterInput, optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error) {
+		puts[path.Base(aws.ToString(params.Name))] = params
+		return &ssm.PutParameterOutput{}, nil
+	}
+
+	ps := parameterstore.New(log, ssmMock, "kms key id")
+
+	policies := storage.WriteOptions{
+		ExpiresIn:    storage.Duration(90 * 24 * time.Hour),
+		NotifyBefore: storage.Duration(7 * 24 * time.Hour),
+	}
+	err := ps.WriteKeysWithOptions(context.Background(), servicePath, map[string]string{
+		"LARGE":    strings.Repeat("x", 5000),
+		"TOKEN":    "token",
+		"ROTATED":  "new",
+		"ADVANCED": "new",
+	}, map[string]storage.WriteOptions{
+		"TOKEN":   policies,
+		"ROTATED": policies,
+	})
+	require.NoError(t, err)
+
+	require.Len(t, puts, 3)
+	require.Equal(t, types.ParameterTierAdvanced, puts["LARGE"].Tier)
+	require.Nil(t, puts["LARGE"].Policies)
+	require.Equal(t, types.ParameterTierAdvanced, puts["ADVANCED"].Tier)
+
+	rotated := puts["ROTATED"]
+	require.Equal(t, types.ParameterTierAdvanced, rotated.Tier)
+
+	written := []struct {
+		Type       string
+		Attributes map[string]string
+	}{}
+	require.NoError(t, json.Unmarshal([]byte(aws.ToString(rotated.Policies)), &written))
+	require.Len(t, written, 2)
+
+	require.Equal(t, "Expiration", written[0].Type)
+	expiration, err := time.Parse(time.RFC3339, written[0].Attributes["Timestamp"])
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().Add(90*24*time.Hour), expiration, time.Minute)
+
+	require.Equal(t, "ExpirationNotification", written[1].Type)
+	require.Equal(t, map[string]string{"Before": "7", "Unit": "Days"}, written[1].Attributes)
+}
+
+// TestParameterStoreReadAllMetadataPolicies verifies that metadata includes
+// the policies of keys and their status.
+func TestParameterStoreReadAllMetadataPolicies(t *testing.T) {
+	const servicePath = "/service/production"
+
+	ssmMock := &parameterstore.MockSSMClient{}
+	ssmMock.MockGetParametersByPath = func(ctx context.Context, params *ssm.GetParametersByPathInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersByPathOutput, error) {
+		return &ssm.GetParametersByPathOutput{Parameters: makeParameters(servicePath, map[string]string{"TOKEN": "token"})}, nil
+	}
+	ssmMock.MockDescribeParameters = func(ctx context.Context, params *ssm.DescribeParametersInput, optFns ...func(*ssm.Options)) (*ssm.DescribeParametersOutput, error) {
+		return &ssm.DescribeParametersOutput{
+			Parameters: []types.ParameterMetadata{
+				{
+					Name: aws.String(servicePath + "/TOKEN"),
+					Tier: types.ParameterTierAdvanced,
+					Policies: []types.ParameterInlinePolicy{
+						{
+							PolicyType:   aws.String("Expiration"),
+							PolicyStatus: aws.String("Pending"),
+							PolicyText:   aws.String(`{"Type":"Expiration","Version":"1.0","Attributes":{"Timestamp":"2027-01-17T00:00:00Z"}}`),
+						},
+						{
+							PolicyType:   aws.String("NoChangeNotification"),
+							PolicyStatus: aws.String("Pending"),
+							PolicyText:   aws.String(`{"Type":"NoChangeNotification","Version":"1.0","Attributes":{"After":"30","Unit":"Days"}}`),
+						},
+					},
+				},
+			},
+		}, nil
+	}
+
+	ps := parameterstore.New(log, ssmMock, "kms key id")
+
+	keyMetadata, err := ps.ReadAllMetadata(context.Background(), servicePath)
+	require.NoError(t, err)
+	require.Len(t, keyMetadata, 1)
+	require.Equal(t, "Advanced", keyMetadata[0].Metadata["tier"])
+	require.Equal(t, "Expiration 2027-01-17T00:00:00Z (Pending), NoChangeNotification 30 Days (Pending)", keyMetadata[0].Metadata["policies"])
+}
+
+// TestParameterStoreReadTags verifies that ReadTags returns the tags of the
+// keys of a service path that have any.
+func TestParameterStoreReadTags(t *testing.T) {
+	const servicePath = "/service/production"
+
+	ssmMock := &parameterstore.MockSSMClient{}
+	ssmMock.MockGetParametersByPath = func(ctx context.Context, params *ssm.GetParametersByPathInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersByPathOutput, error) {
+		return &ssm.GetParametersByPathOutput{Parameters: makeParameters(servicePath, map[string]string{"TAGGED": "v", "UNTAGGED": "v"})}, nil
+	}
+	ssmMock.MockDescribeParameters = func(ctx context.Context, params *ssm.DescribeParametersInput, optFns ...func(*ssm.Options)) (*ssm.DescribeParametersOutput, error) {
+		return &ssm.DescribeParametersOutput{
+			Parameters: []types.ParameterMetadata{
+				{Name: aws.String(servicePath + "/TAGGED")},
+				{Name: aws.String(servicePath + "/UNTAGGED")},
+			},
+		}, nil
+	}
+	ssmMock.MockListTagsForResource = func(ctx context.Context, params *ssm.ListTagsForResourceInput, optFns ...func(*ssm.Options)) (*ssm.ListTagsForResourceOutput, error) {
+		if aws.ToString(params.ResourceId) != servicePath+"/TAGGED" {
+			return &ssm.ListTagsForResourceOutput{}, nil
+		}
+		return &ssm.ListTagsForResourceOutput{TagList: []types.Tag{{Key: aws.String("owner"), Value: aws.String("team-x")}}}, nil
+	}
+
+	ps := parameterstore.New(log, ssmMock, "kms key id")
+
+	tags, err := ps.ReadTags(context.Background(), servicePath)
+	require.NoError(t, err)
+	require.Equal(t, map[string]map[string]string{"TAGGED": {"owner": "team-x"}}, tags)
+}
+
+// TestParameterStoreReadVersions verifies that versions of keys are read
+// without reading their values, and that they change when keys are written.
+func TestParameterStoreReadVersions(t *testing.T) {
+	ctx := context.Background()
+	const servicePath = "/service/env"
+
+	ssmClient := newFakeSSM()
+	ps := parameterstore.New(log, ssmClient, "kms key id")
+	require.NoError(t, ps.WriteKeys(ctx, servicePath, map[string]string{"HOST": "db", "PORT": "5432"}))
+	require.NoError(t, ps.Write(ctx, "/service/env/nested", "USER", "app"))
+	ssmClient.valueReads = 0
+
+	versions, err := ps.ReadVersions(ctx, servicePath)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"HOST": "1", "PORT": "1"}, versions)
+
+	require.NoError(t, ps.Write(ctx, servicePath, "HOST", "new-db"))
+	ssmClient.valueReads = 0
+
+	versions, err = ps.ReadVersions(ctx, servicePath)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"HOST": "2", "PORT": "1"}, versions)
+	require.Zero(t, ssmClient.valueReads)
+}
+
+// fakeSSM is an in-memory stand-in for Parameter Store, enforcing its limit
+// of keys per request.
+type fakeSSM struct {
+	mu         sync.Mutex
+	parameters map[string]types.ParameterMetadata
+	values     map[string]string
+
+	// valueReads counts the requests returning values.
+	valueReads int
+}
+
+var _ parameterstore.SSMClient = &fakeSSM{}
+
+func newFakeSSM() *fakeSSM {
+	return &fakeSSM{
+		parameters: make(map[string]types.ParameterMetadata),
+		values:     make(map[string]string),
+	}
+}
+
+func (f *fakeSSM) PutParameter(ctx context.Context, params *ssm.PutParameterInput, optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.ToString(params.Name)
+	cur, exists := f.parameters[name]
+	if exists && !aws.ToBool(params.Overwrite) {
+		return nil, &smithy.GenericAPIError{Code: "ParameterAlreadyExists"}
+	}
+
+	f.parameters[name] = types.ParameterMetadata{
+		Name:             params.Name,
+		Type:             params.Type,
+		Description:      params.Description,
+		Tier:             params.Tier,
+		KeyId:            params.KeyId,
+		Version:          cur.Version + 1,
+		LastModifiedDate: aws.Time(time.Now()),
+	}
+	f.values[name] = aws.ToString(params.Value)
+	return &ssm.PutParameterOutput{Version: cur.Version + 1}, nil
+}
+
+func (f *fakeSSM) GetParameters(ctx context.Context, params *ssm.GetParametersInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(params.Names) > 10 {
+		return nil, &smithy.GenericAPIError{Code: "ValidationException"}
+	}
+	f.valueReads++
+
+	output := &ssm.GetParametersOutput{}
+	for _, name := range params.Names {
+		if _, exists := f.parameters[name]; !exists {
+			output.InvalidParameters = append(output.InvalidParameters, name)
+			continue
+		}
+		output.Parameters = append(output.Parameters, f.parameter(name))
+	}
+
+	return output, nil
+}
+
+func (f *fakeSSM) GetParametersByPath(ctx context.Context, params *ssm.GetParametersByPathInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersByPathOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.valueReads++
+	names := f.names(func(name string) bool {
+		return path.Dir(name) == aws.ToString(params.Path)
+	})
+
+	output := &ssm.GetParametersByPathOutput{}
+	page, nextToken := paginate(names, aws.ToString(params.NextToken), int(aws.ToInt32(params.MaxResults)))
+	for _, name := range page {
+		output.Parameters = append(output.Parameters, f.parameter(name))
+	}
+	output.NextToken = nextToken
+
+	return output, nil
+}
+
+func (f *fakeSSM) DescribeParameters(ctx context.Context, params *ssm.DescribeParametersInput, optFns ...func(*ssm.Options)) (*ssm.DescribeParametersOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	names := f.names(func(name string) bool {
+		for _, filter := range params.ParameterFilters {
+			matches := false
+			for _, value := range filter.Values {
+				switch aws.ToString(filter.Key) + "/" + aws.ToString(filter.Option) {
+				case "Name/Equals":
+					matches = matches || name == value
+				case "Path/OneLevel":
+					matches = matches || path.Dir(name) == value
+				case "Path/Recursive":
+					matches = matches || strings.HasPrefix(name, strings.TrimSuffix(value, "/")+"/")
+				}
+			}
+			if !matches {
+				return false
+			}
+		}
+		return true
+	})
+
+	output := &ssm.DescribeParametersOutput{}
+	page, nextToken := paginate(names, aws.ToString(params.NextToken), 10)
+	for _, name := range page {
+		output.Parameters = append(output.Parameters, f.parameters[name])
+	}
+	output.NextToken = nextToken
+
+	return output, nil
+}
+
+func (f *fakeSSM) DeleteParameters(ctx context.Context, params *ssm.DeleteParametersInput, optFns ...func(*ssm.Options)) (*ssm.DeleteParametersOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(params.Names) > 10 {
+		return nil, &smithy.GenericAPIError{Code: "ValidationException"}
+	}
+
+	output := &ssm.DeleteParametersOutput{}
+	for _, name := range params.Names {
+		if _, exists := f.parameters[name]; !exists {
+			output.InvalidParameters = append(output.InvalidParameters, name)
+			continue
+		}
+		delete(f.parameters, name)
+		delete(f.values, name)
+		output.DeletedParameters = append(output.DeletedParameters, name)
+	}
+
+	return output, nil
+}
+
+func (f *fakeSSM) AddTagsToResource(ctx context.Context, params *ssm.AddTagsToResourceInput, optFns ...func(*ssm.Options)) (*ssm.AddTagsToResourceOutput, error) {
+	return &ssm.AddTagsToResourceOutput{}, nil
+}
+
+func (f *fakeSSM) ListTagsForResource(ctx context.Context, params *ssm.ListTagsForResourceInput, optFns ...func(*ssm.Options)) (*ssm.ListTagsForResourceOutput, error) {
+	return &ssm.ListTagsForResourceOutput{}, nil
+}
+
+func (f *fakeSSM) parameter(name string) types.Parameter {
+	metadata := f.parameters[name]
+	return types.Parameter{
+		Name:             metadata.Name,
+		Type:             metadata.Type,
+		Value:            aws.String(f.values[name]),
+		Version:          metadata.Version,
+		LastModifiedDate: metadata.LastModifiedDate,
+	}
+}
+
+// names returns the sorted names of parameters matching include.
+func (f *fakeSSM) names(include func(name string) bool) []string {
+	names := []string{}
+	for name := range f.parameters {
+		if include(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// paginate returns the page of names starting at the index given by
+// nextToken, and the token of the next page if there is one.
+func paginate(names []string, nextToken string, maxResults int) ([]string, *string) {
+	start := 0
+	if len(nextToken) > 0 {
+		start, _ = strconv.Atoi(nextToken)
+	}
+	if maxResults == 0 {
+		maxResults = 10
+	}
+
+	end := start + maxResults
+	if end >= len(names) {
+		return names[start:], nil
+	}
+	return names[start:end], aws.String(strconv.Itoa(end))
+}
+
+// TestParameterStore verifies that ParameterStore passes the storage
+// conformance suite.
+func TestParameterStore(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return parameterstore.New(log, newFakeSSM(), "kms key id")
+	})
+}
@@ -0,0 +1,139 @@
+package parameterstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/micvbang/confman-go/pkg/storage"
+)
+
+// maxStandardValueSize is the maximum size in bytes of values of standard
+// parameters. Larger values require the advanced tier.
+const maxStandardValueSize = 4 * 1024
+
+// Types of parameter policies
+const (
+	policyExpiration             = "Expiration"
+	policyExpirationNotification = "ExpirationNotification"
+	policyNoChangeNotification   = "NoChangeNotification"
+)
+
+type parameterPolicy struct {
+	Type       string            `json:"Type"`
+	Version    string            `json:"Version"`
+	Attributes map[string]string `json:"Attributes"`
+}
+
+// parameterTier returns the tier of a parameter with value and options whose
+// current metadata is cur, or "" to use the default tier.
+func parameterTier(value string, options storage.WriteOptions, cur types.ParameterMetadata) string {
+	switch {
+	case len(options.Tier) > 0:
+		return options.Tier
+	case cur.Tier == types.ParameterTierAdvanced, len(value) > maxStandardValueSize, options.HasPolicies():
+		return storage.ParameterTierAdvanced
+	}
+
+	return ""
+}
+
+// parameterPolicies returns the policies given by options as accepted by
+// PutParameter, with expiration relative to now.
+func parameterPolicies(options storage.WriteOptions, now time.Time) (string, error) {
+	policies := []parameterPolicy{}
+
+	if options.ExpiresIn != 0 {
+		policies = append(policies, parameterPolicy{
+			Type:    policyExpiration,
+			Version: "1.0",
+			Attributes: map[string]string{
+				"Timestamp": now.Add(time.Duration(options.ExpiresIn)).UTC().Format(time.RFC3339),
+			},
+		})
+	}
+
+	if options.NotifyBefore != 0 {
+		amount, unit := policyDuration(options.NotifyBefore)
+		policies = append(policies, parameterPolicy{
+			Type:       policyExpirationNotification,
+			Version:    "1.0",
+			Attributes: map[string]string{"Before": amount, "Unit": unit},
+		})
+	}
+
+	if options.NoChangeNotification != 0 {
+		amount, unit := policyDuration(options.NoChangeNotification)
+		policies = append(policies, parameterPolicy{
+			Type:       policyNoChangeNotification,
+			Version:    "1.0",
+			Attributes: map[string]string{"After": amount, "Unit": unit},
+		})
+	}
+
+	bs, err := json.Marshal(policies)
+	return string(bs), err
+}
+
+// policyDuration returns d as an amount of days if possible, and otherwise
+// hours.
+func policyDuration(d storage.Duration) (string, string) {
+	if time.Duration(d)%(24*time.Hour) == 0 {
+		return fmt.Sprint(int64(time.Duration(d) / (24 * time.Hour))), "Days"
+	}
+	return fmt.Sprint(int64(time.Duration(d) / time.Hour)), "Hours"
+}
+
+// policiesChanged returns whether the types of the policies given by options
+// differ from the types of the current policies. Policies of the same types
+// are not considered changed, such that writing them again doesn't move
+// expiration.
+func policiesChanged(options storage.WriteOptions, cur []types.ParameterInlinePolicy) bool {
+	want := map[string]bool{
+		policyExpiration:             options.ExpiresIn != 0,
+		policyExpirationNotification: options.NotifyBefore != 0,
+		policyNoChangeNotification:   options.NoChangeNotification != 0,
+	}
+
+	got := map[string]bool{}
+	for _, policy := range cur {
+		got[aws.ToString(policy.PolicyType)] = true
+	}
+
+	for policyType, wanted := range want {
+		if wanted != got[policyType] {
+			return true
+		}
+	}
+	return false
+}
+
+// formatPolicies returns a summary of policies and their status, e.g.
+// "Expiration 2027-01-17T00:00:00Z (Pending), NoChangeNotification 30 Days
+// (Pending)".
+func formatPolicies(policies []types.ParameterInlinePolicy) string {
+	formatted := make([]string, 0, len(policies))
+	for _, policy := range policies {
+		policyType := aws.ToString(policy.PolicyType)
+
+		var p parameterPolicy
+		_ = json.Unmarshal([]byte(aws.ToString(policy.PolicyText)), &p)
+
+		var details string
+		switch policyType {
+		case policyExpiration:
+			details = p.Attributes["Timestamp"]
+		case policyExpirationNotification:
+			details = fmt.Sprintf("%s %s", p.Attributes["Before"], p.Attributes["Unit"])
+		case policyNoChangeNotification:
+			details = fmt.Sprintf("%s %s", p.Attributes["After"], p.Attributes["Unit"])
+		}
+
+		formatted = append(formatted, fmt.Sprintf("%s %s (%s)", policyType, details, aws.ToString(policy.PolicyStatus)))
+	}
+
+	return strings.Join(formatted, ", ")
+}
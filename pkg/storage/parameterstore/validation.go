@@ -0,0 +1,103 @@
+package parameterstore
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/micvbang/confman-go/pkg/storage"
+)
+
+// Limits of Parameter Store, see
+// https://docs.aws.amazon.com/systems-manager/latest/userguide/sysman-paramstore-su-create.html
+const (
+	// maxParameterNameLength is the maximum length of parameter names.
+	// Parameter Store includes the ARN of parameters in the limit, so names
+	// close to it may still be rejected.
+	maxParameterNameLength = 1011
+
+	// maxParameterDepth is the maximum number of levels of parameter names.
+	maxParameterDepth = 15
+
+	// maxAdvancedValueSize is the maximum size in bytes of values of advanced
+	// parameters.
+	maxAdvancedValueSize = 8 * 1024
+)
+
+var parameterNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.\-/]+$`)
+
+// ValidateKeys returns violations of the rules of Parameter Store for names
+// and values of parameters by writing config with options to servicePath.
+// Values larger than allowed by the standard tier are valid unless the
+// standard tier is given by options, since they are written using the
+// advanced tier.
+func (ps *ParameterStore) ValidateKeys(ctx context.Context, servicePath string, config map[string]string, options map[string]storage.WriteOptions) ([]storage.Violation, error) {
+	return ps.validateKeys(servicePath, config, options), nil
+}
+
+func (ps *ParameterStore) validateKeys(servicePath string, config map[string]string, options map[string]storage.WriteOptions) []storage.Violation {
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	violations := []storage.Violation{}
+	for _, key := range keys {
+		for _, msg := range ps.validateKey(servicePath, key, config[key], options[key]) {
+			violations = append(violations, storage.Violation{ServicePath: servicePath, Key: key, Msg: msg})
+		}
+	}
+
+	return violations
+}
+
+func (ps *ParameterStore) validateKey(servicePath string, key string, value string, options storage.WriteOptions) []string {
+	msgs := []string{}
+
+	name := ps.parameterPath(servicePath, key)
+	switch {
+	case len(key) == 0:
+		msgs = append(msgs, "key must not be empty")
+	case strings.Contains(key, "/"):
+		msgs = append(msgs, "key must not contain \"/\"")
+	}
+
+	if !parameterNameRegexp.MatchString(name) {
+		msgs = append(msgs, fmt.Sprintf("name %q must only contain letters, numbers and the symbols \"_\", \".\", \"-\" and \"/\"", name))
+	}
+
+	lowerName := strings.ToLower(strings.TrimPrefix(name, "/"))
+	if strings.HasPrefix(lowerName, "aws") || strings.HasPrefix(lowerName, "ssm") {
+		msgs = append(msgs, fmt.Sprintf("name %q must not begin with \"aws\" or \"ssm\"", name))
+	}
+
+	if depth := strings.Count(name, "/"); depth > maxParameterDepth {
+		msgs = append(msgs, fmt.Sprintf("name has %d levels, at most %d are allowed", depth, maxParameterDepth))
+	}
+
+	if len(name) > maxParameterNameLength {
+		msgs = append(msgs, fmt.Sprintf("name is %d characters long, at most %d are allowed", len(name), maxParameterNameLength))
+	}
+
+	tier, maxSize := storage.ParameterTierAdvanced, maxAdvancedValueSize
+	if options.Tier == storage.ParameterTierStandard {
+		tier, maxSize = storage.ParameterTierStandard, maxStandardValueSize
+	}
+
+	switch {
+	case len(value) == 0:
+		msgs = append(msgs, "value must not be empty")
+	case len(value) > maxSize:
+		msgs = append(msgs, fmt.Sprintf("value is %d bytes, the %s tier allows at most %d", len(value), tier, maxSize))
+	}
+
+	err := options.Validate()
+	if err != nil {
+		msgs = append(msgs, err.Error())
+	}
+
+	return msgs
+}
@@ -0,0 +1,117 @@
+package parameterstore_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/micvbang/confman-go/pkg/storage"
+	"github.com/micvbang/confman-go/pkg/storage/parameterstore"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParameterStoreValidateKeys verifies that names and values violating
+// the rules of Parameter Store are reported, and that values too large for
+// the standard tier are valid unless it is given.
+func TestParameterStoreValidateKeys(t *testing.T) {
+	tests := map[string]struct {
+		servicePath string
+		key         string
+		value       string
+		options     storage.WriteOptions
+		expected    []string
+	}{
+		"valid": {
+			servicePath: "/service/production",
+			key:         "DB_PASSWORD.v2-old",
+			value:       "hunter2",
+		},
+		"advanced value": {
+			servicePath: "/service/production",
+			key:         "CERTIFICATE",
+			value:       strings.Repeat("x", 8*1024),
+		},
+		"characters": {
+			servicePath: "/service/production",
+			key:         "DB PASSWORD",
+			value:       "hunter2",
+			expected:    []string{`name "/service/production/DB PASSWORD" must only contain letters, numbers and the symbols "_", ".", "-" and "/"`},
+		},
+		"slash in key": {
+			servicePath: "/service/production",
+			key:         "db/password",
+			value:       "hunter2",
+			expected:    []string{`key must not contain "/"`},
+		},
+		"reserved prefix": {
+			servicePath: "/AWS-service/production",
+			key:         "DB_PASSWORD",
+			value:       "hunter2",
+			expected:    []string{`name "/AWS-service/production/DB_PASSWORD" must not begin with "aws" or "ssm"`},
+		},
+		"depth": {
+			servicePath: strings.Repeat("/level", 15),
+			key:         "DB_PASSWORD",
+			value:       "hunter2",
+			expected:    []string{"name has 16 levels, at most 15 are allowed"},
+		},
+		"name length": {
+			servicePath: "/" + strings.Repeat("x", 1000),
+			key:         "DB_PASSWORD",
+			value:       "hunter2",
+			expected:    []string{"name is 1013 characters long, at most 1011 are allowed"},
+		},
+		"empty value": {
+			servicePath: "/service/production",
+			key:         "DB_PASSWORD",
+			expected:    []string{"value must not be empty"},
+		},
+		"value size": {
+			servicePath: "/service/production",
+			key:         "CERTIFICATE",
+			value:       strings.Repeat("x", 8*1024+1),
+			expected:    []string{"value is 8193 bytes, the Advanced tier allows at most 8192"},
+		},
+		"standard value size": {
+			servicePath: "/service/production",
+			key:         "CERTIFICATE",
+			value:       strings.Repeat("x", 4*1024+1),
+			options:     storage.WriteOptions{Tier: storage.ParameterTierStandard},
+			expected:    []string{"value is 4097 bytes, the Standard tier allows at most 4096"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ps := parameterstore.New(log, &parameterstore.MockSSMClient{}, "kms key id")
+
+			violations, err := ps.ValidateKeys(context.Background(), test.servicePath, map[string]string{test.key: test.value}, map[string]storage.WriteOptions{
+				test.key: test.options,
+			})
+			require.NoError(t, err)
+
+			msgs := []string{}
+			for _, violation := range violations {
+				require.Equal(t, test.servicePath, violation.ServicePath)
+				require.Equal(t, test.key, violation.Key)
+				msgs = append(msgs, violation.Msg)
+			}
+			require.ElementsMatch(t, test.expected, msgs)
+		})
+	}
+}
+
+// TestParameterStoreWriteKeysInvalid verifies that nothing is written if any
+// key violates the rules of Parameter Store.
+func TestParameterStoreWriteKeysInvalid(t *testing.T) {
+	ssmMock := &parameterstore.MockSSMClient{}
+	ps := parameterstore.New(log, ssmMock, "kms key id")
+
+	err := ps.WriteKeys(context.Background(), "/service/production", map[string]string{
+		"DB_PASSWORD": "hunter2",
+		"DB HOST":     "db.internal",
+	})
+	require.ErrorIs(t, err, storage.ErrInvalidKeys)
+	require.False(t, ssmMock.GetParametersCalled)
+	require.False(t, ssmMock.PutParameterCalled)
+}
@@ -0,0 +1,222 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/server"
+	"github.com/micvbang/confman-go/pkg/storage"
+)
+
+const defaultTimeout = 30 * time.Second
+
+var ErrRequestFailed = errors.New("request to confman server failed")
+
+// Remote implements storage.Storage by talking to a confman server, i.e.
+// "confman serve".
+type Remote struct {
+	log        logger.Logger
+	httpClient *http.Client
+	baseURL    string
+	token      string
+
+	mu           sync.Mutex
+	metadataKeys []string
+}
+
+var _ storage.Storage = &Remote{}
+
+// New returns a Remote for the confman server at baseURL, e.g.
+// "https://confman.internal:8080", authenticating using the bearer token. If
+// httpClient is nil, a client with a timeout of 30 seconds is used.
+func New(log logger.Logger, httpClient *http.Client, baseURL string, token string) *Remote {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: defaultTimeout}
+	}
+	baseURL = strings.TrimRight(baseURL, "/")
+
+	return &Remote{
+		log: log.
+			WithField("storage_type", "Remote").
+			WithField("url", baseURL),
+		httpClient: httpClient,
+		baseURL:    baseURL,
+		token:      token,
+	}
+}
+
+func (r *Remote) Write(ctx context.Context, servicePath string, key string, value string) error {
+	return r.WriteKeys(ctx, servicePath, map[string]string{key: value})
+}
+
+func (r *Remote) WriteKeys(ctx context.Context, servicePath string, config map[string]string) error {
+	if len(config) == 0 {
+		r.log.Warnf("WriteKeys called with 0 keys")
+		return nil
+	}
+
+	return r.do(ctx, http.MethodPut, server.PathConfig, servicePath, nil, config, nil)
+}
+
+func (r *Remote) Read(ctx context.Context, servicePath string, key string) (value string, _ error) {
+	config, err := r.ReadKeys(ctx, servicePath, []string{key})
+	if err != nil {
+		return "", err
+	}
+
+	return config[key], nil
+}
+
+func (r *Remote) ReadKeys(ctx context.Context, servicePath string, keys []string) (map[string]string, error) {
+	if len(keys) == 0 {
+		r.log.Warnf("ReadKeys called with 0 keys")
+		return nil, nil
+	}
+
+	response := server.ConfigResponse{}
+	query := url.Values{"keys": []string{strings.Join(keys, ",")}}
+	err := r.do(ctx, http.MethodGet, server.PathConfig, servicePath, query, nil, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Config, nil
+}
+
+func (r *Remote) ReadAll(ctx context.Context, servicePath string) (map[string]string, error) {
+	response := server.ConfigResponse{}
+	err := r.do(ctx, http.MethodGet, server.PathConfig, servicePath, nil, nil, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Config == nil {
+		response.Config = map[string]string{}
+	}
+	return response.Config, nil
+}
+
+func (r *Remote) ReadAllMetadata(ctx context.Context, servicePath string) ([]storage.KeyMetadata, error) {
+	response := server.MetadataResponse{}
+	query := url.Values{"reveal": []string{"true"}}
+	err := r.do(ctx, http.MethodGet, server.PathMetadata, servicePath, query, nil, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Keys, nil
+}
+
+func (r *Remote) Delete(ctx context.Context, servicePath string, key string) error {
+	return r.DeleteKeys(ctx, servicePath, []string{key})
+}
+
+func (r *Remote) DeleteKeys(ctx context.Context, servicePath string, keys []string) error {
+	if len(keys) == 0 {
+		r.log.Warnf("DeleteKeys called with 0 keys")
+		return nil
+	}
+
+	query := url.Values{"keys": []string{strings.Join(keys, ",")}}
+	return r.do(ctx, http.MethodDelete, server.PathConfig, servicePath, query, nil, nil)
+}
+
+// MetadataKeys returns the metadata keys of the server's storage. Since
+// MetadataKeys can't return errors, failing to request them is logged and no
+// keys are returned.
+func (r *Remote) MetadataKeys() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.metadataKeys != nil {
+		return r.metadataKeys
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	response := server.MetadataKeysResponse{}
+	err := r.do(ctx, http.MethodGet, server.PathMetadataKeys, "", nil, nil, &response)
+	if err != nil {
+		r.log.Errorf("Failed to read metadata keys: %s", err)
+		return []string{}
+	}
+
+	r.metadataKeys = response.MetadataKeys
+	return r.metadataKeys
+}
+
+func (r *Remote) String() string {
+	return fmt.Sprintf("Remote(%s)", r.baseURL)
+}
+
+// do sends a request to endpoint for servicePath, encoding body and decoding
+// the response into response, if given. Responses with the error code
+// server.ErrorCodeConfigNotFound are returned as storage.ErrConfigNotFound,
+// other errors, e.g. 404 from a proxy, as ErrRequestFailed.
+func (r *Remote) do(ctx context.Context, method string, endpoint string, servicePath string, query url.Values, body interface{}, response interface{}) error {
+	u := r.baseURL + endpoint + (&url.URL{Path: servicePath}).EscapedPath()
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var bodyReader io.Reader
+	if body != nil {
+		bs, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		bodyReader = bytes.NewReader(bs)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, bodyReader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+r.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	r.log.Debugf("%s %s", method, req.URL.Path)
+
+	res, err := r.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrRequestFailed, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		errResponse := server.ErrorResponse{}
+		json.NewDecoder(res.Body).Decode(&errResponse)
+		if len(errResponse.Error) == 0 {
+			errResponse.Error = res.Status
+		}
+
+		if errResponse.Code == server.ErrorCodeConfigNotFound {
+			return fmt.Errorf("%w: %s", storage.ErrConfigNotFound, errResponse.Error)
+		}
+		return fmt.Errorf("%w with status %d: %s", ErrRequestFailed, res.StatusCode, errResponse.Error)
+	}
+
+	if response == nil {
+		return nil
+	}
+
+	err = json.NewDecoder(res.Body).Decode(response)
+	if err != nil {
+		return fmt.Errorf("%w: decoding response: %s", ErrRequestFailed, err)
+	}
+
+	return nil
+}
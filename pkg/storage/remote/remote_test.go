@@ -0,0 +1,83 @@
+package remote_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/micvbang/confman-go/pkg/confman"
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/server"
+	"github.com/micvbang/confman-go/pkg/storage"
+	"github.com/micvbang/confman-go/pkg/storage/memory"
+	"github.com/micvbang/confman-go/pkg/storage/remote"
+	"github.com/micvbang/confman-go/pkg/storage/storagetest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+var log = logger.LogrusWrapper{Logger: logrus.New()}
+
+const testToken = "test-token"
+
+func newTestServer(t *testing.T, rules []server.Rule) *httptest.Server {
+	confman.ChamberCompatible = false
+
+	s, err := server.New(log, memory.New(log), server.Config{
+		Tokens: []server.Token{{Name: "test", Token: testToken, Rules: rules}},
+	})
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+// TestRemote verifies that Remote, backed by a confman server, passes the
+// storage conformance suite.
+func TestRemote(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		ts := newTestServer(t, []server.Rule{{Prefix: "/", Permissions: []string{server.PermissionRead, server.PermissionWrite}}})
+		return remote.New(log, ts.Client(), ts.URL, testToken)
+	})
+}
+
+// TestRemoteErrors verifies that authentication and authorization failures
+// are returned as errors, that only missing configuration is returned as
+// storage.ErrConfigNotFound, and that MetadataKeys are read from the server.
+func TestRemoteErrors(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestServer(t, []server.Rule{{Prefix: "/service", Permissions: []string{server.PermissionRead}}})
+
+	r := remote.New(log, ts.Client(), ts.URL, "invalid-token")
+	_, err := r.ReadAll(ctx, "/service/production")
+	require.ErrorIs(t, err, remote.ErrRequestFailed)
+	require.Contains(t, err.Error(), "401")
+
+	r = remote.New(log, ts.Client(), ts.URL, testToken)
+	err = r.Write(ctx, "/service/production", "KEY", "value")
+	require.ErrorIs(t, err, remote.ErrRequestFailed)
+	require.Contains(t, err.Error(), "403")
+
+	_, err = r.ReadAll(ctx, "/other/production")
+	require.ErrorIs(t, err, remote.ErrRequestFailed)
+	require.NotErrorIs(t, err, storage.ErrConfigNotFound)
+
+	// Responses with status 404 that are not about missing configuration,
+	// e.g. from a misconfigured URL, must not look like missing keys.
+	r = remote.New(log, ts.Client(), ts.URL+"/prefix", testToken)
+	_, err = r.ReadAll(ctx, "/service/production")
+	require.ErrorIs(t, err, remote.ErrRequestFailed)
+	require.NotErrorIs(t, err, storage.ErrConfigNotFound)
+	require.Contains(t, err.Error(), "404")
+
+	r = remote.New(log, ts.Client(), ts.URL, testToken)
+	require.Equal(t, memory.New(log).MetadataKeys(), r.MetadataKeys())
+
+	r = remote.New(log, ts.Client(), "http://127.0.0.1:1", testToken)
+	_, err = r.ReadAll(ctx, "/service/production")
+	require.ErrorIs(t, err, remote.ErrRequestFailed)
+	require.Empty(t, r.MetadataKeys())
+
+}
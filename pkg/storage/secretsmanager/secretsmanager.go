@@ -0,0 +1,267 @@
+package secretsmanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/storage"
+)
+
+// SecretsManager implements storage.Storage using AWS Secrets Manager. Each
+// service path is a secret holding a JSON object of keys and values, such
+// that all keys of a service path are read and written in a single request.
+// Since Secrets Manager versions secrets rather than keys, the version
+// metadata of a key is the version of the secret.
+//
+// NOTE: Secrets Manager doesn't support conditional writes, so concurrent
+// writes to the same service path may overwrite each other.
+type SecretsManager struct {
+	log      logger.Logger
+	client   SecretsManagerClient
+	kmsKeyID string
+}
+
+var _ storage.Storage = &SecretsManager{}
+
+type SecretsManagerClient interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+	CreateSecret(ctx context.Context, params *secretsmanager.CreateSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.CreateSecretOutput, error)
+	PutSecretValue(ctx context.Context, params *secretsmanager.PutSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.PutSecretValueOutput, error)
+}
+
+// New returns a configured instance of SecretsManager. Secrets are created
+// using the KMS key kmsKeyID, or the AWS managed key if it is empty.
+func New(log logger.Logger, client SecretsManagerClient, kmsKeyID string) *SecretsManager {
+	return &SecretsManager{
+		log:      log.WithField("storage_type", "SecretsManager"),
+		client:   client,
+		kmsKeyID: kmsKeyID,
+	}
+}
+
+// secret is the current version of the secret of a service path.
+type secret struct {
+	exists      bool
+	config      map[string]string
+	versionID   string
+	createdDate time.Time
+}
+
+func (sm *SecretsManager) Write(ctx context.Context, servicePath string, key string, value string) error {
+	return sm.WriteKeys(ctx, servicePath, map[string]string{key: value})
+}
+
+func (sm *SecretsManager) WriteKeys(ctx context.Context, servicePath string, config map[string]string) error {
+	if len(config) == 0 {
+		sm.log.Warnf("WriteKeys called with 0 keys")
+		return nil
+	}
+
+	s, err := sm.readSecret(ctx, servicePath)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for key, value := range config {
+		if curValue, exists := s.config[key]; !exists || curValue != value {
+			s.config[key] = value
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	return sm.writeSecret(ctx, servicePath, s)
+}
+
+func (sm *SecretsManager) Read(ctx context.Context, servicePath string, key string) (value string, _ error) {
+	config, err := sm.ReadKeys(ctx, servicePath, []string{key})
+	if err != nil {
+		return "", err
+	}
+
+	return config[key], nil
+}
+
+func (sm *SecretsManager) ReadKeys(ctx context.Context, servicePath string, keys []string) (map[string]string, error) {
+	if len(keys) == 0 {
+		sm.log.Warnf("ReadKeys called with 0 keys")
+		return nil, nil
+	}
+
+	s, err := sm.readSecret(ctx, servicePath)
+	if err != nil {
+		return nil, err
+	}
+
+	config := make(map[string]string, len(keys))
+	for _, key := range keys {
+		value, exists := s.config[key]
+		if !exists {
+			return nil, fmt.Errorf("%w: %s/%s", storage.ErrConfigNotFound, servicePath, key)
+		}
+		config[key] = value
+	}
+
+	return config, nil
+}
+
+func (sm *SecretsManager) ReadAll(ctx context.Context, servicePath string) (map[string]string, error) {
+	s, err := sm.readSecret(ctx, servicePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.config, nil
+}
+
+func (sm *SecretsManager) ReadAllMetadata(ctx context.Context, servicePath string) ([]storage.KeyMetadata, error) {
+	s, err := sm.readSecret(ctx, servicePath)
+	if err != nil {
+		return nil, err
+	}
+
+	keyMetadata := make([]storage.KeyMetadata, 0, len(s.config))
+	for key, value := range s.config {
+		keyMetadata = append(keyMetadata, storage.KeyMetadata{
+			Key:   key,
+			Value: value,
+			Metadata: map[string]string{
+				"version":            s.versionID,
+				"last_modified_date": s.createdDate.Format(time.RFC3339),
+			},
+		})
+	}
+
+	return keyMetadata, nil
+}
+
+func (sm *SecretsManager) Delete(ctx context.Context, servicePath string, key string) error {
+	return sm.DeleteKeys(ctx, servicePath, []string{key})
+}
+
+// DeleteKeys deletes keys by writing a new version of the secret without
+// them. Secrets are never deleted, since Secrets Manager only allows
+// recreating deleted secrets after their recovery window.
+func (sm *SecretsManager) DeleteKeys(ctx context.Context, servicePath string, keys []string) error {
+	if len(keys) == 0 {
+		sm.log.Warnf("DeleteKeys called with 0 keys")
+		return nil
+	}
+
+	s, err := sm.readSecret(ctx, servicePath)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for _, key := range keys {
+		if _, exists := s.config[key]; !exists {
+			sm.log.Warnf("Failed to delete %s/%s: key does not exist", servicePath, key)
+			continue
+		}
+		delete(s.config, key)
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+
+	return sm.writeSecret(ctx, servicePath, s)
+}
+
+func (sm *SecretsManager) MetadataKeys() []string {
+	return []string{
+		"version",
+		"last_modified_date",
+	}
+}
+
+func (sm *SecretsManager) String() string {
+	return "SecretsManager"
+}
+
+// readSecret returns the current version of the secret of servicePath. If
+// the secret doesn't exist, an empty secret is returned.
+func (sm *SecretsManager) readSecret(ctx context.Context, servicePath string) (secret, error) {
+	s := secret{config: map[string]string{}}
+
+	sm.log.Debugf("Attempting to read %s", servicePath)
+
+	output, err := sm.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretName(servicePath)),
+	})
+	if err != nil {
+		var notFoundErr *types.ResourceNotFoundException
+		if errors.As(err, &notFoundErr) {
+			return s, nil
+		}
+		return s, err
+	}
+
+	if output.SecretString == nil {
+		return s, fmt.Errorf("secret of %s is binary, expected JSON object", servicePath)
+	}
+
+	err = json.Unmarshal([]byte(aws.ToString(output.SecretString)), &s.config)
+	if err != nil {
+		return s, fmt.Errorf("secret of %s is not a JSON object of strings: %w", servicePath, err)
+	}
+
+	// A secret of null unmarshals to a nil map
+	if s.config == nil {
+		s.config = map[string]string{}
+	}
+
+	s.exists = true
+	s.versionID = aws.ToString(output.VersionId)
+	s.createdDate = aws.ToTime(output.CreatedDate)
+	return s, nil
+}
+
+// writeSecret writes s.config as the new version of the secret of
+// servicePath, creating the secret if it doesn't exist.
+func (sm *SecretsManager) writeSecret(ctx context.Context, servicePath string, s secret) error {
+	bs, err := json.Marshal(s.config)
+	if err != nil {
+		return err
+	}
+
+	sm.log.Debugf("Attempting to write %s", servicePath)
+
+	if !s.exists {
+		input := &secretsmanager.CreateSecretInput{
+			Name:         aws.String(secretName(servicePath)),
+			SecretString: aws.String(string(bs)),
+		}
+		if len(sm.kmsKeyID) > 0 {
+			input.KmsKeyId = aws.String(sm.kmsKeyID)
+		}
+
+		_, err = sm.client.CreateSecret(ctx, input)
+		return err
+	}
+
+	_, err = sm.client.PutSecretValue(ctx, &secretsmanager.PutSecretValueInput{
+		SecretId:     aws.String(secretName(servicePath)),
+		SecretString: aws.String(string(bs)),
+	})
+	return err
+}
+
+// secretName returns the name of the secret of servicePath, e.g.
+// "email-dispatch/runtime/production" for
+// "/email-dispatch/runtime/production".
+func secretName(servicePath string) string {
+	return strings.TrimPrefix(servicePath, "/")
+}
@@ -0,0 +1,157 @@
+package secretsmanager_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awssecretsmanager "github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/storage"
+	"github.com/micvbang/confman-go/pkg/storage/secretsmanager"
+	"github.com/micvbang/confman-go/pkg/storage/storagetest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+var log = logger.LogrusWrapper{Logger: logrus.New()}
+
+// fakeClient is an in-memory stand-in for Secrets Manager.
+type fakeClient struct {
+	mu       sync.Mutex
+	secrets  map[string]fakeVersion
+	kmsKeys  map[string]string
+	versions int
+	gets     int
+}
+
+type fakeVersion struct {
+	value       string
+	versionID   string
+	createdDate time.Time
+}
+
+var _ secretsmanager.SecretsManagerClient = &fakeClient{}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{
+		secrets: make(map[string]fakeVersion),
+		kmsKeys: make(map[string]string),
+	}
+}
+
+func (f *fakeClient) GetSecretValue(ctx context.Context, params *awssecretsmanager.GetSecretValueInput, optFns ...func(*awssecretsmanager.Options)) (*awssecretsmanager.GetSecretValueOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.gets++
+	version, exists := f.secrets[aws.ToString(params.SecretId)]
+	if !exists {
+		return nil, &types.ResourceNotFoundException{Message: aws.String("Secrets Manager can't find the specified secret.")}
+	}
+
+	return &awssecretsmanager.GetSecretValueOutput{
+		Name:         params.SecretId,
+		SecretString: aws.String(version.value),
+		VersionId:    aws.String(version.versionID),
+		CreatedDate:  aws.Time(version.createdDate),
+	}, nil
+}
+
+func (f *fakeClient) CreateSecret(ctx context.Context, params *awssecretsmanager.CreateSecretInput, optFns ...func(*awssecretsmanager.Options)) (*awssecretsmanager.CreateSecretOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.ToString(params.Name)
+	if _, exists := f.secrets[name]; exists {
+		return nil, &types.ResourceExistsException{Message: aws.String("secret already exists")}
+	}
+
+	f.kmsKeys[name] = aws.ToString(params.KmsKeyId)
+	f.put(name, aws.ToString(params.SecretString))
+	return &awssecretsmanager.CreateSecretOutput{Name: params.Name}, nil
+}
+
+func (f *fakeClient) PutSecretValue(ctx context.Context, params *awssecretsmanager.PutSecretValueInput, optFns ...func(*awssecretsmanager.Options)) (*awssecretsmanager.PutSecretValueOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.ToString(params.SecretId)
+	if _, exists := f.secrets[name]; !exists {
+		return nil, &types.ResourceNotFoundException{Message: aws.String("Secrets Manager can't find the specified secret.")}
+	}
+
+	f.put(name, aws.ToString(params.SecretString))
+	return &awssecretsmanager.PutSecretValueOutput{Name: params.SecretId}, nil
+}
+
+func (f *fakeClient) put(name string, value string) {
+	f.versions++
+	f.secrets[name] = fakeVersion{
+		value:       value,
+		versionID:   fmt.Sprintf("version-%d", f.versions),
+		createdDate: time.Now(),
+	}
+}
+
+// TestSecretsManager verifies that SecretsManager passes the storage
+// conformance suite.
+func TestSecretsManager(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return secretsmanager.New(log, newFakeClient(), "")
+	})
+}
+
+// TestSecretsManagerSingleRequest verifies that all keys of a service path
+// are read in a single request, that secrets are created using the given KMS
+// key, and that service paths are stored as JSON secrets named after the
+// service path.
+func TestSecretsManagerSingleRequest(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeClient()
+	sm := secretsmanager.New(log, client, "alias/confman")
+
+	config := make(map[string]string, 25)
+	keys := make([]string, 0, 25)
+	for i := 0; i < 25; i++ {
+		key := fmt.Sprintf("KEY%02d", i)
+		config[key] = "value"
+		keys = append(keys, key)
+	}
+	require.NoError(t, sm.WriteKeys(ctx, "/service/production", config))
+
+	client.gets = 0
+	_, err := sm.ReadKeys(ctx, "/service/production", keys)
+	require.NoError(t, err)
+	require.Equal(t, 1, client.gets)
+
+	require.Equal(t, "alias/confman", client.kmsKeys["service/production"])
+
+	client.secrets["service/production"] = fakeVersion{value: `{"KEY": 1}`}
+	_, err = sm.ReadAll(ctx, "/service/production")
+	require.Error(t, err)
+}
+
+// TestSecretsManagerNullSecret verifies that a secret holding JSON null is
+// read as an empty configuration, which keys can be written to.
+func TestSecretsManagerNullSecret(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeClient()
+	sm := secretsmanager.New(log, client, "")
+
+	client.put("service/production", "null")
+
+	config, err := sm.ReadAll(ctx, "/service/production")
+	require.NoError(t, err)
+	require.Empty(t, config)
+
+	require.NoError(t, sm.WriteKeys(ctx, "/service/production", map[string]string{"KEY": "value"}))
+
+	config, err = sm.ReadAll(ctx, "/service/production")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"KEY": "value"}, config)
+}
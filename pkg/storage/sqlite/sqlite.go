@@ -0,0 +1,605 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/micvbang/confman-go/pkg/encryption"
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/storage"
+	"github.com/micvbang/go-helpy/mapy"
+
+	// Registers the pure Go "sqlite" driver, which keeps confman free of cgo.
+	_ "modernc.org/sqlite"
+)
+
+var ErrInvalidConfig = errors.New("invalid sqlite config")
+
+// busyTimeout is how long to wait for other processes to release the
+// database before failing.
+const busyTimeout = 5 * time.Second
+
+const schema = `
+CREATE TABLE IF NOT EXISTS changes (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	service_path TEXT NOT NULL,
+	modified_at TEXT NOT NULL,
+	modified_by TEXT NOT NULL,
+	message TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS changes_service_path ON changes (service_path, id);
+
+CREATE TABLE IF NOT EXISTS config (
+	service_path TEXT NOT NULL,
+	key TEXT NOT NULL,
+	value BLOB NOT NULL,
+	version INTEGER NOT NULL,
+	modified_at TEXT NOT NULL,
+	modified_by TEXT NOT NULL,
+	PRIMARY KEY (service_path, key)
+);
+
+CREATE TABLE IF NOT EXISTS config_history (
+	change_id INTEGER NOT NULL REFERENCES changes (id),
+	service_path TEXT NOT NULL,
+	key TEXT NOT NULL,
+	value BLOB, -- NULL when the key was deleted
+	version INTEGER NOT NULL,
+	PRIMARY KEY (service_path, key, version)
+);
+`
+
+// SQLite implements storage.Storage using a SQLite database. Values are
+// encrypted, and every version of every key is kept in the database. Each
+// call to WriteKeys or DeleteKeys is a single transaction, recorded as a
+// change in the history of the service path.
+type SQLite struct {
+	log     logger.Logger
+	db      *sql.DB
+	key     []byte
+	user    string
+	command string
+}
+
+var _ storage.Storage = &SQLite{}
+var _ storage.Historian = &SQLite{}
+var _ storage.Lister = &SQLite{}
+
+// Config configures SQLite.
+type Config struct {
+	// Path is the path of the database, which is created if it doesn't
+	// exist.
+	Path string
+
+	// KeyFile is the path of the key used for encrypting values, which
+	// should be kept apart from the database, such that copies of the
+	// database can't be decrypted. The key is generated if the database holds
+	// no configuration yet.
+	KeyFile string
+
+	// User is recorded as the author of changes, defaulting to the name of
+	// the current user.
+	User string
+
+	// Command is the confman command recorded in the history.
+	Command string
+}
+
+// New returns a configured instance of SQLite.
+func New(log logger.Logger, config Config) (*SQLite, error) {
+	ctx := context.Background()
+
+	if len(config.Path) == 0 {
+		return nil, fmt.Errorf("%w: path must be given", ErrInvalidConfig)
+	}
+	if len(config.KeyFile) == 0 {
+		return nil, fmt.Errorf("%w: key file must be given", ErrInvalidConfig)
+	}
+
+	if len(config.User) == 0 {
+		config.User = "confman"
+		if u, err := user.Current(); err == nil {
+			config.User = u.Username
+		}
+	}
+
+	// SQLite creates databases readable by everyone.
+	f, err := os.OpenFile(config.Path, os.O_RDONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	query := url.Values{}
+	query.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", busyTimeout.Milliseconds()))
+	query.Add("_pragma", "foreign_keys(1)")
+	// Taking the write lock when beginning transactions, rather than on the
+	// first write, prevents deadlocks between concurrent read-modify-writes.
+	query.Add("_txlock", "immediate")
+
+	db, err := sql.Open("sqlite", databaseURI(config.Path, query))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &SQLite{
+		log:     log.WithField("storage_type", "SQLite"),
+		db:      db,
+		user:    config.User,
+		command: config.Command,
+	}
+
+	err = s.init(ctx, config)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *SQLite) init(ctx context.Context, config Config) error {
+	_, err := s.db.ExecContext(ctx, schema)
+	if err != nil {
+		return fmt.Errorf("failed to create schema: %w", err)
+	}
+
+	keyFile := config.KeyFile
+	var numRows int
+	err = s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM config_history").Scan(&numRows)
+	if err != nil {
+		return err
+	}
+
+	// Generating a key for a database that already holds configuration
+	// would make its configuration unreadable.
+	if numRows == 0 {
+		s.key, err = encryption.LoadOrCreateKeyFile(keyFile)
+	} else {
+		s.key, err = encryption.LoadKeyFile(keyFile)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load key: %w", err)
+	}
+
+	return nil
+}
+
+// databaseURI returns the URI of the database at path with the parameters
+// query. The path is escaped, such that paths containing e.g. "?" or "#"
+// aren't taken as parameters.
+func databaseURI(path string, query url.Values) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+
+	// Windows paths, e.g. C:/confman.db, are given as /C:/confman.db.
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	u := url.URL{Scheme: "file", Path: path, RawQuery: query.Encode()}
+	return u.String()
+}
+
+// Close closes the database.
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLite) Write(ctx context.Context, servicePath string, key string, value string) error {
+	return s.WriteKeys(ctx, servicePath, map[string]string{key: value})
+}
+
+func (s *SQLite) WriteKeys(ctx context.Context, servicePath string, config map[string]string) error {
+	if len(config) == 0 {
+		s.log.Warnf("WriteKeys called with 0 keys")
+		return nil
+	}
+
+	message := changeMessage("Write", servicePath, mapy.Keys(config))
+	return s.change(ctx, servicePath, message, func(cur map[string]string) map[string]*string {
+		changes := map[string]*string{}
+		for key, value := range config {
+			if curValue, exists := cur[key]; !exists || curValue != value {
+				value := value
+				changes[key] = &value
+			}
+		}
+		return changes
+	})
+}
+
+func (s *SQLite) Read(ctx context.Context, servicePath string, key string) (value string, _ error) {
+	config, err := s.ReadKeys(ctx, servicePath, []string{key})
+	if err != nil {
+		return "", err
+	}
+
+	return config[key], nil
+}
+
+func (s *SQLite) ReadKeys(ctx context.Context, servicePath string, keys []string) (map[string]string, error) {
+	if len(keys) == 0 {
+		s.log.Warnf("ReadKeys called with 0 keys")
+		return nil, nil
+	}
+
+	cur, err := s.ReadAll(ctx, servicePath)
+	if err != nil {
+		return nil, err
+	}
+
+	config := make(map[string]string, len(keys))
+	for _, key := range keys {
+		value, exists := cur[key]
+		if !exists {
+			return nil, fmt.Errorf("%w: %s/%s", storage.ErrConfigNotFound, servicePath, key)
+		}
+		config[key] = value
+	}
+
+	return config, nil
+}
+
+func (s *SQLite) ReadAll(ctx context.Context, servicePath string) (map[string]string, error) {
+	s.log.Debugf("Attempting to read %s", servicePath)
+
+	return s.readAll(ctx, s.db, servicePath)
+}
+
+func (s *SQLite) ReadAllMetadata(ctx context.Context, servicePath string) ([]storage.KeyMetadata, error) {
+	s.log.Debugf("Attempting to read metadata of %s", servicePath)
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT key, value, version, modified_at, modified_by
+		FROM config
+		WHERE service_path = ?`, servicePath)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keyMetadata := []storage.KeyMetadata{}
+	for rows.Next() {
+		var key, modifiedAt, modifiedBy string
+		var ciphertext []byte
+		var version int64
+		err := rows.Scan(&key, &ciphertext, &version, &modifiedAt, &modifiedBy)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := s.decrypt(servicePath, key, ciphertext)
+		if err != nil {
+			return nil, err
+		}
+
+		keyMetadata = append(keyMetadata, storage.KeyMetadata{
+			Key:   key,
+			Value: value,
+			Metadata: map[string]string{
+				"version":            strconv.FormatInt(version, 10),
+				"last_modified_date": modifiedAt,
+				"last_modified_user": modifiedBy,
+			},
+		})
+	}
+
+	return keyMetadata, rows.Err()
+}
+
+func (s *SQLite) Delete(ctx context.Context, servicePath string, key string) error {
+	return s.DeleteKeys(ctx, servicePath, []string{key})
+}
+
+func (s *SQLite) DeleteKeys(ctx context.Context, servicePath string, keys []string) error {
+	if len(keys) == 0 {
+		s.log.Warnf("DeleteKeys called with 0 keys")
+		return nil
+	}
+
+	message := changeMessage("Delete", servicePath, keys)
+	return s.change(ctx, servicePath, message, func(cur map[string]string) map[string]*string {
+		changes := map[string]*string{}
+		for _, key := range keys {
+			if _, exists := cur[key]; !exists {
+				s.log.Warnf("Failed to delete %s/%s: key does not exist", servicePath, key)
+				continue
+			}
+			changes[key] = nil
+		}
+		return changes
+	})
+}
+
+func (s *SQLite) ListServicePaths(ctx context.Context, prefix string) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT DISTINCT service_path FROM config ORDER BY service_path`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	servicePaths := []string{}
+	for rows.Next() {
+		var servicePath string
+		err := rows.Scan(&servicePath)
+		if err != nil {
+			return nil, err
+		}
+
+		if storage.IsBelow(servicePath, prefix) {
+			servicePaths = append(servicePaths, servicePath)
+		}
+	}
+
+	return servicePaths, rows.Err()
+}
+
+func (s *SQLite) MetadataKeys() []string {
+	return []string{
+		"version",
+		"last_modified_date",
+		"last_modified_user",
+	}
+}
+
+func (s *SQLite) String() string {
+	return "SQLite"
+}
+
+// History returns the changes to servicePath, newest first.
+func (s *SQLite) History(ctx context.Context, servicePath string) ([]storage.Revision, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, modified_by, modified_at, message
+		FROM changes
+		WHERE service_path = ?
+		ORDER BY id DESC`, servicePath)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []storage.Revision{}
+	for rows.Next() {
+		var id int64
+		var modifiedAt string
+		revision := storage.Revision{}
+		err := rows.Scan(&id, &revision.Author, &modifiedAt, &revision.Message)
+		if err != nil {
+			return nil, err
+		}
+
+		revision.ID = strconv.FormatInt(id, 10)
+		revision.Date, err = time.Parse(time.RFC3339, modifiedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, rows.Err()
+}
+
+// Rollback restores the configuration of servicePath to what it was after
+// the change revision. The rollback is recorded as a new change.
+func (s *SQLite) Rollback(ctx context.Context, servicePath string, revision string) error {
+	changeID, err := strconv.ParseInt(revision, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: %s", storage.ErrRevisionNotFound, revision)
+	}
+
+	var exists bool
+	err = s.db.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM changes WHERE id = ? AND service_path = ?)`,
+		changeID, servicePath).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w: %s is not a revision of %s", storage.ErrRevisionNotFound, revision, servicePath)
+	}
+
+	// The value of each key at the revision is its latest version at or
+	// before the revision.
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT h.key, h.value
+		FROM config_history h
+		WHERE h.service_path = ? AND h.version = (
+			SELECT MAX(version) FROM config_history
+			WHERE service_path = h.service_path AND key = h.key AND change_id <= ?
+		)`, servicePath, changeID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	target := map[string]string{}
+	for rows.Next() {
+		var key string
+		var ciphertext []byte
+		err := rows.Scan(&key, &ciphertext)
+		if err != nil {
+			return err
+		}
+
+		// NULL values are deletions.
+		if ciphertext == nil {
+			continue
+		}
+
+		target[key], err = s.decrypt(servicePath, key, ciphertext)
+		if err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	message := fmt.Sprintf("Roll back %s to %s", servicePath, revision)
+	return s.change(ctx, servicePath, message, func(cur map[string]string) map[string]*string {
+		changes := map[string]*string{}
+		for key := range cur {
+			if _, exists := target[key]; !exists {
+				changes[key] = nil
+			}
+		}
+		for key, value := range target {
+			if curValue, exists := cur[key]; !exists || curValue != value {
+				value := value
+				changes[key] = &value
+			}
+		}
+		return changes
+	})
+}
+
+// change applies the changes returned by update to servicePath in a single
+// transaction, recording them as a change with the given message. update is
+// given the current configuration and returns the new value of each changed
+// key, or nil for deleted keys. Nothing is recorded if there are no changes.
+func (s *SQLite) change(ctx context.Context, servicePath string, message string, update func(cur map[string]string) map[string]*string) error {
+	s.log.Debugf("Attempting to write %s", servicePath)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	cur, err := s.readAll(ctx, tx, servicePath)
+	if err != nil {
+		return err
+	}
+
+	changes := update(cur)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	if len(s.command) > 0 {
+		message = fmt.Sprintf("%s\n\nCommand: confman %s", message, s.command)
+	}
+
+	modifiedAt := time.Now().UTC().Format(time.RFC3339)
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO changes (service_path, modified_at, modified_by, message)
+		VALUES (?, ?, ?, ?)`, servicePath, modifiedAt, s.user, message)
+	if err != nil {
+		return err
+	}
+
+	changeID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	for key, value := range changes {
+		// Versions continue across deletions, such that a version always
+		// identifies a single value.
+		var version int64
+		err := tx.QueryRowContext(ctx, `
+			SELECT COALESCE(MAX(version), 0) + 1 FROM config_history
+			WHERE service_path = ? AND key = ?`, servicePath, key).Scan(&version)
+		if err != nil {
+			return err
+		}
+
+		var ciphertext []byte
+		if value == nil {
+			_, err = tx.ExecContext(ctx, `
+				DELETE FROM config WHERE service_path = ? AND key = ?`, servicePath, key)
+		} else {
+			ciphertext, err = encryption.Encrypt(s.key, []byte(*value))
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO config (service_path, key, value, version, modified_at, modified_by)
+				VALUES (?, ?, ?, ?, ?, ?)
+				ON CONFLICT (service_path, key) DO UPDATE SET
+					value = excluded.value,
+					version = excluded.version,
+					modified_at = excluded.modified_at,
+					modified_by = excluded.modified_by`,
+				servicePath, key, ciphertext, version, modifiedAt, s.user)
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO config_history (change_id, service_path, key, value, version)
+			VALUES (?, ?, ?, ?, ?)`, changeID, servicePath, key, ciphertext, version)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func (s *SQLite) readAll(ctx context.Context, q querier, servicePath string) (map[string]string, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT key, value FROM config WHERE service_path = ?`, servicePath)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	config := map[string]string{}
+	for rows.Next() {
+		var key string
+		var ciphertext []byte
+		err := rows.Scan(&key, &ciphertext)
+		if err != nil {
+			return nil, err
+		}
+
+		config[key], err = s.decrypt(servicePath, key, ciphertext)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return config, rows.Err()
+}
+
+func (s *SQLite) decrypt(servicePath string, key string, ciphertext []byte) (string, error) {
+	plaintext, err := encryption.Decrypt(s.key, ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("%s/%s: %w", servicePath, key, err)
+	}
+
+	return string(plaintext), nil
+}
+
+// changeMessage returns the message of a change to keys of servicePath.
+// Values are never part of messages.
+func changeMessage(action string, servicePath string, keys []string) string {
+	keys = append([]string{}, keys...)
+	sort.Strings(keys)
+	return fmt.Sprintf("%s %s: %s", action, servicePath, strings.Join(keys, ", "))
+}
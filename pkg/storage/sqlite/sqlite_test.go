@@ -0,0 +1,196 @@
+package sqlite_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/storage"
+	"github.com/micvbang/confman-go/pkg/storage/sqlite"
+	"github.com/micvbang/confman-go/pkg/storage/storagetest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSQLite verifies that SQLite passes the storage conformance suite.
+func TestSQLite(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return newSQLite(t, newConfig(t))
+	})
+}
+
+// TestSQLiteHistoryRollback verifies that each WriteKeys and DeleteKeys is
+// recorded as a change, that key versions continue across deletions, and
+// that Rollback restores the configuration of a change as a new change.
+func TestSQLiteHistoryRollback(t *testing.T) {
+	ctx := context.Background()
+	servicePath := "/email-dispatch/runtime/production"
+	config := newConfig(t)
+	config.User = "jane"
+	config.Command = "write"
+	s := newSQLite(t, config)
+
+	require.NoError(t, s.WriteKeys(ctx, servicePath, map[string]string{"DB_HOST": "localhost", "DB_USER": "user"}))
+	require.NoError(t, s.Write(ctx, servicePath, "DB_HOST", "db.internal"))
+	require.NoError(t, s.Delete(ctx, servicePath, "DB_USER"))
+
+	// Writing unchanged values is not a change.
+	require.NoError(t, s.Write(ctx, servicePath, "DB_HOST", "db.internal"))
+
+	revisions, err := s.History(ctx, servicePath)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(revisions))
+
+	expectedMessages := []string{
+		"Delete /email-dispatch/runtime/production: DB_USER",
+		"Write /email-dispatch/runtime/production: DB_HOST",
+		"Write /email-dispatch/runtime/production: DB_HOST, DB_USER",
+	}
+	for i, revision := range revisions {
+		require.Equal(t, expectedMessages[i]+"\n\nCommand: confman write", revision.Message)
+		require.Equal(t, "jane", revision.Author)
+		require.False(t, revision.Date.IsZero())
+	}
+
+	require.NoError(t, s.Rollback(ctx, servicePath, revisions[2].ID))
+
+	metadata, err := s.ReadAllMetadata(ctx, servicePath)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(metadata))
+
+	expectedVersions := map[string]string{"DB_HOST": "3", "DB_USER": "3"}
+	for _, km := range metadata {
+		require.Equal(t, expectedVersions[km.Key], km.Metadata["version"], km.Key)
+		require.Equal(t, "jane", km.Metadata["last_modified_user"])
+	}
+
+	values, err := s.ReadAll(ctx, servicePath)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"DB_HOST": "localhost", "DB_USER": "user"}, values)
+
+	revisions, err = s.History(ctx, servicePath)
+	require.NoError(t, err)
+	require.Equal(t, 4, len(revisions))
+	require.True(t, strings.HasPrefix(revisions[0].Message, "Roll back /email-dispatch/runtime/production to "))
+
+	err = s.Rollback(ctx, "/other/service", revisions[0].ID)
+	require.ErrorIs(t, err, storage.ErrRevisionNotFound)
+
+	err = s.Rollback(ctx, servicePath, "not-a-revision")
+	require.ErrorIs(t, err, storage.ErrRevisionNotFound)
+}
+
+// TestSQLiteEncrypted verifies that values are not stored in plaintext, that
+// a key file must be given, and that a database holding configuration
+// requires its key rather than generating a new one.
+func TestSQLiteEncrypted(t *testing.T) {
+	ctx := context.Background()
+	config := newConfig(t)
+	path := config.Path
+
+	_, err := sqlite.New(newLogger(), sqlite.Config{Path: path})
+	require.ErrorIs(t, err, sqlite.ErrInvalidConfig)
+
+	s := newSQLite(t, config)
+
+	require.NoError(t, s.Write(ctx, "/service/production", "PASSWORD", "hunter2"))
+	require.NoError(t, s.Close())
+
+	bs, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NotContains(t, string(bs), "hunter2")
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// Using the same database with the same key file works.
+	s = newSQLite(t, config)
+	value, err := s.Read(ctx, "/service/production", "PASSWORD")
+	require.NoError(t, err)
+	require.Equal(t, "hunter2", value)
+
+	// A missing key file is not generated.
+	_, err = sqlite.New(newLogger(), sqlite.Config{Path: path, KeyFile: filepath.Join(t.TempDir(), "key")})
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+// TestSQLiteConcurrentWrites verifies that concurrent WriteKeys from
+// separate instances sharing a database don't lose writes.
+func TestSQLiteConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	config := newConfig(t)
+	servicePath := "/service/production"
+
+	// Creates the key before the instances race for it.
+	newSQLite(t, config)
+
+	const numWriters = 4
+	const numWrites = 10
+
+	wg := sync.WaitGroup{}
+	errs := make(chan error, numWriters*numWrites)
+	for i := 0; i < numWriters; i++ {
+		s := newSQLite(t, config)
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < numWrites; j++ {
+				errs <- s.Write(ctx, servicePath, fmt.Sprintf("KEY_%d_%d", i, j), "value")
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	s := newSQLite(t, config)
+	values, err := s.ReadAll(ctx, servicePath)
+	require.NoError(t, err)
+	require.Equal(t, numWriters*numWrites, len(values))
+
+	revisions, err := s.History(ctx, servicePath)
+	require.NoError(t, err)
+	require.Equal(t, numWriters*numWrites, len(revisions))
+}
+
+// TestSQLitePath verifies that databases can be stored at paths containing
+// characters that have a meaning in URIs.
+func TestSQLitePath(t *testing.T) {
+	ctx := context.Background()
+	config := newConfig(t)
+	config.Path = filepath.Join(t.TempDir(), "conf?man#1 db")
+
+	s := newSQLite(t, config)
+	require.NoError(t, s.Write(ctx, "/service/production", "KEY", "value"))
+	require.FileExists(t, config.Path)
+}
+
+// newConfig returns the config of a new database, with its key file in
+// another directory.
+func newConfig(t *testing.T) sqlite.Config {
+	return sqlite.Config{
+		Path:    filepath.Join(t.TempDir(), "confman.db"),
+		KeyFile: filepath.Join(t.TempDir(), "confman.key"),
+	}
+}
+
+func newSQLite(t *testing.T, config sqlite.Config) *sqlite.SQLite {
+	s, err := sqlite.New(newLogger(), config)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func newLogger() logger.Logger {
+	return logger.LogrusWrapper{Logger: logrus.New()}
+}
@@ -2,6 +2,8 @@ package storage
 
 import (
 	"context"
+	"strings"
+	"time"
 )
 
 //go:generate mockery -inpkg -name Storage -case=underscore
@@ -22,10 +24,86 @@ type Storage interface {
 
 	MetadataKeys() []string
 
-	// History?
 	String() string
 }
 
+// Historian is implemented by storage drivers that keep the history of
+// changes to service paths.
+type Historian interface {
+	// History returns the revisions of servicePath, newest first.
+	History(ctx context.Context, servicePath string) ([]Revision, error)
+
+	// Rollback restores the configuration of servicePath to what it was at
+	// revision, recording the rollback as a new revision.
+	Rollback(ctx context.Context, servicePath string, revision string) error
+}
+
+// Lister is implemented by storage drivers that can list service paths.
+type Lister interface {
+	// ListServicePaths returns the service paths holding configuration that
+	// are either prefix or below it, sorted.
+	ListServicePaths(ctx context.Context, prefix string) ([]string, error)
+}
+
+// Rekeyer is implemented by storage that encrypts values, e.g. Encrypting and
+// ParameterStore.
+type Rekeyer interface {
+	// Rekey re-encrypts the values of servicePath that are not encrypted
+	// using the key currently configured for it, returning the number of
+	// values re-encrypted.
+	Rekey(ctx context.Context, servicePath string) (int, error)
+}
+
+// Versioner is implemented by storage drivers that can read the versions of
+// keys without reading their values, e.g. ParameterStore.
+type Versioner interface {
+	// ReadVersions returns a string identifying the version of each key of
+	// servicePath, which changes whenever the value of the key is written.
+	ReadVersions(ctx context.Context, servicePath string) (map[string]string, error)
+}
+
+// Wrapper is implemented by storage decorators, e.g. ChamberCompatibility.
+type Wrapper interface {
+	// Unwrap returns the decorated storage.
+	Unwrap() Storage
+}
+
+// Find returns the first storage implementing T in the chain of decorators
+// starting at s, such that optional interfaces like Historian can be used
+// through decorators.
+func Find[T any](s Storage) (T, bool) {
+	for s != nil {
+		if t, ok := s.(T); ok {
+			return t, true
+		}
+
+		w, ok := s.(Wrapper)
+		if !ok {
+			break
+		}
+		s = w.Unwrap()
+	}
+
+	var zero T
+	return zero, false
+}
+
+// IsBelow returns whether servicePath is prefix or below it, comparing whole
+// path segments, such that "/service/dev" is below "/service" but
+// "/service-other" is not.
+func IsBelow(servicePath string, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return servicePath == prefix || prefix == "" || strings.HasPrefix(servicePath, prefix+"/")
+}
+
+// Revision is a change to the configuration of a service path.
+type Revision struct {
+	ID      string    `json:"id"`
+	Author  string    `json:"author"`
+	Date    time.Time `json:"date"`
+	Message string    `json:"message"`
+}
+
 type KeyMetadata struct {
 	Key      string            `json:"key"`
 	Value    string            `json:"value"`
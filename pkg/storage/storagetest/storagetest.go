@@ -0,0 +1,251 @@
+// Package storagetest provides a conformance suite for storage.Storage
+// implementations, verifying the behavior that confman relies on.
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/micvbang/confman-go/pkg/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// Run runs the conformance suite against storages returned by newStorage.
+// Each test calls newStorage once and uses service paths unique to the test,
+// such that storages may be shared between tests.
+func Run(t *testing.T, newStorage func(t *testing.T) storage.Storage) {
+	tests := map[string]func(t *testing.T, s storage.Storage, servicePath string){
+		"WriteRead":               testWriteRead,
+		"WriteKeysReadKeys":       testWriteKeysReadKeys,
+		"ReadNotFound":            testReadNotFound,
+		"ReadAll":                 testReadAll,
+		"ReadAllEmpty":            testReadAllEmpty,
+		"ReadAllNotRecursive":     testReadAllNotRecursive,
+		"ReadAllMetadata":         testReadAllMetadata,
+		"MetadataVersionChanges":  testMetadataVersionChanges,
+		"Delete":                  testDelete,
+		"DeleteKeysNotFound":      testDeleteKeysNotFound,
+		"ManyKeys":                testManyKeys,
+		"ServicePathsIndependent": testServicePathsIndependent,
+		"ListServicePaths":        testListServicePaths,
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			servicePath := fmt.Sprintf("/storagetest/%s/%d", name, time.Now().UnixNano())
+			test(t, newStorage(t), servicePath)
+		})
+	}
+}
+
+func testWriteRead(t *testing.T, s storage.Storage, servicePath string) {
+	ctx := context.Background()
+
+	require.NoError(t, s.Write(ctx, servicePath, "KEY", "value"))
+	value, err := s.Read(ctx, servicePath, "KEY")
+	require.NoError(t, err)
+	require.Equal(t, "value", value)
+
+	require.NoError(t, s.Write(ctx, servicePath, "KEY", "new value"))
+	value, err = s.Read(ctx, servicePath, "KEY")
+	require.NoError(t, err)
+	require.Equal(t, "new value", value)
+}
+
+func testWriteKeysReadKeys(t *testing.T, s storage.Storage, servicePath string) {
+	ctx := context.Background()
+	config := map[string]string{
+		"KEY1": "value1",
+		"KEY2": "value with spaces and symbols: ,=&?/",
+		"KEY3": "multi\nline",
+	}
+
+	require.NoError(t, s.WriteKeys(ctx, servicePath, config))
+	got, err := s.ReadKeys(ctx, servicePath, []string{"KEY1", "KEY2", "KEY3"})
+	require.NoError(t, err)
+	require.Equal(t, config, got)
+
+	got, err = s.ReadKeys(ctx, servicePath, []string{"KEY2"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"KEY2": config["KEY2"]}, got)
+}
+
+func testReadNotFound(t *testing.T, s storage.Storage, servicePath string) {
+	ctx := context.Background()
+
+	_, err := s.Read(ctx, servicePath, "MISSING")
+	require.ErrorIs(t, err, storage.ErrConfigNotFound)
+
+	require.NoError(t, s.Write(ctx, servicePath, "KEY", "value"))
+	_, err = s.ReadKeys(ctx, servicePath, []string{"KEY", "MISSING"})
+	require.ErrorIs(t, err, storage.ErrConfigNotFound)
+}
+
+func testReadAll(t *testing.T, s storage.Storage, servicePath string) {
+	ctx := context.Background()
+	config := map[string]string{"KEY1": "value1", "KEY2": "value2"}
+
+	require.NoError(t, s.WriteKeys(ctx, servicePath, config))
+	got, err := s.ReadAll(ctx, servicePath)
+	require.NoError(t, err)
+	require.Equal(t, config, got)
+}
+
+func testReadAllEmpty(t *testing.T, s storage.Storage, servicePath string) {
+	got, err := s.ReadAll(context.Background(), servicePath)
+	require.NoError(t, err)
+	require.Empty(t, got)
+
+	keyMetadata, err := s.ReadAllMetadata(context.Background(), servicePath)
+	require.NoError(t, err)
+	require.Empty(t, keyMetadata)
+}
+
+func testReadAllNotRecursive(t *testing.T, s storage.Storage, servicePath string) {
+	ctx := context.Background()
+
+	require.NoError(t, s.Write(ctx, servicePath, "KEY", "value"))
+	require.NoError(t, s.Write(ctx, servicePath+"/child", "CHILD_KEY", "value"))
+
+	got, err := s.ReadAll(ctx, servicePath)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"KEY": "value"}, got)
+}
+
+func testReadAllMetadata(t *testing.T, s storage.Storage, servicePath string) {
+	ctx := context.Background()
+	config := map[string]string{"KEY1": "value1", "KEY2": "value2"}
+
+	require.NoError(t, s.WriteKeys(ctx, servicePath, config))
+	keyMetadata, err := s.ReadAllMetadata(ctx, servicePath)
+	require.NoError(t, err)
+
+	sort.Slice(keyMetadata, func(i, j int) bool {
+		return keyMetadata[i].Key < keyMetadata[j].Key
+	})
+	require.Equal(t, 2, len(keyMetadata))
+
+	for i, key := range []string{"KEY1", "KEY2"} {
+		require.Equal(t, key, keyMetadata[i].Key)
+		require.Equal(t, config[key], keyMetadata[i].Value)
+		for _, metadataKey := range s.MetadataKeys() {
+			require.Contains(t, keyMetadata[i].Metadata, metadataKey)
+		}
+	}
+}
+
+// testMetadataVersionChanges verifies that the metadata of a key changes when
+// its value changes, which is required to detect changes, e.g. by
+// client.Watcher.
+func testMetadataVersionChanges(t *testing.T, s storage.Storage, servicePath string) {
+	ctx := context.Background()
+
+	require.NoError(t, s.Write(ctx, servicePath, "KEY", "value"))
+	before, err := s.ReadAllMetadata(ctx, servicePath)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Write(ctx, servicePath, "KEY", "new value"))
+	after, err := s.ReadAllMetadata(ctx, servicePath)
+	require.NoError(t, err)
+
+	require.Equal(t, 1, len(before))
+	require.Equal(t, 1, len(after))
+	require.NotEqual(t, before[0].Metadata, after[0].Metadata)
+}
+
+func testDelete(t *testing.T, s storage.Storage, servicePath string) {
+	ctx := context.Background()
+
+	require.NoError(t, s.WriteKeys(ctx, servicePath, map[string]string{"KEY1": "value1", "KEY2": "value2", "KEY3": "value3"}))
+
+	require.NoError(t, s.Delete(ctx, servicePath, "KEY1"))
+	require.NoError(t, s.DeleteKeys(ctx, servicePath, []string{"KEY2"}))
+
+	got, err := s.ReadAll(ctx, servicePath)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"KEY3": "value3"}, got)
+
+	_, err = s.Read(ctx, servicePath, "KEY1")
+	require.ErrorIs(t, err, storage.ErrConfigNotFound)
+}
+
+func testDeleteKeysNotFound(t *testing.T, s storage.Storage, servicePath string) {
+	ctx := context.Background()
+
+	require.NoError(t, s.Write(ctx, servicePath, "KEY", "value"))
+	require.NoError(t, s.DeleteKeys(ctx, servicePath, []string{"KEY", "MISSING"}))
+
+	got, err := s.ReadAll(ctx, servicePath)
+	require.NoError(t, err)
+	require.Empty(t, got)
+}
+
+// testManyKeys verifies that more keys than Parameter Store allows per request
+// can be written, read and deleted at once.
+func testManyKeys(t *testing.T, s storage.Storage, servicePath string) {
+	ctx := context.Background()
+
+	config := make(map[string]string, 25)
+	keys := make([]string, 0, 25)
+	for i := 0; i < 25; i++ {
+		key := fmt.Sprintf("KEY%02d", i)
+		config[key] = fmt.Sprintf("value%d", i)
+		keys = append(keys, key)
+	}
+
+	require.NoError(t, s.WriteKeys(ctx, servicePath, config))
+	got, err := s.ReadKeys(ctx, servicePath, keys)
+	require.NoError(t, err)
+	require.Equal(t, config, got)
+
+	require.NoError(t, s.DeleteKeys(ctx, servicePath, keys))
+	got, err = s.ReadAll(ctx, servicePath)
+	require.NoError(t, err)
+	require.Empty(t, got)
+}
+
+func testServicePathsIndependent(t *testing.T, s storage.Storage, servicePath string) {
+	ctx := context.Background()
+
+	require.NoError(t, s.Write(ctx, servicePath+"/a", "KEY", "a"))
+	require.NoError(t, s.Write(ctx, servicePath+"/b", "KEY", "b"))
+	require.NoError(t, s.Delete(ctx, servicePath+"/a", "KEY"))
+
+	value, err := s.Read(ctx, servicePath+"/b", "KEY")
+	require.NoError(t, err)
+	require.Equal(t, "b", value)
+}
+
+// testListServicePaths verifies ListServicePaths of storage implementing
+// storage.Lister.
+func testListServicePaths(t *testing.T, s storage.Storage, servicePath string) {
+	lister, ok := s.(storage.Lister)
+	if !ok {
+		t.Skipf("%s does not implement storage.Lister", s)
+	}
+
+	ctx := context.Background()
+	nested := servicePath + "/nested/deeper"
+	other := servicePath + "-other"
+
+	for _, sp := range []string{servicePath, nested, other} {
+		require.NoError(t, s.Write(ctx, sp, "KEY", "value"))
+	}
+
+	got, err := lister.ListServicePaths(ctx, servicePath)
+	require.NoError(t, err)
+	require.Equal(t, []string{servicePath, nested}, got)
+
+	got, err = lister.ListServicePaths(ctx, servicePath+"/")
+	require.NoError(t, err)
+	require.Equal(t, []string{servicePath, nested}, got)
+
+	require.NoError(t, s.Delete(ctx, nested, "KEY"))
+	got, err = lister.ListServicePaths(ctx, servicePath)
+	require.NoError(t, err)
+	require.Equal(t, []string{servicePath}, got)
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+var ErrInvalidKeys = errors.New("keys can't be written to storage")
+
+// Violation describes a key that can't be written to storage, e.g. because
+// its name has characters that the storage doesn't allow.
+type Violation struct {
+	ServicePath string `json:"service_path" yaml:"service_path"`
+	Key         string `json:"key" yaml:"key"`
+	Msg         string `json:"msg" yaml:"msg"`
+}
+
+func (v Violation) Error() string {
+	return fmt.Sprintf("%s: %s", path.Join(v.ServicePath, v.Key), v.Msg)
+}
+
+// KeyValidator is implemented by storage with rules for service paths, keys
+// or values, and by decorators forwarding validation to the storage they
+// decorate.
+type KeyValidator interface {
+	// ValidateKeys returns all violations of the rules of the storage by
+	// writing config with options to servicePath.
+	ValidateKeys(ctx context.Context, servicePath string, config map[string]string, options map[string]WriteOptions) ([]Violation, error)
+}
+
+// ValidateKeys returns the violations of the rules of s by writing config
+// with options to servicePath. Storage that doesn't implement KeyValidator
+// has no violations.
+func ValidateKeys(ctx context.Context, s Storage, servicePath string, config map[string]string, options map[string]WriteOptions) ([]Violation, error) {
+	kv, ok := s.(KeyValidator)
+	if !ok {
+		return nil, nil
+	}
+
+	return kv.ValidateKeys(ctx, servicePath, config, options)
+}
+
+// ViolationsError returns an error wrapping ErrInvalidKeys and listing
+// violations, or nil if there are none.
+func ViolationsError(violations []Violation) error {
+	if len(violations) == 0 {
+		return nil
+	}
+
+	msgs := make([]string, 0, len(violations))
+	for _, violation := range violations {
+		msgs = append(msgs, violation.Error())
+	}
+
+	return fmt.Errorf("%w: %s", ErrInvalidKeys, strings.Join(msgs, "; "))
+}
@@ -0,0 +1,69 @@
+package storage_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/micvbang/confman-go/pkg/storage"
+	"github.com/micvbang/confman-go/pkg/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+// TestValidateKeys verifies that decorators forward validation to the
+// storage they decorate, that ChamberCompatibility returns violations of keys
+// as given, that Encrypting validates values as encrypted, and that storage
+// without rules has no violations.
+func TestValidateKeys(t *testing.T) {
+	ctx := context.Background()
+	log := newLogger()
+	servicePath := "/service/production"
+
+	base := &keyValidator{Storage: memory.New(log)}
+	s := storage.NewChamberCompatibility(log, storage.NewEncrypting(log, base, newKeyProvider(t)))
+
+	violations, err := storage.ValidateKeys(ctx, s, servicePath, map[string]string{"DB_PASSWORD": "hunter2"}, map[string]storage.WriteOptions{
+		"DB_PASSWORD": {Type: storage.ParameterTypeSecureString},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []storage.Violation{{ServicePath: servicePath, Key: "DB_PASSWORD", Msg: "invalid"}}, violations)
+
+	require.Equal(t, map[string]storage.WriteOptions{"db_password": {Type: storage.ParameterTypeSecureString}}, base.options)
+	require.True(t, strings.HasPrefix(base.config["db_password"], "confman:enc:v1:"))
+
+	violations, err = storage.ValidateKeys(ctx, memory.New(log), servicePath, map[string]string{"DB_PASSWORD": "hunter2"}, nil)
+	require.NoError(t, err)
+	require.Empty(t, violations)
+}
+
+// TestViolationsError verifies that ViolationsError lists all violations,
+// and returns nil if there are none.
+func TestViolationsError(t *testing.T) {
+	require.NoError(t, storage.ViolationsError(nil))
+
+	err := storage.ViolationsError([]storage.Violation{
+		{ServicePath: "/service", Key: "A", Msg: "first"},
+		{ServicePath: "/service", Key: "B", Msg: "second"},
+	})
+	require.ErrorIs(t, err, storage.ErrInvalidKeys)
+	require.Contains(t, err.Error(), "/service/A: first; /service/B: second")
+}
+
+// keyValidator records the arguments of the last call to ValidateKeys, and
+// returns a violation of every key.
+type keyValidator struct {
+	storage.Storage
+	config  map[string]string
+	options map[string]storage.WriteOptions
+}
+
+func (v *keyValidator) ValidateKeys(ctx context.Context, servicePath string, config map[string]string, options map[string]storage.WriteOptions) ([]storage.Violation, error) {
+	v.config = config
+	v.options = options
+
+	violations := []storage.Violation{}
+	for key := range config {
+		violations = append(violations, storage.Violation{ServicePath: servicePath, Key: key, Msg: "invalid"})
+	}
+	return violations, nil
+}
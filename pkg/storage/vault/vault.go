@@ -0,0 +1,457 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/storage"
+)
+
+const (
+	defaultMount        = "secret"
+	defaultAppRoleMount = "approle"
+	defaultTimeout      = 30 * time.Second
+
+	// maxCASAttempts is the number of times a read-modify-write of a secret
+	// is attempted when the secret is modified concurrently.
+	maxCASAttempts = 5
+)
+
+var (
+	ErrInvalidConfig = errors.New("invalid vault config")
+	ErrRequestFailed = errors.New("request to vault failed")
+
+	errCASMismatch = errors.New("check-and-set mismatch")
+)
+
+// Config configures the connection to Vault. Either Token or RoleID and
+// SecretID must be given.
+type Config struct {
+	// Address of Vault, e.g. "https://vault.internal:8200".
+	Address string
+
+	// Mount is the mount path of the KV v2 secrets engine. Defaults to
+	// "secret".
+	Mount string
+
+	// Namespace is the Vault Enterprise namespace, if any.
+	Namespace string
+
+	Token string
+
+	// RoleID and SecretID are used to log in using AppRole, mounted at
+	// AppRoleMount (defaults to "approle").
+	RoleID       string
+	SecretID     string
+	AppRoleMount string
+}
+
+// Vault implements storage.Storage using the KV v2 secrets engine of
+// HashiCorp Vault. Each service path is a secret, and each key is a field of
+// the secret. Since Vault versions secrets rather than fields, the version
+// metadata of a key is the version of the secret.
+type Vault struct {
+	log        logger.Logger
+	httpClient *http.Client
+	config     Config
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+var _ storage.Storage = &Vault{}
+
+// New returns a Vault storage. If httpClient is nil, a client with a timeout
+// of 30 seconds is used.
+func New(log logger.Logger, httpClient *http.Client, config Config) (*Vault, error) {
+	if len(config.Address) == 0 {
+		return nil, fmt.Errorf("%w: address must be given", ErrInvalidConfig)
+	}
+	if len(config.Token) == 0 && (len(config.RoleID) == 0 || len(config.SecretID) == 0) {
+		return nil, fmt.Errorf("%w: token or role ID and secret ID must be given", ErrInvalidConfig)
+	}
+
+	if len(config.Mount) == 0 {
+		config.Mount = defaultMount
+	}
+	if len(config.AppRoleMount) == 0 {
+		config.AppRoleMount = defaultAppRoleMount
+	}
+	config.Address = strings.TrimRight(config.Address, "/")
+	config.Mount = strings.Trim(config.Mount, "/")
+
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: defaultTimeout}
+	}
+
+	return &Vault{
+		log: log.
+			WithField("storage_type", "Vault").
+			WithField("mount", config.Mount),
+		httpClient: httpClient,
+		config:     config,
+		token:      config.Token,
+	}, nil
+}
+
+// secret is a version of a KV v2 secret.
+type secret struct {
+	Data     map[string]interface{} `json:"data"`
+	Metadata struct {
+		CreatedTime  time.Time `json:"created_time"`
+		DeletionTime string    `json:"deletion_time"`
+		Destroyed    bool      `json:"destroyed"`
+		Version      int64     `json:"version"`
+	} `json:"metadata"`
+}
+
+func (v *Vault) Write(ctx context.Context, servicePath string, key string, value string) error {
+	return v.WriteKeys(ctx, servicePath, map[string]string{key: value})
+}
+
+func (v *Vault) WriteKeys(ctx context.Context, servicePath string, config map[string]string) error {
+	if len(config) == 0 {
+		v.log.Warnf("WriteKeys called with 0 keys")
+		return nil
+	}
+
+	return v.modify(ctx, servicePath, func(current map[string]string) bool {
+		changed := false
+		for key, value := range config {
+			if curValue, exists := current[key]; !exists || curValue != value {
+				current[key] = value
+				changed = true
+			}
+		}
+		return changed
+	})
+}
+
+func (v *Vault) Read(ctx context.Context, servicePath string, key string) (value string, _ error) {
+	config, err := v.ReadKeys(ctx, servicePath, []string{key})
+	if err != nil {
+		return "", err
+	}
+
+	return config[key], nil
+}
+
+func (v *Vault) ReadKeys(ctx context.Context, servicePath string, keys []string) (map[string]string, error) {
+	if len(keys) == 0 {
+		v.log.Warnf("ReadKeys called with 0 keys")
+		return nil, nil
+	}
+
+	current, err := v.ReadAll(ctx, servicePath)
+	if err != nil {
+		return nil, err
+	}
+
+	config := make(map[string]string, len(keys))
+	for _, key := range keys {
+		value, exists := current[key]
+		if !exists {
+			return nil, fmt.Errorf("%w: %s/%s", storage.ErrConfigNotFound, servicePath, key)
+		}
+		config[key] = value
+	}
+
+	return config, nil
+}
+
+func (v *Vault) ReadAll(ctx context.Context, servicePath string) (map[string]string, error) {
+	s, err := v.readSecret(ctx, servicePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return secretConfig(s), nil
+}
+
+func (v *Vault) ReadAllMetadata(ctx context.Context, servicePath string) ([]storage.KeyMetadata, error) {
+	s, err := v.readSecret(ctx, servicePath)
+	if err != nil {
+		return nil, err
+	}
+
+	config := secretConfig(s)
+	keyMetadata := make([]storage.KeyMetadata, 0, len(config))
+	for key, value := range config {
+		keyMetadata = append(keyMetadata, storage.KeyMetadata{
+			Key:   key,
+			Value: value,
+			Metadata: map[string]string{
+				"version":            strconv.FormatInt(s.Metadata.Version, 10),
+				"last_modified_date": s.Metadata.CreatedTime.Format(time.RFC3339),
+			},
+		})
+	}
+
+	return keyMetadata, nil
+}
+
+func (v *Vault) Delete(ctx context.Context, servicePath string, key string) error {
+	return v.DeleteKeys(ctx, servicePath, []string{key})
+}
+
+// DeleteKeys deletes keys by writing a new version of the secret without
+// them. When no keys are left, the latest version of the secret is deleted,
+// such that earlier versions can still be recovered.
+func (v *Vault) DeleteKeys(ctx context.Context, servicePath string, keys []string) error {
+	if len(keys) == 0 {
+		v.log.Warnf("DeleteKeys called with 0 keys")
+		return nil
+	}
+
+	return v.modify(ctx, servicePath, func(current map[string]string) bool {
+		changed := false
+		for _, key := range keys {
+			if _, exists := current[key]; !exists {
+				v.log.Warnf("Failed to delete %s/%s: key does not exist", servicePath, key)
+				continue
+			}
+			delete(current, key)
+			changed = true
+		}
+		return changed
+	})
+}
+
+func (v *Vault) MetadataKeys() []string {
+	return []string{
+		"version",
+		"last_modified_date",
+	}
+}
+
+func (v *Vault) String() string {
+	return fmt.Sprintf("Vault(%s/%s)", v.config.Address, v.config.Mount)
+}
+
+// modify reads the secret of servicePath, calls update with its fields and,
+// if update returns true, writes the updated fields as a new version of the
+// secret. The write fails if the secret was modified since it was read, in
+// which case it is retried.
+func (v *Vault) modify(ctx context.Context, servicePath string, update func(map[string]string) bool) error {
+	for attempt := 1; ; attempt++ {
+		s, err := v.readSecret(ctx, servicePath)
+		if err != nil {
+			return err
+		}
+
+		config := secretConfig(s)
+		if !update(config) {
+			return nil
+		}
+
+		if len(config) == 0 {
+			err = v.do(ctx, http.MethodDelete, v.secretURL("data", servicePath), nil, nil)
+		} else {
+			body := map[string]interface{}{
+				"data":    config,
+				"options": map[string]interface{}{"cas": s.Metadata.Version},
+			}
+			err = v.do(ctx, http.MethodPost, v.secretURL("data", servicePath), body, nil)
+		}
+		if !errors.Is(err, errCASMismatch) || attempt == maxCASAttempts {
+			return err
+		}
+
+		v.log.Debugf("%s was modified concurrently, retrying", servicePath)
+	}
+}
+
+// readSecret returns the latest version of the secret of servicePath. If the
+// secret doesn't exist, or its latest version is deleted, an empty secret is
+// returned.
+func (v *Vault) readSecret(ctx context.Context, servicePath string) (secret, error) {
+	response := struct {
+		Data secret `json:"data"`
+	}{}
+
+	err := v.do(ctx, http.MethodGet, v.secretURL("data", servicePath), nil, &response)
+	if errors.Is(err, storage.ErrConfigNotFound) {
+		return response.Data, nil
+	}
+
+	return response.Data, err
+}
+
+func (v *Vault) secretURL(kind string, servicePath string) string {
+	secretPath := strings.Trim(servicePath, "/")
+	return fmt.Sprintf("%s/v1/%s/%s/%s", v.config.Address, v.config.Mount, kind, (&url.URL{Path: secretPath}).EscapedPath())
+}
+
+// secretConfig returns the fields of s as strings. Fields that aren't
+// strings, e.g. if written by other tools, are returned as JSON.
+func secretConfig(s secret) map[string]string {
+	config := make(map[string]string, len(s.Data))
+	if len(s.Metadata.DeletionTime) > 0 || s.Metadata.Destroyed {
+		return config
+	}
+
+	for key, value := range s.Data {
+		switch value := value.(type) {
+		case string:
+			config[key] = value
+		default:
+			bs, _ := json.Marshal(value)
+			config[key] = string(bs)
+		}
+	}
+
+	return config
+}
+
+// do sends a request to Vault, authenticating using the current token. When
+// using AppRole, the token is renewed by logging in again when it has
+// expired or is rejected. Responses with status 404 are returned as
+// storage.ErrConfigNotFound, with the response decoded into response.
+func (v *Vault) do(ctx context.Context, method string, u string, body interface{}, response interface{}) error {
+	token, err := v.getToken(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	status, err := v.request(ctx, method, u, token, body, response)
+	if status == http.StatusForbidden && v.usesAppRole() {
+		v.log.Debugf("Token rejected, logging in again")
+
+		token, err = v.getToken(ctx, true)
+		if err != nil {
+			return err
+		}
+		_, err = v.request(ctx, method, u, token, body, response)
+	}
+
+	return err
+}
+
+func (v *Vault) request(ctx context.Context, method string, u string, token string, body interface{}, response interface{}) (int, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		bs, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		bodyReader = bytes.NewReader(bs)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, bodyReader)
+	if err != nil {
+		return 0, err
+	}
+	if len(token) > 0 {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if len(v.config.Namespace) > 0 {
+		req.Header.Set("X-Vault-Namespace", v.config.Namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	v.log.Debugf("%s %s", method, req.URL.Path)
+
+	res, err := v.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrRequestFailed, err)
+	}
+	defer res.Body.Close()
+
+	bs, err := io.ReadAll(res.Body)
+	if err != nil {
+		return res.StatusCode, fmt.Errorf("%w: %s", ErrRequestFailed, err)
+	}
+
+	if response != nil && len(bs) > 0 && (res.StatusCode < 300 || res.StatusCode == http.StatusNotFound) {
+		err = json.Unmarshal(bs, response)
+		if err != nil {
+			return res.StatusCode, fmt.Errorf("%w: decoding response: %s", ErrRequestFailed, err)
+		}
+	}
+
+	if res.StatusCode < 300 {
+		return res.StatusCode, nil
+	}
+
+	errResponse := struct {
+		Errors []string `json:"errors"`
+	}{}
+	json.Unmarshal(bs, &errResponse)
+	msg := strings.Join(errResponse.Errors, "; ")
+	if len(msg) == 0 {
+		msg = res.Status
+	}
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return res.StatusCode, fmt.Errorf("%w: %s", storage.ErrConfigNotFound, msg)
+	case res.StatusCode == http.StatusBadRequest && strings.Contains(msg, "check-and-set"):
+		return res.StatusCode, fmt.Errorf("%w: %s", errCASMismatch, msg)
+	}
+
+	return res.StatusCode, fmt.Errorf("%w with status %d: %s", ErrRequestFailed, res.StatusCode, msg)
+}
+
+func (v *Vault) usesAppRole() bool {
+	return len(v.config.Token) == 0
+}
+
+// getToken returns the token to authenticate with. When using AppRole, it
+// logs in if there is no token, the token has expired, or renew is true.
+func (v *Vault) getToken(ctx context.Context, renew bool) (string, error) {
+	if !v.usesAppRole() {
+		return v.config.Token, nil
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if !renew && len(v.token) > 0 && (v.tokenExpiry.IsZero() || time.Now().Before(v.tokenExpiry)) {
+		return v.token, nil
+	}
+
+	response := struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int64  `json:"lease_duration"`
+		} `json:"auth"`
+	}{}
+
+	loginURL := fmt.Sprintf("%s/v1/auth/%s/login", v.config.Address, strings.Trim(v.config.AppRoleMount, "/"))
+	body := map[string]string{
+		"role_id":   v.config.RoleID,
+		"secret_id": v.config.SecretID,
+	}
+	_, err := v.request(ctx, http.MethodPost, loginURL, "", body, &response)
+	if err != nil {
+		return "", fmt.Errorf("logging in using AppRole: %w", err)
+	}
+	if len(response.Auth.ClientToken) == 0 {
+		return "", fmt.Errorf("%w: AppRole login returned no token", ErrRequestFailed)
+	}
+
+	v.token = response.Auth.ClientToken
+	v.tokenExpiry = time.Time{}
+	if response.Auth.LeaseDuration > 0 {
+		// Renew a bit before expiry to avoid using tokens as they expire.
+		lease := time.Duration(response.Auth.LeaseDuration) * time.Second
+		v.tokenExpiry = time.Now().Add(lease - lease/10)
+	}
+	v.log.Debugf("Logged in using AppRole, token expires at %s", v.tokenExpiry)
+
+	return v.token, nil
+}
@@ -0,0 +1,207 @@
+package vault_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/micvbang/confman-go/pkg/logger"
+	"github.com/micvbang/confman-go/pkg/storage"
+	"github.com/micvbang/confman-go/pkg/storage/storagetest"
+	"github.com/micvbang/confman-go/pkg/storage/vault"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+var log = logger.LogrusWrapper{Logger: logrus.New()}
+
+const (
+	testToken    = "root-token"
+	testRoleID   = "role-id"
+	testSecretID = "secret-id"
+)
+
+// fakeVault is a minimal stand-in for the KV v2 and AppRole APIs of Vault.
+type fakeVault struct {
+	mu      sync.Mutex
+	secrets map[string][]fakeVersion
+	tokens  map[string]bool
+	logins  int
+}
+
+type fakeVersion struct {
+	data    map[string]interface{}
+	created time.Time
+	deleted time.Time
+}
+
+func newFakeVault(t *testing.T) (*fakeVault, *httptest.Server) {
+	fv := &fakeVault{
+		secrets: make(map[string][]fakeVersion),
+		tokens:  map[string]bool{testToken: true},
+	}
+
+	ts := httptest.NewServer(fv)
+	t.Cleanup(ts.Close)
+
+	return fv, ts
+}
+
+func (fv *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fv.mu.Lock()
+	defer fv.mu.Unlock()
+
+	if r.URL.Path == "/v1/auth/approle/login" {
+		body := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["role_id"] != testRoleID || body["secret_id"] != testSecretID {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{"errors": []string{"invalid role or secret ID"}})
+			return
+		}
+
+		fv.logins++
+		token := "approle-token-" + time.Now().Format(time.RFC3339Nano)
+		fv.tokens[token] = true
+		writeJSON(w, http.StatusOK, map[string]interface{}{"auth": map[string]interface{}{"client_token": token, "lease_duration": 3600}})
+		return
+	}
+
+	if !fv.tokens[r.Header.Get("X-Vault-Token")] {
+		writeJSON(w, http.StatusForbidden, map[string]interface{}{"errors": []string{"permission denied"}})
+		return
+	}
+
+	const dataPrefix = "/v1/secret/data/"
+	if !strings.HasPrefix(r.URL.Path, dataPrefix) {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{"errors": []string{}})
+		return
+	}
+	secretPath := strings.TrimPrefix(r.URL.Path, dataPrefix)
+	versions := fv.secrets[secretPath]
+
+	switch r.Method {
+	case http.MethodGet:
+		if len(versions) == 0 {
+			writeJSON(w, http.StatusNotFound, map[string]interface{}{"errors": []string{}})
+			return
+		}
+
+		latest := versions[len(versions)-1]
+		status, deletionTime := http.StatusOK, ""
+		if !latest.deleted.IsZero() {
+			status, deletionTime = http.StatusNotFound, latest.deleted.Format(time.RFC3339Nano)
+		}
+		writeJSON(w, status, map[string]interface{}{
+			"data": map[string]interface{}{
+				"data": latest.data,
+				"metadata": map[string]interface{}{
+					"created_time":  latest.created.Format(time.RFC3339Nano),
+					"deletion_time": deletionTime,
+					"destroyed":     false,
+					"version":       len(versions),
+				},
+			},
+		})
+
+	case http.MethodPost:
+		body := struct {
+			Data    map[string]interface{} `json:"data"`
+			Options map[string]int         `json:"options"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		if cas, exists := body.Options["cas"]; exists && cas != len(versions) {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{"errors": []string{"check-and-set parameter did not match the current version"}})
+			return
+		}
+
+		fv.secrets[secretPath] = append(versions, fakeVersion{data: body.Data, created: time.Now()})
+		writeJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"version": len(versions) + 1}})
+
+	case http.MethodDelete:
+		if len(versions) > 0 {
+			versions[len(versions)-1].deleted = time.Now()
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// TestVault verifies that Vault passes the storage conformance suite.
+func TestVault(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		_, ts := newFakeVault(t)
+
+		v, err := vault.New(log, ts.Client(), vault.Config{Address: ts.URL, Token: testToken})
+		require.NoError(t, err)
+		return v
+	})
+}
+
+// TestVaultAppRole verifies that Vault logs in using AppRole, and logs in
+// again when its token is rejected.
+func TestVaultAppRole(t *testing.T) {
+	ctx := context.Background()
+	fv, ts := newFakeVault(t)
+
+	v, err := vault.New(log, ts.Client(), vault.Config{Address: ts.URL, RoleID: testRoleID, SecretID: testSecretID})
+	require.NoError(t, err)
+
+	require.NoError(t, v.Write(ctx, "/service/production", "KEY", "value"))
+	require.Equal(t, 1, fv.logins)
+
+	// Revoke all AppRole tokens
+	fv.mu.Lock()
+	fv.tokens = map[string]bool{testToken: true}
+	fv.mu.Unlock()
+
+	value, err := v.Read(ctx, "/service/production", "KEY")
+	require.NoError(t, err)
+	require.Equal(t, "value", value)
+	require.Equal(t, 2, fv.logins)
+
+	v, err = vault.New(log, ts.Client(), vault.Config{Address: ts.URL, RoleID: testRoleID, SecretID: "invalid"})
+	require.NoError(t, err)
+	_, err = v.ReadAll(ctx, "/service/production")
+	require.ErrorIs(t, err, vault.ErrRequestFailed)
+}
+
+// TestVaultErrors verifies that invalid configs and rejected tokens are
+// reported as errors, and that fields that aren't strings are read as JSON.
+func TestVaultErrors(t *testing.T) {
+	ctx := context.Background()
+	fv, ts := newFakeVault(t)
+
+	_, err := vault.New(log, nil, vault.Config{Token: testToken})
+	require.ErrorIs(t, err, vault.ErrInvalidConfig)
+
+	_, err = vault.New(log, nil, vault.Config{Address: ts.URL, RoleID: testRoleID})
+	require.ErrorIs(t, err, vault.ErrInvalidConfig)
+
+	v, err := vault.New(log, ts.Client(), vault.Config{Address: ts.URL, Token: "invalid"})
+	require.NoError(t, err)
+	_, err = v.ReadAll(ctx, "/service/production")
+	require.ErrorIs(t, err, vault.ErrRequestFailed)
+	require.Contains(t, err.Error(), "permission denied")
+
+	fv.secrets["service/production"] = []fakeVersion{{
+		data:    map[string]interface{}{"PORT": 5432, "HOSTS": []string{"a", "b"}},
+		created: time.Now(),
+	}}
+
+	v, err = vault.New(log, ts.Client(), vault.Config{Address: ts.URL, Token: testToken})
+	require.NoError(t, err)
+	config, err := v.ReadAll(ctx, "/service/production")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"PORT": "5432", "HOSTS": `["a","b"]`}, config)
+}